@@ -1,7 +1,12 @@
 package main
 
 import (
+	"log"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/helper"
+
 	// The set of controllers this controller process runs.
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/customrun"
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/pipelinerun"
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/taskrun"
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/tektonpruner"
@@ -11,9 +16,15 @@ import (
 )
 
 func main() {
+	// hooks invoked around each deletion
+	if err := helper.RegisterBuiltinDeletionHooks(); err != nil {
+		log.Fatal("error on registering deletion hooks: ", err)
+	}
+
 	sharedmain.Main("tekton-pruner-controller",
 		tektonpruner.NewController,
 		pipelinerun.NewController,
 		taskrun.NewController,
+		customrun.NewController,
 	)
 }
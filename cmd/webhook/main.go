@@ -20,6 +20,7 @@ import (
 	"knative.dev/pkg/webhook/resourcesemantics/validation"
 
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/apis/tektonpruner/v1alpha1"
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/helper"
 )
 
 var types = map[schema.GroupVersionKind]resourcesemantics.GenericCRD{
@@ -100,6 +101,8 @@ func newConfigValidationController(name string) func(context.Context, configmap.
 			configmap.Constructors{
 				logging.ConfigMapName(): logging.NewConfigFromConfigMap,
 				metrics.ConfigMapName(): metrics.NewObservabilityConfigFromConfigMap,
+				// rejects the invalid global config of the pruner
+				helper.PrunerConfigMapName: helper.NewPrunerConfigFromConfigMap,
 			},
 		)
 	}
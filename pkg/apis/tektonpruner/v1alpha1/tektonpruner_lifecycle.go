@@ -42,3 +42,8 @@ func (tps *TektonPrunerStatus) InitializeConditions() {
 func (tps *TektonPrunerStatus) MarkReady() {
 	tektonPrunerCondSet.Manage(tps).MarkTrue(TektonPrunerConditionReady)
 }
+
+// MarkInvalid marks the config is not accepted, with the validation error as message
+func (tps *TektonPrunerStatus) MarkInvalid(reason, messageFormat string, messageA ...interface{}) {
+	tektonPrunerCondSet.Manage(tps).MarkFalse(TektonPrunerConditionReady, reason, messageFormat, messageA...)
+}
@@ -24,12 +24,22 @@ import (
 
 type EnforcedConfigLevel string
 
+// reference time of the ttl
+type TTLFrom string
+
 const (
 	TektonPrunerConditionReady = apis.ConditionReady
+	// reason of the ready condition, when the spec is rejected by the validation
+	TektonPrunerReasonInvalidSpec = "InvalidSpec"
 
 	EnforcedConfigLevelGlobal    EnforcedConfigLevel = "global"
 	EnforcedConfigLevelNamespace EnforcedConfigLevel = "namespace"
 	EnforcedConfigLevelResource  EnforcedConfigLevel = "resource"
+
+	// the ttl is computed from the completion time
+	TTLFromCompletion TTLFrom = "completion"
+	// the ttl is computed from the start time, falls back to the completion time, if the run has no start time
+	TTLFromStart TTLFrom = "start"
 )
 
 // TektonPrunerSpec defines the desired state of TektonPruner
@@ -64,11 +74,36 @@ type ResourceSpec struct {
 	FailedHistoryLimit *int32 `json:"failedHistoryLimit,omitempty"`
 	// +optional
 	HistoryLimit *int32 `json:"historyLimit,omitempty"`
+	// +optional
+	// history limit of the cancelled runs, the cancelled runs are counted as failed, if not defined
+	CancelledHistoryLimit *int32 `json:"cancelledHistoryLimit,omitempty"`
+	// +optional
+	// ttl of the cancelled runs, takes precedence over ttlSecondsAfterFinished for the cancelled runs
+	CancelledTTLSecondsAfterFinished *int32 `json:"cancelledTTLSecondsAfterFinished,omitempty"`
+	// +optional
+	// label keys to group the history, the history limits apply per distinct combination of the label values
+	GroupBy []string `json:"groupBy,omitempty"`
+	// +optional
+	// allowed values: completion, start (default: completion)
+	TTLFrom TTLFrom `json:"ttlFrom,omitempty"`
 }
 
 // TektonPrunerStatus defines the observed state of TektonPruner
 type TektonPrunerStatus struct {
 	duckv1.Status `json:",inline"`
+	// +optional
+	// number of the completed resources retained in the namespace, per reason
+	// keys are limited to the known reasons: withinTTL, withinHistoryLimit, legalHold, deletionHook, awaitingAnnotation, skipAnnotation, missingCondition, resourceSelector
+	RetentionBreakdown map[string]int64 `json:"retentionBreakdown,omitempty"`
+	// +optional
+	// number of the resources deleted in the namespace, on the last refresh with deletions
+	LastPrunedCount int64 `json:"lastPrunedCount,omitempty"`
+	// +optional
+	// time of the last deletion in the namespace
+	LastPrunedTime *metav1.Time `json:"lastPrunedTime,omitempty"`
+	// +optional
+	// number of the resources deleted in the namespace, on the last refresh with deletions, per resource type
+	LastPrunedCountByType map[string]int64 `json:"lastPrunedCountByType,omitempty"`
 }
 
 // TektonPruner is the Schema for the tektonpruners API
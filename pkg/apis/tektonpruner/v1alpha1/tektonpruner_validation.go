@@ -18,7 +18,11 @@ package v1alpha1
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"strings"
 
+	"k8s.io/apimachinery/pkg/util/validation"
 	"knative.dev/pkg/apis"
 )
 
@@ -26,10 +30,99 @@ var _ apis.Validatable = (*TektonPruner)(nil)
 
 // Validate TektonPruner
 func (tp *TektonPruner) Validate(ctx context.Context) *apis.FieldError {
-	return nil
+	return tp.Spec.Validate(apis.WithinSpec(ctx)).ViaField("spec")
 }
 
 // Validate TektonPrunerSpec
 func (tps *TektonPrunerSpec) Validate(ctx context.Context) (errs *apis.FieldError) {
-	return nil
+	errs = errs.Also(validateEnforcedConfigLevel(tps.EnforcedConfigLevel))
+	errs = errs.Also(validateLimits(tps.TTLSecondsAfterFinished, tps.SuccessfulHistoryLimit, tps.FailedHistoryLimit, tps.HistoryLimit))
+	errs = errs.Also(validateResourceSpecs(ctx, tps.Pipelines).ViaField("pipelines"))
+	errs = errs.Also(validateResourceSpecs(ctx, tps.Tasks).ViaField("tasks"))
+	return errs
+}
+
+// Validate ResourceSpec
+func (rs *ResourceSpec) Validate(ctx context.Context) (errs *apis.FieldError) {
+	if rs.Name == "" {
+		errs = errs.Also(apis.ErrMissingField("name"))
+	}
+	errs = errs.Also(validateEnforcedConfigLevel(rs.EnforcedConfigLevel))
+	errs = errs.Also(validateLimits(rs.TTLSecondsAfterFinished, rs.SuccessfulHistoryLimit, rs.FailedHistoryLimit, rs.HistoryLimit))
+	errs = errs.Also(validateLimit(rs.CancelledHistoryLimit, "cancelledHistoryLimit"))
+	errs = errs.Also(validateLimit(rs.CancelledTTLSecondsAfterFinished, "cancelledTTLSecondsAfterFinished"))
+	errs = errs.Also(validateGroupBy(rs.GroupBy))
+	errs = errs.Also(validateTTLFrom(rs.TTLFrom))
+	return errs
+}
+
+func validateResourceSpecs(ctx context.Context, resourceSpecs []ResourceSpec) (errs *apis.FieldError) {
+	names := map[string]int{}
+	for index := range resourceSpecs {
+		resourceSpec := &resourceSpecs[index]
+		errs = errs.Also(resourceSpec.Validate(ctx).ViaIndex(index))
+		if resourceSpec.Name == "" {
+			continue
+		}
+		if previousIndex, found := names[resourceSpec.Name]; found {
+			errs = errs.Also(&apis.FieldError{
+				Message: fmt.Sprintf("duplicate name %q, already defined at index %d", resourceSpec.Name, previousIndex),
+				Paths:   []string{"name"},
+			}).ViaIndex(index)
+			continue
+		}
+		names[resourceSpec.Name] = index
+	}
+	return errs
+}
+
+// in a namespace, allowed values: namespace, resource
+func validateEnforcedConfigLevel(enforcedConfigLevel *EnforcedConfigLevel) *apis.FieldError {
+	if enforcedConfigLevel == nil {
+		return nil
+	}
+	switch *enforcedConfigLevel {
+	case EnforcedConfigLevelNamespace, EnforcedConfigLevelResource:
+		return nil
+	}
+	return apis.ErrInvalidValue(*enforcedConfigLevel, "enforcedConfigLevel",
+		fmt.Sprintf("allowed values: %s, %s", EnforcedConfigLevelNamespace, EnforcedConfigLevelResource))
+}
+
+// the group by keys should be valid label keys
+func validateGroupBy(groupBy []string) (errs *apis.FieldError) {
+	for index, key := range groupBy {
+		if messages := validation.IsQualifiedName(key); len(messages) > 0 {
+			err := apis.ErrInvalidArrayValue(key, "groupBy", index)
+			err.Details = strings.Join(messages, ", ")
+			errs = errs.Also(err)
+		}
+	}
+	return errs
+}
+
+// -1 disables the ttl and the history limits
+func validateLimits(ttlSecondsAfterFinished, successfulHistoryLimit, failedHistoryLimit, historyLimit *int32) (errs *apis.FieldError) {
+	errs = errs.Also(validateLimit(ttlSecondsAfterFinished, "ttlSecondsAfterFinished"))
+	errs = errs.Also(validateLimit(successfulHistoryLimit, "successfulHistoryLimit"))
+	errs = errs.Also(validateLimit(failedHistoryLimit, "failedHistoryLimit"))
+	errs = errs.Also(validateLimit(historyLimit, "historyLimit"))
+	return errs
+}
+
+func validateLimit(value *int32, field string) *apis.FieldError {
+	if value == nil || *value >= -1 {
+		return nil
+	}
+	return apis.ErrOutOfBoundsValue(*value, -1, math.MaxInt32, field)
+}
+
+// allowed values: completion, start
+func validateTTLFrom(ttlFrom TTLFrom) *apis.FieldError {
+	switch ttlFrom {
+	case "", TTLFromCompletion, TTLFromStart:
+		return nil
+	}
+	return apis.ErrInvalidValue(ttlFrom, "ttlFrom",
+		fmt.Sprintf("allowed values: %s, %s", TTLFromCompletion, TTLFromStart))
 }
@@ -43,6 +43,21 @@ func (in *ResourceSpec) DeepCopyInto(out *ResourceSpec) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.CancelledHistoryLimit != nil {
+		in, out := &in.CancelledHistoryLimit, &out.CancelledHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CancelledTTLSecondsAfterFinished != nil {
+		in, out := &in.CancelledTTLSecondsAfterFinished, &out.CancelledTTLSecondsAfterFinished
+		*out = new(int32)
+		**out = **in
+	}
+	if in.GroupBy != nil {
+		in, out := &in.GroupBy, &out.GroupBy
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -166,6 +181,24 @@ func (in *TektonPrunerSpec) DeepCopy() *TektonPrunerSpec {
 func (in *TektonPrunerStatus) DeepCopyInto(out *TektonPrunerStatus) {
 	*out = *in
 	in.Status.DeepCopyInto(&out.Status)
+	if in.RetentionBreakdown != nil {
+		in, out := &in.RetentionBreakdown, &out.RetentionBreakdown
+		*out = make(map[string]int64, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.LastPrunedTime != nil {
+		in, out := &in.LastPrunedTime, &out.LastPrunedTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastPrunedCountByType != nil {
+		in, out := &in.LastPrunedCountByType, &out.LastPrunedCountByType
+		*out = make(map[string]int64, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	return
 }
 
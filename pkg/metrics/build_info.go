@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"context"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+var (
+	versionTag   = tag.MustNewKey("version")
+	gitCommitTag = tag.MustNewKey("git_commit")
+
+	buildInfo = stats.Int64("build_info",
+		"build details of the running pruner, always 1",
+		stats.UnitDimensionless)
+
+	buildInfoView = &view.View{
+		Description: buildInfo.Description(),
+		Measure:     buildInfo,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{versionTag, gitCommitTag},
+	}
+)
+
+// RecordBuildInfo records the version of the running pruner
+// joined with the other metrics, correlates the behavior changes with the deployments
+func RecordBuildInfo(ctx context.Context, version, gitCommit string) {
+	record(ctx, buildInfo.M(1),
+		tag.Insert(versionTag, version),
+		tag.Insert(gitCommitTag, gitCommit),
+	)
+}
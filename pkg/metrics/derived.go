@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// convenience metrics derived from the counters, computed in-process over a sliding window
+// helps the dashboards to graph directly, without the rate/ratio queries
+// the values are approximate, the counters remain the source of truth
+
+const (
+	// window of the derived metrics
+	derivedMetricsWindow = 5 * time.Minute
+	// interval to compute the derived metrics
+	derivedMetricsInterval = 30 * time.Second
+)
+
+var (
+	namespaceDeletionRate = stats.Float64("namespace_deletion_rate",
+		"number of resources deleted per second in a namespace, over the last 5 minutes",
+		stats.UnitDimensionless)
+
+	namespaceDeletionRateView = &view.View{
+		Description: namespaceDeletionRate.Description(),
+		Measure:     namespaceDeletionRate,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{namespaceTag},
+	}
+
+	errorRatio = stats.Float64("error_ratio",
+		"ratio of the failed reconciles to the processed reconciles, over the last 5 minutes",
+		stats.UnitDimensionless)
+
+	errorRatioView = &view.View{
+		Description: errorRatio.Description(),
+		Measure:     errorRatio,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{resourceTag},
+	}
+
+	enforcedConfigLevel = stats.Int64("enforced_config_level",
+		"number of the processed resources resolved to the enforced config level",
+		stats.UnitDimensionless)
+
+	enforcedConfigLevelView = &view.View{
+		Description: enforcedConfigLevel.Description(),
+		Measure:     enforcedConfigLevel,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{levelTag},
+	}
+
+	// bounded, the resources over the limit are not counted
+	enforcedConfigLevels = &levelTracker{maxEntries: 100000, levels: map[string]string{}}
+
+	deletionsWindow = newWindowCounter(derivedMetricsWindow)
+	processedWindow = newWindowCounter(derivedMetricsWindow)
+	errorsWindow    = newWindowCounter(derivedMetricsWindow)
+)
+
+// counts the events per key, in one second buckets over a sliding window
+type windowCounter struct {
+	mutex   sync.Mutex
+	window  time.Duration
+	buckets map[string]map[int64]int64
+}
+
+func newWindowCounter(window time.Duration) *windowCounter {
+	return &windowCounter{window: window, buckets: map[string]map[int64]int64{}}
+}
+
+func (wc *windowCounter) add(key string, now time.Time) {
+	wc.mutex.Lock()
+	defer wc.mutex.Unlock()
+	buckets, found := wc.buckets[key]
+	if !found {
+		buckets = map[int64]int64{}
+		wc.buckets[key] = buckets
+	}
+	buckets[now.Unix()]++
+}
+
+// returns the number of events per key within the window, the keys without events are removed
+// the removed keys are returned with zero count once, to reset the gauges
+func (wc *windowCounter) counts(now time.Time) map[string]int64 {
+	wc.mutex.Lock()
+	defer wc.mutex.Unlock()
+	oldest := now.Add(-wc.window).Unix()
+	counts := map[string]int64{}
+	for key, buckets := range wc.buckets {
+		for second, count := range buckets {
+			if second <= oldest {
+				delete(buckets, second)
+				continue
+			}
+			counts[key] += count
+		}
+		if len(buckets) == 0 {
+			delete(wc.buckets, key)
+			counts[key] = 0
+		}
+	}
+	return counts
+}
+
+// RecordReconcileResult records a processed reconcile and if it is failed
+func RecordReconcileResult(ctx context.Context, resourceType string, failed bool) {
+	now := time.Now()
+	processedWindow.add(resourceType, now)
+	if failed {
+		errorsWindow.add(resourceType, now)
+	}
+}
+
+// RunDerivedMetrics computes the derived metrics on every interval, until the context is cancelled
+func RunDerivedMetrics(ctx context.Context) {
+	ticker := time.NewTicker(derivedMetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			recordDerivedMetrics(ctx, now)
+		}
+	}
+}
+
+func recordDerivedMetrics(ctx context.Context, now time.Time) {
+	for namespace, count := range deletionsWindow.counts(now) {
+		record(ctx, namespaceDeletionRate.M(float64(count)/derivedMetricsWindow.Seconds()),
+			tag.Insert(namespaceTag, namespace),
+		)
+	}
+
+	for level, count := range enforcedConfigLevels.counts("global", "namespace", "resource") {
+		record(ctx, enforcedConfigLevel.M(count),
+			tag.Insert(levelTag, level),
+		)
+	}
+
+	errorCounts := errorsWindow.counts(now)
+	for resourceType, processedCount := range processedWindow.counts(now) {
+		ratio := float64(0)
+		if processedCount > 0 {
+			ratio = float64(errorCounts[resourceType]) / float64(processedCount)
+		}
+		record(ctx, errorRatio.M(ratio),
+			resourceTypeTag(resourceType),
+		)
+	}
+}
+
+// ObserveEnforcedConfigLevel records the enforced config level resolved for a processed resource
+// keyed by the uid, a resource recreated with the same name is tracked as a new resource
+func ObserveEnforcedConfigLevel(resourceType, uid, level string) {
+	enforcedConfigLevels.observe(resourceType+"/"+uid, level)
+}
+
+// ForgetResource removes a deleted resource from the derived metrics
+func ForgetResource(resourceType, uid string) {
+	enforcedConfigLevels.forget(resourceType + "/" + uid)
+}
+
+// keeps the last resolved enforced config level of the processed resources
+type levelTracker struct {
+	mutex      sync.Mutex
+	maxEntries int
+	levels     map[string]string
+}
+
+func (lt *levelTracker) observe(key, level string) {
+	lt.mutex.Lock()
+	defer lt.mutex.Unlock()
+	if _, found := lt.levels[key]; !found && len(lt.levels) >= lt.maxEntries {
+		return
+	}
+	lt.levels[key] = level
+}
+
+func (lt *levelTracker) forget(key string) {
+	lt.mutex.Lock()
+	defer lt.mutex.Unlock()
+	delete(lt.levels, key)
+}
+
+// returns the number of resources per level, the known levels are always included
+func (lt *levelTracker) counts(knownLevels ...string) map[string]int64 {
+	lt.mutex.Lock()
+	defer lt.mutex.Unlock()
+	counts := map[string]int64{}
+	for _, level := range knownLevels {
+		counts[level] = 0
+	}
+	for _, level := range lt.levels {
+		counts[level]++
+	}
+	return counts
+}
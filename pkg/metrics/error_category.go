@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+
+	"go.opencensus.io/tag"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// categories of the reconcile errors
+const (
+	ErrorCategoryPermissionDenied = "permission_denied"
+	ErrorCategoryNotFound         = "not_found"
+	ErrorCategoryConflict         = "conflict"
+	ErrorCategoryThrottled        = "throttled"
+	ErrorCategoryTimeout          = "timeout"
+	ErrorCategoryInvalid          = "invalid"
+	ErrorCategoryOther            = "other"
+)
+
+// returns the category of an error, from the status of the api server response
+func errorCategory(err error) string {
+	switch {
+	case apierrors.IsForbidden(err), apierrors.IsUnauthorized(err):
+		return ErrorCategoryPermissionDenied
+	case apierrors.IsNotFound(err):
+		return ErrorCategoryNotFound
+	case apierrors.IsConflict(err):
+		return ErrorCategoryConflict
+	case apierrors.IsTooManyRequests(err):
+		return ErrorCategoryThrottled
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err), errors.Is(err, context.DeadlineExceeded):
+		return ErrorCategoryTimeout
+	case apierrors.IsInvalid(err), apierrors.IsBadRequest(err):
+		return ErrorCategoryInvalid
+	}
+	return ErrorCategoryOther
+}
+
+// RecordReconcileError records a failed reconcile, with the category of the error
+func RecordReconcileError(ctx context.Context, resourceType string, err error) {
+	record(ctx, errorsByCategoryCount.M(1),
+		resourceTypeTag(resourceType),
+		tag.Insert(categoryTag, errorCategory(err)),
+	)
+}
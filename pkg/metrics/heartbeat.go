@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// interval to update the heartbeat
+const heartbeatInterval = 30 * time.Second
+
+var (
+	heartbeatTimestamp = stats.Float64("heartbeat_timestamp_seconds",
+		"unix time of the last heartbeat of the pruner, updated on a fixed interval",
+		stats.UnitSeconds)
+
+	heartbeatTimestampView = &view.View{
+		Description: heartbeatTimestamp.Description(),
+		Measure:     heartbeatTimestamp,
+		Aggregation: view.LastValue(),
+	}
+
+	lastReconcileTimestamp = stats.Float64("last_reconcile_timestamp_seconds",
+		"unix time of the last successful reconcile of a run in a namespace",
+		stats.UnitSeconds)
+
+	lastReconcileTimestampView = &view.View{
+		Description: lastReconcileTimestamp.Description(),
+		Measure:     lastReconcileTimestamp,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{namespaceTag},
+	}
+)
+
+// RunHeartbeat updates the heartbeat on every interval, until the context is cancelled
+// independent of the pruning activity, a stale heartbeat indicates a hung controller
+func RunHeartbeat(ctx context.Context) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	recordHeartbeat(ctx, time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			recordHeartbeat(ctx, now)
+		}
+	}
+}
+
+func recordHeartbeat(ctx context.Context, now time.Time) {
+	record(ctx, heartbeatTimestamp.M(float64(now.UnixNano())/float64(time.Second)))
+}
+
+// RecordLastReconcile records a successful reconcile of a run in the namespace, a requeue is considered successful
+// a stale value on a namespace with the completed runs indicates the pruning is stalled on the namespace
+func RecordLastReconcile(ctx context.Context, namespace string, now time.Time) {
+	record(ctx, lastReconcileTimestamp.M(float64(now.UnixNano())/float64(time.Second)),
+		tag.Insert(namespaceTag, namespace),
+	)
+}
@@ -0,0 +1,431 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"knative.dev/pkg/metrics"
+)
+
+// metrics of the pruner
+// recorded with knative metrics, exported with the backend configured on the observability ConfigMap
+
+var (
+	namespaceTag = tag.MustNewKey("namespace")
+	resourceTag  = tag.MustNewKey("resource")
+	policyTag    = tag.MustNewKey("policy")
+	reasonTag    = tag.MustNewKey("reason")
+	levelTag     = tag.MustNewKey("level")
+	categoryTag  = tag.MustNewKey("category")
+
+	resourcesDeletedCount = stats.Int64("resources_deleted_count",
+		"number of resources deleted by the pruner",
+		stats.UnitDimensionless)
+
+	// a single reason is reported per deletion, on the precedence of the policies
+	resourcesDeletedView = &view.View{
+		Description: resourcesDeletedCount.Description(),
+		Measure:     resourcesDeletedCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{namespaceTag, resourceTag, reasonTag},
+	}
+
+	futureCompletionTimeCount = stats.Int64("future_completion_time_total",
+		"number of times a resource found with the completion time in the future",
+		stats.UnitDimensionless)
+
+	futureCompletionTimeView = &view.View{
+		Description: futureCompletionTimeCount.Description(),
+		Measure:     futureCompletionTimeCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{namespaceTag, resourceTag},
+	}
+
+	reconcileQueueLatency = stats.Float64("reconcile_queue_latency_seconds",
+		"time between a resource observed as completed and the reconciler acting on it",
+		stats.UnitSeconds)
+
+	reconcileQueueLatencyView = &view.View{
+		Description: reconcileQueueLatency.Description(),
+		Measure:     reconcileQueueLatency,
+		Aggregation: view.Distribution(0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 600),
+		TagKeys:     []tag.Key{namespaceTag, resourceTag},
+	}
+
+	detectionLatency = stats.Float64("detection_latency_seconds",
+		"time between a resource completed and the pruner observing it as completed",
+		stats.UnitSeconds)
+
+	detectionLatencyView = &view.View{
+		Description: detectionLatency.Description(),
+		Measure:     detectionLatency,
+		Aggregation: view.Distribution(0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 600),
+		TagKeys:     []tag.Key{namespaceTag, resourceTag},
+	}
+
+	namespaceFilteredCount = stats.Int64("namespace_filtered_count",
+		"number of times a policy skipped on a namespace",
+		stats.UnitDimensionless)
+
+	namespaceFilteredView = &view.View{
+		Description: namespaceFilteredCount.Description(),
+		Measure:     namespaceFilteredCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{namespaceTag, policyTag, reasonTag},
+	}
+
+	effectivePolicyPresent = stats.Int64("effective_policy_present",
+		"1 if the pruner config has a ttl or a history limit at any level, 0 otherwise",
+		stats.UnitDimensionless)
+
+	effectivePolicyPresentView = &view.View{
+		Description: effectivePolicyPresent.Description(),
+		Measure:     effectivePolicyPresent,
+		Aggregation: view.LastValue(),
+	}
+
+	paused = stats.Int64("paused",
+		"1 if the pruning is paused with the global config, 0 otherwise",
+		stats.UnitDimensionless)
+
+	pausedView = &view.View{
+		Description: paused.Description(),
+		Measure:     paused,
+		Aggregation: view.LastValue(),
+	}
+
+	deletePermissionGranted = stats.Int64("delete_permission_granted",
+		"1 if the pruner has permission to delete the resources in the namespace, 0 otherwise, empty namespace is cluster wide",
+		stats.UnitDimensionless)
+
+	deletePermissionGrantedView = &view.View{
+		Description: deletePermissionGranted.Description(),
+		Measure:     deletePermissionGranted,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{namespaceTag, resourceTag},
+	}
+
+	stuckRuns = stats.Int64("stuck_runs",
+		"number of the runs not completed after the maximum age",
+		stats.UnitDimensionless)
+
+	stuckRunsView = &view.View{
+		Description: stuckRuns.Description(),
+		Measure:     stuckRuns,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{namespaceTag, resourceTag},
+	}
+
+	updateConflictCount = stats.Int64("update_conflict_count",
+		"number of conflicts on updating the annotations of a resource",
+		stats.UnitDimensionless)
+
+	updateConflictView = &view.View{
+		Description: updateConflictCount.Description(),
+		Measure:     updateConflictCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{namespaceTag, resourceTag},
+	}
+
+	historyReevaluationCount = stats.Int64("history_reevaluation_total",
+		"number of the processed resources evaluated again by the history limiter",
+		stats.UnitDimensionless)
+
+	historyReevaluationView = &view.View{
+		Description: historyReevaluationCount.Description(),
+		Measure:     historyReevaluationCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{namespaceTag, resourceTag, reasonTag},
+	}
+
+	historyOverage = stats.Int64("history_overage",
+		"number of resources over the history limit, when the history is trimmed",
+		stats.UnitDimensionless)
+
+	historyOverageView = &view.View{
+		Description: historyOverage.Description(),
+		Measure:     historyOverage,
+		Aggregation: view.Distribution(1, 2, 5, 10, 20, 50, 100, 200, 500, 1000),
+		TagKeys:     []tag.Key{namespaceTag, resourceTag},
+	}
+
+	configUnknownFieldsCount = stats.Int64("config_unknown_fields_total",
+		"number of the unknown fields found on loading the global config",
+		stats.UnitDimensionless)
+
+	configUnknownFieldsView = &view.View{
+		Description: configUnknownFieldsCount.Description(),
+		Measure:     configUnknownFieldsCount,
+		Aggregation: view.Count(),
+	}
+
+	resourcesDryRunCount = stats.Int64("resources_dry_run_total",
+		"number of resources to be deleted by the pruner, not deleted on the dry run",
+		stats.UnitDimensionless)
+
+	resourcesDryRunView = &view.View{
+		Description: resourcesDryRunCount.Description(),
+		Measure:     resourcesDryRunCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{namespaceTag, resourceTag},
+	}
+
+	activeDeleteWorkers = stats.Int64("active_delete_workers",
+		"number of the workers deleting the resources on trimming the history",
+		stats.UnitDimensionless)
+
+	activeDeleteWorkersView = &view.View{
+		Description: activeDeleteWorkers.Description(),
+		Measure:     activeDeleteWorkers,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{resourceTag},
+	}
+
+	resourcesSkippedCount = stats.Int64("resources_skipped_count",
+		"number of times a resource skipped by the pruner, with the reason",
+		stats.UnitDimensionless)
+
+	resourcesSkippedView = &view.View{
+		Description: resourcesSkippedCount.Description(),
+		Measure:     resourcesSkippedCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{namespaceTag, resourceTag, reasonTag},
+	}
+
+	errorsByCategoryCount = stats.Int64("errors_by_category_total",
+		"number of the failed reconciles, with the category of the error",
+		stats.UnitDimensionless)
+
+	errorsByCategoryView = &view.View{
+		Description: errorsByCategoryCount.Description(),
+		Measure:     errorsByCategoryCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{resourceTag, categoryTag},
+	}
+
+	deletionFractionCapCount = stats.Int64("deletion_fraction_cap_total",
+		"number of the sweeps capped by the maximum deletion fraction of the namespace",
+		stats.UnitDimensionless)
+
+	deletionFractionCapView = &view.View{
+		Description: deletionFractionCapCount.Description(),
+		Measure:     deletionFractionCapCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{namespaceTag, resourceTag},
+	}
+
+	// all the views of the pruner
+	views = []*view.View{
+		resourcesDeletedView,
+		futureCompletionTimeView,
+		reconcileQueueLatencyView,
+		detectionLatencyView,
+		namespaceFilteredView,
+		namespaceDeletionRateView,
+		errorRatioView,
+		enforcedConfigLevelView,
+		effectivePolicyPresentView,
+		pausedView,
+		deletePermissionGrantedView,
+		stuckRunsView,
+		updateConflictView,
+		historyReevaluationView,
+		historyOverageView,
+		configUnknownFieldsView,
+		resourcesDryRunView,
+		heartbeatTimestampView,
+		activeDeleteWorkersView,
+		buildInfoView,
+		resourcesSkippedView,
+		errorsByCategoryView,
+		deletionFractionCapView,
+		lastReconcileTimestampView,
+	}
+)
+
+func init() {
+	if err := view.Register(views...); err != nil {
+		panic(err)
+	}
+}
+
+// RecordResourceDeleted records a resource deleted by the pruner, with the reason of the deletion
+func RecordResourceDeleted(ctx context.Context, resourceType, namespace, reason string) {
+	deletionsWindow.add(namespace, time.Now())
+	record(ctx, resourcesDeletedCount.M(1),
+		tag.Insert(namespaceTag, namespace),
+		resourceTypeTag(resourceType),
+		tag.Insert(reasonTag, reason),
+	)
+}
+
+// RecordResourceDryRun records a resource to be deleted by the pruner, not deleted on the dry run
+func RecordResourceDryRun(ctx context.Context, resourceType, namespace string) {
+	record(ctx, resourcesDryRunCount.M(1),
+		tag.Insert(namespaceTag, namespace),
+		resourceTypeTag(resourceType),
+	)
+}
+
+// RecordResourceSkipped records a resource skipped by the pruner, with the reason
+func RecordResourceSkipped(ctx context.Context, resourceType, namespace, reason string) {
+	record(ctx, resourcesSkippedCount.M(1),
+		tag.Insert(namespaceTag, namespace),
+		resourceTypeTag(resourceType),
+		tag.Insert(reasonTag, reason),
+	)
+}
+
+// RecordFutureCompletionTime records a resource found with the completion time in the future
+func RecordFutureCompletionTime(ctx context.Context, resourceType, namespace string) {
+	record(ctx, futureCompletionTimeCount.M(1),
+		tag.Insert(namespaceTag, namespace),
+		resourceTypeTag(resourceType),
+	)
+}
+
+// RecordReconcileQueueLatency records the time taken to act on a completed resource
+func RecordReconcileQueueLatency(ctx context.Context, resourceType, namespace string, latency time.Duration) {
+	record(ctx, reconcileQueueLatency.M(latency.Seconds()),
+		tag.Insert(namespaceTag, namespace),
+		resourceTypeTag(resourceType),
+	)
+}
+
+// RecordDetectionLatency records the time taken to observe a resource as completed, since its completion
+// a high latency indicates a lag on the informer events
+func RecordDetectionLatency(ctx context.Context, resourceType, namespace string, latency time.Duration) {
+	record(ctx, detectionLatency.M(latency.Seconds()),
+		tag.Insert(namespaceTag, namespace),
+		resourceTypeTag(resourceType),
+	)
+}
+
+// RecordNamespaceFiltered records a policy skipped on a namespace
+func RecordNamespaceFiltered(ctx context.Context, namespace, policy, reason string) {
+	record(ctx, namespaceFilteredCount.M(1),
+		tag.Insert(namespaceTag, namespace),
+		tag.Insert(policyTag, policy),
+		tag.Insert(reasonTag, reason),
+	)
+}
+
+// RecordEffectivePolicyPresent records if the pruner config has an effective policy
+func RecordEffectivePolicyPresent(ctx context.Context, present bool) {
+	value := int64(0)
+	if present {
+		value = 1
+	}
+	record(ctx, effectivePolicyPresent.M(value))
+}
+
+// RecordPaused records if the pruning is paused
+func RecordPaused(ctx context.Context, isPaused bool) {
+	value := int64(0)
+	if isPaused {
+		value = 1
+	}
+	record(ctx, paused.M(value))
+}
+
+// RecordDeletePermission records if the pruner has permission to delete the resources in the namespace
+func RecordDeletePermission(ctx context.Context, namespace, resourceType string, granted bool) {
+	value := int64(0)
+	if granted {
+		value = 1
+	}
+	record(ctx, deletePermissionGranted.M(value),
+		tag.Insert(namespaceTag, namespace),
+		resourceTypeTag(resourceType),
+	)
+}
+
+// RecordStuckRuns records the number of the stuck runs in a namespace
+func RecordStuckRuns(ctx context.Context, resourceType, namespace string, count int64) {
+	record(ctx, stuckRuns.M(count),
+		tag.Insert(namespaceTag, namespace),
+		resourceTypeTag(resourceType),
+	)
+}
+
+// RecordUpdateConflict records a conflict on updating a resource
+func RecordUpdateConflict(ctx context.Context, resourceType, namespace string) {
+	record(ctx, updateConflictCount.M(1),
+		tag.Insert(namespaceTag, namespace),
+		resourceTypeTag(resourceType),
+	)
+}
+
+// RecordHistoryReevaluation records a processed resource evaluated again by the history limiter, with the trigger as reason
+func RecordHistoryReevaluation(ctx context.Context, resourceType, namespace, reason string) {
+	record(ctx, historyReevaluationCount.M(1),
+		tag.Insert(namespaceTag, namespace),
+		resourceTypeTag(resourceType),
+		tag.Insert(reasonTag, reason),
+	)
+}
+
+// RecordHistoryOverage records the number of resources over the history limit, when the history is trimmed
+func RecordHistoryOverage(ctx context.Context, resourceType, namespace string, overage int) {
+	record(ctx, historyOverage.M(int64(overage)),
+		tag.Insert(namespaceTag, namespace),
+		resourceTypeTag(resourceType),
+	)
+}
+
+// RecordConfigUnknownField records an unknown field found on loading the global config
+func RecordConfigUnknownField(ctx context.Context) {
+	record(ctx, configUnknownFieldsCount.M(1))
+}
+
+// RecordDeletionFractionCap records a sweep capped by the maximum deletion fraction of the namespace
+func RecordDeletionFractionCap(ctx context.Context, resourceType, namespace string) {
+	record(ctx, deletionFractionCapCount.M(1),
+		tag.Insert(namespaceTag, namespace),
+		resourceTypeTag(resourceType),
+	)
+}
+
+// RecordActiveDeleteWorkers records the number of the workers deleting the resources
+func RecordActiveDeleteWorkers(ctx context.Context, resourceType string, count int64) {
+	record(ctx, activeDeleteWorkers.M(count),
+		resourceTypeTag(resourceType),
+	)
+}
+
+// canonical values of the resource tag
+const (
+	resourceTypePipelineRun = "pipelinerun"
+	resourceTypeTaskRun     = "taskrun"
+	resourceTypeCustomRun   = "customrun"
+	resourceTypeUnknown     = "unknown"
+)
+
+// all the resource tag values go through a single mapping, dashboards see the same values across the metrics
+func normalizeResourceType(resourceType string) string {
+	switch strings.ToLower(resourceType) {
+	case "pipelinerun", "pipelineruns":
+		return resourceTypePipelineRun
+	case "taskrun", "taskruns":
+		return resourceTypeTaskRun
+	case "customrun", "customruns":
+		return resourceTypeCustomRun
+	}
+	return resourceTypeUnknown
+}
+
+func resourceTypeTag(resourceType string) tag.Mutator {
+	return tag.Insert(resourceTag, normalizeResourceType(resourceType))
+}
+
+func record(ctx context.Context, measurement stats.Measurement, mutators ...tag.Mutator) {
+	ctx, err := tag.New(ctx, mutators...)
+	if err != nil {
+		return
+	}
+	metrics.Record(ctx, measurement)
+}
@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	"go.uber.org/zap"
+)
+
+// default prefix of the metric names written into the textfile
+const DefaultTextfileMetricPrefix = "tektoncd_pruner_"
+
+var (
+	// prefix should be a valid prometheus metric name fragment
+	metricPrefixRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+	// escape sequences allowed on the text exposition format
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// TextfileWriter writes a snapshot of the pruner metrics periodically into a file,
+// in the format understood by the node_exporter textfile collector.
+// helps to collect the metrics out-of-band, when the pod can not be scraped directly
+type TextfileWriter struct {
+	path     string
+	interval time.Duration
+	prefix   string
+}
+
+// NewTextfileWriter returns a textfile writer
+// the metric names are built from the prefix and the name of the metric,
+// if the prefix is empty, uses the default prefix
+func NewTextfileWriter(path string, interval time.Duration, prefix string) (*TextfileWriter, error) {
+	if path == "" {
+		return nil, fmt.Errorf("textfile path can not be empty")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("textfile write interval should be a positive value, received:%s", interval)
+	}
+	if prefix == "" {
+		prefix = DefaultTextfileMetricPrefix
+	}
+	if !metricPrefixRegex.MatchString(prefix) {
+		return nil, fmt.Errorf("invalid metric prefix:%s, should match the regex:%s", prefix, metricPrefixRegex.String())
+	}
+	return &TextfileWriter{path: path, interval: interval, prefix: prefix}, nil
+}
+
+// Run writes the metrics on every interval, until the context is cancelled
+func (tw *TextfileWriter) Run(ctx context.Context, logger *zap.SugaredLogger) {
+	ticker := time.NewTicker(tw.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := tw.Write(); err != nil {
+			logger.Errorw("error on writing metrics into textfile", "path", tw.path, zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Write writes the current metrics snapshot into the textfile
+// the data is written into a temporary file and renamed,
+// so that the collector never reads a partially written file
+func (tw *TextfileWriter) Write() error {
+	buf := &bytes.Buffer{}
+	for _, v := range views {
+		rows, err := view.RetrieveData(v.Name)
+		if err != nil {
+			return err
+		}
+		writeView(buf, tw.prefix+v.Name, v, rows)
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(tw.path), filepath.Base(tw.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err = tmpFile.Write(buf.Bytes()); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err = tmpFile.Close(); err != nil {
+		return err
+	}
+	// the collector runs as a different user
+	if err = os.Chmod(tmpFile.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), tw.path)
+}
+
+// writes a view in the prometheus text exposition format
+func writeView(buf *bytes.Buffer, name string, v *view.View, rows []*view.Row) {
+	metricType := "untyped"
+	switch v.Aggregation.Type {
+	case view.AggTypeCount, view.AggTypeSum:
+		metricType = "counter"
+	case view.AggTypeLastValue:
+		metricType = "gauge"
+	case view.AggTypeDistribution:
+		metricType = "histogram"
+	}
+
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, escapeHelp(v.Description))
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, metricType)
+
+	// keep the output stable across writes, order the rows by the labels
+	sort.SliceStable(rows, func(i, j int) bool {
+		return fmt.Sprint(rows[i].Tags) < fmt.Sprint(rows[j].Tags)
+	})
+
+	lines := []string{}
+	for _, row := range rows {
+		labels := make([]string, 0, len(row.Tags))
+		for _, t := range row.Tags {
+			labels = append(labels, fmt.Sprintf(`%s="%s"`, t.Key.Name(), labelValueReplacer.Replace(t.Value)))
+		}
+
+		switch data := row.Data.(type) {
+		case *view.CountData:
+			lines = append(lines, sample(name, labels, float64(data.Value)))
+
+		case *view.SumData:
+			lines = append(lines, sample(name, labels, data.Value))
+
+		case *view.LastValueData:
+			lines = append(lines, sample(name, labels, data.Value))
+
+		case *view.DistributionData:
+			cumulative := int64(0)
+			for index, bound := range v.Aggregation.Buckets {
+				cumulative += data.CountPerBucket[index]
+				bucketLabels := append(append([]string{}, labels...), fmt.Sprintf("le=%q", formatFloat(bound)))
+				lines = append(lines, sample(name+"_bucket", bucketLabels, float64(cumulative)))
+			}
+			bucketLabels := append(append([]string{}, labels...), `le="+Inf"`)
+			lines = append(lines, sample(name+"_bucket", bucketLabels, float64(data.Count)))
+			lines = append(lines, sample(name+"_sum", labels, data.Sum()))
+			lines = append(lines, sample(name+"_count", labels, float64(data.Count)))
+		}
+	}
+
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+}
+
+func sample(name string, labels []string, value float64) string {
+	if len(labels) == 0 {
+		return fmt.Sprintf("%s %s", name, formatFloat(value))
+	}
+	return fmt.Sprintf("%s{%s} %s", name, strings.Join(labels, ","), formatFloat(value))
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	return helpReplacer.Replace(help)
+}
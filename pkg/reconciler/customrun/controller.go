@@ -0,0 +1,147 @@
+package customrun
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/helper"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	pipelineclient "github.com/tektoncd/pipeline/pkg/client/injection/client"
+	customruninformer "github.com/tektoncd/pipeline/pkg/client/injection/informers/pipeline/v1beta1/customrun"
+	customrunreconciler "github.com/tektoncd/pipeline/pkg/client/injection/reconciler/pipeline/v1beta1/customrun"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
+	kubeclient "knative.dev/pkg/client/injection/kube/client"
+	namespaceinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/namespace"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/kmeta"
+	"knative.dev/pkg/logging"
+)
+
+// NewController creates a Reconciler and returns the result of NewImpl.
+func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl {
+	customRunInformer := customruninformer.Get(ctx)
+
+	logger := logging.FromContext(ctx)
+
+	// the history limiter can list the resources from the api server cache
+	listResourceVersion, err := helper.GetHistoryLimitListResourceVersion()
+	if err != nil {
+		logger.Fatalw("error on getting history limit list resource version",
+			"environmentKey", helper.EnvHistoryLimitListFromCache, "environmentValue", os.Getenv(helper.EnvHistoryLimitListFromCache),
+			zap.Error(err),
+		)
+	}
+
+	customRunFuncs := &CustomRunFuncs{
+		client:              pipelineclient.Get(ctx),
+		listResourceVersion: listResourceVersion,
+		customRunLister:     customRunInformer.Lister(),
+	}
+	ttlHandler, err := helper.NewTTLHandler(clock.RealClock{}, customRunFuncs)
+	if err != nil {
+		logger.Fatal("error on getting ttl handler", zap.Error(err))
+	}
+
+	historyLimiter, err := helper.NewHistoryLimiter(clock.RealClock{}, customRunFuncs)
+	if err != nil {
+		logger.Fatal("error on getting history limiter", zap.Error(err))
+	}
+
+	r := &Reconciler{
+		kubeclient:      kubeclient.Get(ctx),
+		ttlHandler:      ttlHandler,
+		historyLimiter:  historyLimiter,
+		namespaceLister: namespaceinformer.Get(ctx).Lister(),
+		customRunFuncs:  customRunFuncs,
+	}
+
+	// number of works to process the events
+	concurrentWorkers, err := helper.GetEnvValueAsInt(helper.EnvTTLConcurrentWorkersCustomRun, helper.DefaultTTLConcurrentWorkersCustomRun)
+	if err != nil {
+		logger.Fatalw("error on getting CustomRun ttl concurrent workers count",
+			"environmentKey", helper.EnvTTLConcurrentWorkersCustomRun, "environmentValue", os.Getenv(helper.EnvTTLConcurrentWorkersCustomRun),
+			zap.Error(err),
+		)
+	}
+
+	ctrlOptions := controller.Options{
+		Concurrency: concurrentWorkers,
+	}
+
+	impl := customrunreconciler.NewImpl(ctx, r, func(impl *controller.Impl) controller.Options { return ctrlOptions })
+
+	// Listen for events on the main resource and enqueue themselves.
+	// events of the CustomRuns which are not yet completed are dropped here
+	customRunInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: filterCompletedCustomRun(ctx, customRunFuncs, func(obj interface{}, after time.Duration) {
+			if cr, ok := obj.(metav1.Object); ok && isStandaloneCustomRun(cr) {
+				impl.EnqueueAfter(obj, after)
+			}
+		}),
+		Handler: controller.HandleAll(filterCustomRun(logger, impl)),
+	})
+
+	// the deleted CustomRuns are not tracked anymore
+	customRunInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: helper.ForgetOnDelete(helper.KindCustomRun),
+	})
+	return impl
+}
+
+// filters the customrun which is in completed state
+// a CustomRun never completed gets no events once idle, enqueued at the time it exceeds the max keep duration
+func filterCompletedCustomRun(ctx context.Context, customRunFuncs *CustomRunFuncs, enqueueAfter func(obj interface{}, after time.Duration)) func(obj interface{}) bool {
+	return func(obj interface{}) bool {
+		cr, ok := obj.(*pipelinev1beta1.CustomRun)
+		if !ok {
+			return false
+		}
+		// a CustomRun never completed is enqueued, once it exceeds the max keep duration
+		if !customRunFuncs.IsCompleted(cr) && !helper.ExceedsMaxKeepDuration(cr) {
+			if left, found := helper.MaxKeepDurationLeft(cr); found {
+				enqueueAfter(cr, left)
+			}
+			return false
+		}
+		// used to measure the time since the completion and the time till the reconciler acts on it
+		helper.QueueLatencyTracker.MarkEligible(ctx, helper.KindCustomRun, cr, customRunFuncs.GetCompletionTime)
+		return true
+	}
+}
+
+// filters the customrun which has a parent
+func filterCustomRun(logger *zap.SugaredLogger, impl *controller.Impl) func(obj interface{}) {
+	return func(obj interface{}) {
+		customRun, err := kmeta.DeletionHandlingAccessor(obj)
+		if err != nil {
+			logger.Errorw("error on getting object as Accessor", zap.Error(err))
+			return
+		}
+
+		if !isStandaloneCustomRun(customRun) {
+			return
+		}
+
+		impl.EnqueueKey(types.NamespacedName{Namespace: customRun.GetNamespace(), Name: customRun.GetName()})
+	}
+}
+
+// returns true if the CustomRun is not part of a PipelineRun
+func isStandaloneCustomRun(customRun metav1.Object) bool {
+	if customRun.GetLabels() != nil && customRun.GetLabels()[helper.LabelPipelineRunName] != "" {
+		return false
+	}
+
+	for _, ownerReference := range customRun.GetOwnerReferences() {
+		if ownerReference.Kind == helper.KindPipelineRun {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,380 @@
+package customrun
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+
+	tektonprunerv1alpha1 "github.com/openshift-pipelines/tektoncd-pruner/pkg/apis/tektonpruner/v1alpha1"
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/helper"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	pipelineversioned "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	customrunreconciler "github.com/tektoncd/pipeline/pkg/client/injection/reconciler/pipeline/v1beta1/customrun"
+	pipelinev1beta1listers "github.com/tektoncd/pipeline/pkg/client/listers/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"knative.dev/pkg/apis"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/reconciler"
+)
+
+// Reconciler implements customrunreconciler.Interface for
+// CustomRun resources.
+type Reconciler struct {
+	kubeclient     kubernetes.Interface
+	ttlHandler     *helper.TTLHandler
+	historyLimiter *helper.HistoryLimiter
+	customRunFuncs *CustomRunFuncs
+	// used to check the namespace annotations
+	namespaceLister corelisters.NamespaceLister
+}
+
+// Check that our Reconciler implements Interface
+var _ customrunreconciler.Interface = (*Reconciler)(nil)
+
+// ReconcileKind implements Interface.ReconcileKind.
+func (r *Reconciler) ReconcileKind(ctx context.Context, cr *pipelinev1beta1.CustomRun) reconciler.Event {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("received a CustomRun event",
+		"namespace", cr.Namespace, "name", cr.Name,
+	)
+
+	// time taken to act on a CustomRun, since its completion observed
+	helper.QueueLatencyTracker.Observe(ctx, helper.KindCustomRun, cr)
+
+	// a CustomRun of a PipelineRun is handled by its parent resource(PipelineRun)
+	if !isStandaloneCustomRun(cr) {
+		return nil
+	}
+
+	// a CustomRun which is not completed can not be pruned, unless it exceeds the max keep duration,
+	// no need to go through the ttl handler and the history limiter
+	if !r.customRunFuncs.IsCompleted(cr) && !helper.ExceedsMaxKeepDuration(cr) {
+		// evaluated again, once it exceeds the max keep duration
+		if left, found := helper.MaxKeepDurationLeft(cr); found {
+			return controller.NewRequeueAfter(left)
+		}
+		return nil
+	}
+
+	// the pruning is paused, the completed CustomRun is evaluated again after the interval, resumed once unpaused
+	if helper.PrunerConfigStore.IsPaused() {
+		logger.Debugw("pruning is paused, skipping the CustomRun",
+			"namespace", cr.Namespace, "name", cr.Name,
+		)
+		return controller.NewRequeueAfter(helper.DefaultPausedRequeueInterval)
+	}
+
+	var err error
+	// the failed reconciles are used to compute the error ratio
+	defer func() {
+		isRequeueKey, _ := controller.IsRequeueKey(err)
+		metrics.RecordReconcileResult(ctx, helper.KindCustomRun, err != nil && !isRequeueKey)
+		if err != nil && !isRequeueKey {
+			metrics.RecordReconcileError(ctx, helper.KindCustomRun, err)
+		} else {
+			metrics.RecordLastReconcile(ctx, cr.Namespace, time.Now())
+		}
+	}()
+
+	// the namespace selector is evaluated on the cached namespace, evaluated again once the namespace is in the cache
+	if err = helper.NamespaceNotCachedRequeue(r.namespaceLister, cr.Namespace); err != nil {
+		return err
+	}
+
+	// execute the history limiter earlier than the ttl handler
+
+	// execute history limit action
+	// the namespace owner can disable the policies with the namespace annotation
+	if !helper.IsPolicyDisabledOnNamespace(ctx, r.namespaceLister, cr.Namespace, helper.PrunerPolicyHistoryLimit) {
+		err = r.historyLimiter.ProcessEvent(ctx, cr)
+	}
+	if err != nil {
+		isRequeueKey, _ := controller.IsRequeueKey(err)
+		// the error is not a requeue error, print the error
+		if !isRequeueKey {
+			logger.Errorw("error on processing history limiting for a CustomRun",
+				"namespace", cr.Namespace, "name", cr.Name,
+				zap.Error(err),
+			)
+		}
+		return err
+	}
+
+	// execute ttl handler
+	if !helper.IsPolicyDisabledOnNamespace(ctx, r.namespaceLister, cr.Namespace, helper.PrunerPolicyTTL) {
+		err = r.ttlHandler.ProcessEvent(ctx, cr)
+	}
+	if err != nil {
+		isRequeueKey, _ := controller.IsRequeueKey(err)
+		// the error is not a requeue error, print the error
+		if !isRequeueKey {
+			data, _ := json.Marshal(cr)
+			logger.Errorw("error on processing ttl for a CustomRun",
+				"namespace", cr.Namespace, "name", cr.Name,
+				"resource", string(data),
+				zap.Error(err),
+			)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// CustomRunFuncs implements the resource functions of the ttl handler and the history limiter for the CustomRuns
+// the CustomRuns are configured with the Task config, the custom task name is taken from the task label
+type CustomRunFuncs struct {
+	client pipelineversioned.Interface
+	// resource version of the list calls, "0" allows the api server cached reads
+	listResourceVersion string
+	// used to count the CustomRuns of a namespace, without an api call
+	customRunLister pipelinev1beta1listers.CustomRunLister
+}
+
+func (crf *CustomRunFuncs) Type() string {
+	return helper.KindCustomRun
+}
+
+func (crf *CustomRunFuncs) List(ctx context.Context, namespace, labelSelector string) ([]metav1.Object, string, error) {
+	options := metav1.ListOptions{LabelSelector: labelSelector, ResourceVersion: crf.listResourceVersion}
+	return helper.ListAll(ctx, options, func(ctx context.Context, options metav1.ListOptions) ([]metav1.Object, metav1.ListMeta, error) {
+		crsList, err := crf.client.TektonV1beta1().CustomRuns(namespace).List(ctx, options)
+		if err != nil {
+			return nil, metav1.ListMeta{}, err
+		}
+		crs := make([]metav1.Object, 0, len(crsList.Items))
+		for index := range crsList.Items {
+			crs = append(crs, &crsList.Items[index])
+		}
+		return crs, crsList.ListMeta, nil
+	})
+}
+
+// resource k8s operations
+
+func (crf *CustomRunFuncs) ListFromCache(namespace, label string) ([]metav1.Object, error) {
+	selector, err := labels.Parse(label)
+	if err != nil {
+		return nil, err
+	}
+	crs, err := crf.customRunLister.CustomRuns(namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]metav1.Object, 0, len(crs))
+	for _, cr := range crs {
+		resources = append(resources, cr)
+	}
+	return resources, nil
+}
+
+func (crf *CustomRunFuncs) Get(ctx context.Context, namespace, name string) (metav1.Object, error) {
+	return crf.client.TektonV1beta1().CustomRuns(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (crf *CustomRunFuncs) Delete(ctx context.Context, namespace, name string) error {
+	return crf.client.TektonV1beta1().CustomRuns(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+}
+
+func (crf *CustomRunFuncs) DeleteUnchanged(ctx context.Context, resource metav1.Object) error {
+	deleteOptions := metav1.DeleteOptions{Preconditions: helper.UnchangedPreconditions(resource)}
+	return crf.client.TektonV1beta1().CustomRuns(resource.GetNamespace()).Delete(ctx, resource.GetName(), deleteOptions)
+}
+
+func (crf *CustomRunFuncs) DeleteCollection(ctx context.Context, namespace, labelSelector, resourceVersion string) error {
+	listOptions := metav1.ListOptions{
+		LabelSelector:        labelSelector,
+		ResourceVersion:      resourceVersion,
+		ResourceVersionMatch: metav1.ResourceVersionMatchExact,
+	}
+	return crf.client.TektonV1beta1().CustomRuns(namespace).DeleteCollection(ctx, metav1.DeleteOptions{}, listOptions)
+}
+
+func (crf *CustomRunFuncs) Update(ctx context.Context, resource metav1.Object) error {
+	cr, ok := resource.(*pipelinev1beta1.CustomRun)
+	if !ok {
+		return fmt.Errorf("invalid type received. Namespace:%s, Name:%s", resource.GetNamespace(), resource.GetName())
+	}
+	_, err := crf.client.TektonV1beta1().CustomRuns(resource.GetNamespace()).Update(ctx, cr, metav1.UpdateOptions{})
+	return err
+}
+
+func (crf *CustomRunFuncs) GetCompletionTime(resource metav1.Object) (metav1.Time, error) {
+	cr, ok := resource.(*pipelinev1beta1.CustomRun)
+	if !ok {
+		return metav1.Time{}, fmt.Errorf("resource type error, this is not a CustomRun resource. namespace:%s, name:%s, type:%T",
+			resource.GetNamespace(), resource.GetName(), resource)
+	}
+	return helper.GetCompletionTime(crf.Type(), cr, cr.Status.CompletionTime, cr.Status.GetCondition(apis.ConditionSucceeded))
+}
+
+func (crf *CustomRunFuncs) GetStartTime(resource metav1.Object) (metav1.Time, error) {
+	cr, ok := resource.(*pipelinev1beta1.CustomRun)
+	if !ok {
+		return metav1.Time{}, fmt.Errorf("resource type error, this is not a CustomRun resource. namespace:%s, name:%s, type:%T",
+			resource.GetNamespace(), resource.GetName(), resource)
+	}
+	if cr.Status.StartTime == nil {
+		return metav1.Time{}, fmt.Errorf("unable to find the start time of the resource: %s/%s", resource.GetNamespace(), resource.GetName())
+	}
+	return *cr.Status.StartTime, nil
+}
+
+// IsDefinitionDeleted always returns false,
+// the custom task definitions are owned by the custom task controllers, not tracked by the pruner
+func (crf *CustomRunFuncs) IsDefinitionDeleted(resource metav1.Object) bool {
+	return false
+}
+
+func (crf *CustomRunFuncs) Ignore(resource metav1.Object) bool {
+	// labels and annotations are not populated, lets wait sometime
+	if resource.GetLabels() == nil {
+		if resource.GetAnnotations() == nil || resource.GetAnnotations()[helper.AnnotationTTLSecondsAfterFinished] == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (crf *CustomRunFuncs) IsCompleted(resource metav1.Object) bool {
+	cr, ok := resource.(*pipelinev1beta1.CustomRun)
+	if !ok {
+		return false
+	}
+
+	if cr.Status.StartTime == nil {
+		return false
+	}
+
+	if cr.Status.CompletionTime != nil {
+		return true
+	}
+
+	// check the status from conditions
+	condition := cr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil || condition.Status == corev1.ConditionUnknown {
+		return false
+	}
+
+	return true
+}
+
+func (crf *CustomRunFuncs) IsSuccessful(resource metav1.Object) bool {
+	cr, ok := resource.(*pipelinev1beta1.CustomRun)
+	if !ok {
+		return false
+	}
+
+	// the custom task controllers are free to use their own reasons, the status is enough
+	condition := cr.Status.GetCondition(apis.ConditionSucceeded)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// IsFailed returns true for all the finished CustomRuns not succeeded,
+// includes the failed, timed out and cancelled CustomRuns
+func (crf *CustomRunFuncs) IsFailed(resource metav1.Object) bool {
+	cr, ok := resource.(*pipelinev1beta1.CustomRun)
+	if !ok {
+		return false
+	}
+
+	condition := cr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil {
+		// no condition on a completed CustomRun, treated as failed
+		return cr.Status.CompletionTime != nil
+	}
+	if condition.Status == corev1.ConditionUnknown {
+		return false
+	}
+
+	return !crf.IsSuccessful(resource)
+}
+
+// IsCancelled returns true, when the CustomRun is finished by a cancellation
+func (crf *CustomRunFuncs) IsCancelled(resource metav1.Object) bool {
+	cr, ok := resource.(*pipelinev1beta1.CustomRun)
+	if !ok {
+		return false
+	}
+
+	condition := cr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil || condition.Status != corev1.ConditionFalse {
+		return false
+	}
+
+	return pipelinev1beta1.CustomRunReason(condition.Reason) == pipelinev1beta1.CustomRunReasonCancelled
+}
+
+// IsTimedOut returns true, when the CustomRun is finished by a timeout
+func (crf *CustomRunFuncs) IsTimedOut(resource metav1.Object) bool {
+	cr, ok := resource.(*pipelinev1beta1.CustomRun)
+	if !ok {
+		return false
+	}
+
+	condition := cr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil || condition.Status != corev1.ConditionFalse {
+		return false
+	}
+
+	return pipelinev1beta1.CustomRunReason(condition.Reason) == pipelinev1beta1.CustomRunReasonTimedOut
+}
+
+// GetReason returns the reason of the Succeeded condition, empty if not available
+func (crf *CustomRunFuncs) GetReason(resource metav1.Object) string {
+	cr, ok := resource.(*pipelinev1beta1.CustomRun)
+	if !ok {
+		return ""
+	}
+
+	condition := cr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil {
+		return ""
+	}
+	return condition.Reason
+}
+
+func (crf *CustomRunFuncs) GetDefaultLabelKey() string {
+	return helper.LabelTaskName
+}
+
+func (crf *CustomRunFuncs) GetTTLSecondsAfterFinished(namespace, name string) *int32 {
+	return helper.PrunerConfigStore.GetTaskTTLSecondsAfterFinished(namespace, name)
+}
+
+func (crf *CustomRunFuncs) GetCancelledTTLSecondsAfterFinished(namespace, name string) *int32 {
+	return helper.PrunerConfigStore.GetTaskCancelledTTLSecondsAfterFinished(namespace, name)
+}
+
+func (crf *CustomRunFuncs) GetTTLFrom(namespace, name string) tektonprunerv1alpha1.TTLFrom {
+	return helper.PrunerConfigStore.GetTaskTTLFrom(namespace, name)
+}
+
+func (crf *CustomRunFuncs) GetSuccessHistoryLimitCount(namespace, name string) *int32 {
+	return helper.PrunerConfigStore.GetTaskSuccessHistoryLimitCount(namespace, name)
+}
+
+func (crf *CustomRunFuncs) GetFailedHistoryLimitCount(namespace, name string) *int32 {
+	return helper.PrunerConfigStore.GetTaskFailedHistoryLimitCount(namespace, name)
+}
+
+func (crf *CustomRunFuncs) GetCancelledHistoryLimitCount(namespace, name string) *int32 {
+	return helper.PrunerConfigStore.GetTaskCancelledHistoryLimitCount(namespace, name)
+}
+
+func (crf *CustomRunFuncs) GetGroupByLabelKeys(namespace, name string) []string {
+	return helper.PrunerConfigStore.GetTaskGroupBy(namespace, name)
+}
+
+func (crf *CustomRunFuncs) GetEnforcedConfigLevel(namespace, name string) tektonprunerv1alpha1.EnforcedConfigLevel {
+	return helper.PrunerConfigStore.GetTaskEnforcedConfigLevel(namespace, name)
+}
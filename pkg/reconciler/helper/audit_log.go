@@ -0,0 +1,44 @@
+package helper
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// name of the audit logger, distinguishes the audit trail from the controller logs
+const auditLoggerName = "tekton-pruner-audit"
+
+// writes the audit records as JSON lines to stdout, independent of the controller log level
+var getAuditLogger = sync.OnceValue(func() *zap.Logger {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "timestamp"
+	encoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	encoderConfig.EncodeDuration = zapcore.StringDurationEncoder
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), zapcore.Lock(os.Stdout), zapcore.InfoLevel)
+	return zap.New(core).Named(auditLoggerName)
+})
+
+// records a successful deletion on the audit log, if the audit is enabled
+// resolvedTTL is nil, when the deletion is not driven by the ttl
+func auditDeletion(resourceType string, resource metav1.Object, reason string, resolvedTTL *time.Duration) {
+	if !PrunerConfigStore.IsAuditEnabled() {
+		return
+	}
+
+	fields := []zap.Field{
+		zap.String("namespace", resource.GetNamespace()),
+		zap.String("name", resource.GetName()),
+		zap.String("kind", resourceType),
+		zap.String("reason", reason),
+		zap.Duration("age", time.Since(resource.GetCreationTimestamp().Time)),
+	}
+	if resolvedTTL != nil {
+		fields = append(fields, zap.Duration("resolvedTTL", *resolvedTTL))
+	}
+	getAuditLogger().Info("resource deleted", fields...)
+}
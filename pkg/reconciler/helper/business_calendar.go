@@ -0,0 +1,87 @@
+package helper
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// calendar used to compute the ttl in business days
+type businessCalendar struct {
+	location    *time.Location
+	weekendDays map[time.Weekday]bool
+	holidays    map[string]bool
+}
+
+// format of the holiday dates
+const businessCalendarDateFormat = "2006-01-02"
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// builds a calendar from the spec, Saturday and Sunday are the weekend days, if not defined
+func newBusinessCalendar(spec *BusinessCalendarSpec) (*businessCalendar, error) {
+	calendar := &businessCalendar{
+		location:    time.UTC,
+		weekendDays: map[time.Weekday]bool{time.Saturday: true, time.Sunday: true},
+		holidays:    map[string]bool{},
+	}
+	if spec == nil {
+		return calendar, nil
+	}
+
+	if spec.TimeZone != "" {
+		location, err := time.LoadLocation(spec.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid business calendar timeZone:%s, %w", spec.TimeZone, err)
+		}
+		calendar.location = location
+	}
+
+	if spec.WeekendDays != nil {
+		calendar.weekendDays = map[time.Weekday]bool{}
+		for _, day := range spec.WeekendDays {
+			weekday, found := weekdays[strings.ToLower(day)]
+			if !found {
+				return nil, fmt.Errorf("invalid business calendar weekend day:%s", day)
+			}
+			calendar.weekendDays[weekday] = true
+		}
+		if len(calendar.weekendDays) == len(weekdays) {
+			return nil, fmt.Errorf("invalid business calendar, all the days are weekend days")
+		}
+	}
+
+	for _, holiday := range spec.Holidays {
+		if _, err := time.Parse(businessCalendarDateFormat, holiday); err != nil {
+			return nil, fmt.Errorf("invalid business calendar holiday:%s, expected format:%s", holiday, businessCalendarDateFormat)
+		}
+		calendar.holidays[holiday] = true
+	}
+	return calendar, nil
+}
+
+func (bc *businessCalendar) isBusinessDay(t time.Time) bool {
+	t = t.In(bc.location)
+	return !bc.weekendDays[t.Weekday()] && !bc.holidays[t.Format(businessCalendarDateFormat)]
+}
+
+// adds the business days to the given time, the non-business days are skipped
+// the time of the day is retained, moves to the end of the following business days
+func (bc *businessCalendar) addBusinessDays(from time.Time, days int) time.Time {
+	t := from.In(bc.location)
+	for days > 0 {
+		t = t.AddDate(0, 0, 1)
+		if bc.isBusinessDay(t) {
+			days--
+		}
+	}
+	return t
+}
@@ -0,0 +1,55 @@
+package helper
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestAddBusinessDaysSkipsWeekend(t *testing.T) {
+	calendar, err := newBusinessCalendar(&BusinessCalendarSpec{Holidays: []string{"2026-10-19"}})
+	if err != nil {
+		t.Fatalf("error on getting business calendar: %v", err)
+	}
+	// Friday
+	from := time.Date(2026, 10, 16, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		days     int
+		expected time.Time
+	}{
+		{name: "zero days", days: 0, expected: from},
+		{name: "skips the weekend and the holiday", days: 1, expected: time.Date(2026, 10, 20, 10, 30, 0, 0, time.UTC)},
+		{name: "next week", days: 5, expected: time.Date(2026, 10, 26, 10, 30, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := calendar.addBusinessDays(from, test.days); !got.Equal(test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestInvalidBusinessCalendarRejectedOnLoad(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{name: "time zone", config: "businessCalendar:\n  timeZone: Mars/Olympus"},
+		{name: "weekend day", config: "businessCalendar:\n  weekendDays: [Caturday]"},
+		{name: "all the days", config: "businessCalendar:\n  weekendDays: [Sunday, Monday, Tuesday, Wednesday, Thursday, Friday, Saturday]"},
+		{name: "holiday", config: "businessCalendar:\n  holidays: [10/19/2026]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewPrunerConfigFromConfigMap(&corev1.ConfigMap{Data: map[string]string{PrunerGlobalConfigKey: test.config}})
+			configErr := &ConfigLoadError{}
+			if !errors.As(err, &configErr) {
+				t.Fatalf("expected a config load error, got: %v", err)
+			}
+		})
+	}
+}
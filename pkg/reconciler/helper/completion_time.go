@@ -0,0 +1,64 @@
+package helper
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+)
+
+// source of the completion time of a resource
+type CompletionTimeSource string
+
+const (
+	// status.completionTime, falls back to the lastTransitionTime of the Succeeded condition
+	CompletionTimeSourceCompletionTime CompletionTimeSource = "completionTime"
+	// lastTransitionTime of the Succeeded condition, falls back to status.completionTime
+	CompletionTimeSourceCondition CompletionTimeSource = "condition"
+	// always the lastTransitionTime of the Succeeded condition, status.completionTime is ignored
+	CompletionTimeSourceConditionOnly CompletionTimeSource = "conditionOnly"
+)
+
+// GetCompletionTime returns the completion time of a resource, with the configured source precedence of the resource type
+// condition is the Succeeded condition of the resource
+func GetCompletionTime(resourceType string, resource metav1.Object, completionTime *metav1.Time, condition *apis.Condition) (metav1.Time, error) {
+	// the resource is finished, when the condition is not in unknown state
+	finished := condition != nil && condition.Status != corev1.ConditionUnknown
+
+	getConditionTime := func() (metav1.Time, error) {
+		if condition.LastTransitionTime.Inner.IsZero() {
+			return metav1.Time{}, fmt.Errorf("unable to find the time when the resource '%s/%s' finished", resource.GetNamespace(), resource.GetName())
+		}
+		return condition.LastTransitionTime.Inner, nil
+	}
+
+	switch PrunerConfigStore.GetCompletionTimeSource(resourceType) {
+	case CompletionTimeSourceCondition:
+		if finished && !condition.LastTransitionTime.Inner.IsZero() {
+			return condition.LastTransitionTime.Inner, nil
+		}
+		if completionTime != nil {
+			return *completionTime, nil
+		}
+		if finished {
+			return getConditionTime()
+		}
+
+	case CompletionTimeSourceConditionOnly:
+		if finished {
+			return getConditionTime()
+		}
+
+	default:
+		if completionTime != nil {
+			return *completionTime, nil
+		}
+		if finished {
+			return getConditionTime()
+		}
+	}
+
+	// This should never happen if the Resource has finished
+	return metav1.Time{}, fmt.Errorf("unable to find the status of the finished resource: %s/%s", resource.GetNamespace(), resource.GetName())
+}
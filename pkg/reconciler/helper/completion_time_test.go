@@ -0,0 +1,104 @@
+package helper
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+)
+
+func TestCompletionTimeSource(t *testing.T) {
+	// the completion time and the condition time diverge
+	statusTime := metav1.NewTime(time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC))
+	conditionTime := metav1.NewTime(statusTime.Add(30 * time.Second))
+	succeeded := &apis.Condition{
+		Type:               apis.ConditionSucceeded,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: apis.VolatileTime{Inner: conditionTime},
+	}
+	resource := &metav1.ObjectMeta{Namespace: "ns-1", Name: "run-1"}
+
+	tests := []struct {
+		name           string
+		config         string
+		completionTime *metav1.Time
+		condition      *apis.Condition
+		expected       metav1.Time
+		expectedErr    bool
+	}{
+		{
+			name:           "default prefers the completion time",
+			completionTime: &statusTime,
+			condition:      succeeded,
+			expected:       statusTime,
+		},
+		{
+			name:           "completionTime prefers the completion time",
+			config:         "completionTimeSource: {pipelineRun: completionTime}",
+			completionTime: &statusTime,
+			condition:      succeeded,
+			expected:       statusTime,
+		},
+		{
+			name:      "completionTime falls back to the condition",
+			config:    "completionTimeSource: {pipelineRun: completionTime}",
+			condition: succeeded,
+			expected:  conditionTime,
+		},
+		{
+			name:           "condition prefers the condition time",
+			config:         "completionTimeSource: {pipelineRun: condition}",
+			completionTime: &statusTime,
+			condition:      succeeded,
+			expected:       conditionTime,
+		},
+		{
+			name:           "condition falls back to the completion time",
+			config:         "completionTimeSource: {pipelineRun: condition}",
+			completionTime: &statusTime,
+			expected:       statusTime,
+		},
+		{
+			name:           "conditionOnly ignores the completion time",
+			config:         "completionTimeSource: {pipelineRun: conditionOnly}",
+			completionTime: &statusTime,
+			condition:      succeeded,
+			expected:       conditionTime,
+		},
+		{
+			name:           "conditionOnly without the condition is an error",
+			config:         "completionTimeSource: {pipelineRun: conditionOnly}",
+			completionTime: &statusTime,
+			expectedErr:    true,
+		},
+		{
+			name:           "source of another resource type is not applied",
+			config:         "completionTimeSource: {taskRun: conditionOnly}",
+			completionTime: &statusTime,
+			condition:      succeeded,
+			expected:       statusTime,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loadTestGlobalConfig(t, test.config)
+
+			got, err := GetCompletionTime(KindPipelineRun, resource, test.completionTime, test.condition)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected an error, got the completion time %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(&test.expected) {
+				t.Errorf("expected the completion time %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package helper
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// number of lines to include before and after the offending line
+const configErrorSnippetContext = 2
+
+// the yaml library reports the syntax errors with the line number
+var yamlErrorLineRegex = regexp.MustCompile(`line (\d+)`)
+
+// ConfigLoadError is returned when the ConfigMap data can not be loaded
+// includes the key of the ConfigMap and the offending line, if known
+type ConfigLoadError struct {
+	Key string
+	// line number, starts from 1, zero if not known
+	Line int
+	// lines around the offending line, prefixed with the line numbers
+	Snippet string
+	Err     error
+}
+
+func newConfigLoadError(key, data string, err error) *ConfigLoadError {
+	configErr := &ConfigLoadError{Key: key, Err: err}
+	matches := yamlErrorLineRegex.FindStringSubmatch(err.Error())
+	if len(matches) == 2 {
+		line, convErr := strconv.Atoi(matches[1])
+		if convErr == nil {
+			configErr.Line = line
+			configErr.Snippet = getSnippet(data, line)
+		}
+	}
+	return configErr
+}
+
+func (ce *ConfigLoadError) Error() string {
+	if ce.Line > 0 {
+		return fmt.Sprintf("error on loading config key '%s', line %d: %v", ce.Key, ce.Line, ce.Err)
+	}
+	return fmt.Sprintf("error on loading config key '%s': %v", ce.Key, ce.Err)
+}
+
+func (ce *ConfigLoadError) Unwrap() error {
+	return ce.Err
+}
+
+// returns the lines around the given line, the offending line is marked with '>'
+func getSnippet(data string, line int) string {
+	lines := strings.Split(data, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	start := max(line-configErrorSnippetContext, 1)
+	end := min(line+configErrorSnippetContext, len(lines))
+	snippet := []string{}
+	for index := start; index <= end; index++ {
+		marker := " "
+		if index == line {
+			marker = ">"
+		}
+		snippet = append(snippet, fmt.Sprintf("%s%4d | %s", marker, index, lines[index-1]))
+	}
+	return strings.Join(snippet, "\n")
+}
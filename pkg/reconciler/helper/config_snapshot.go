@@ -0,0 +1,112 @@
+package helper
+
+import (
+	"sort"
+
+	tektonprunerv1alpha1 "github.com/openshift-pipelines/tektoncd-pruner/pkg/apis/tektonpruner/v1alpha1"
+)
+
+// ConfigSnapshot is a point in time copy of the loaded config, with the resolved values
+type ConfigSnapshot struct {
+	GlobalConfig     PrunerConfig                  `json:"globalConfig"`
+	NamespacedConfig map[string]PrunerResourceSpec `json:"namespacedConfig"`
+	// namespace -> resolved values
+	Effective map[string]EffectiveNamespaceConfig `json:"effective"`
+}
+
+// resolved values of a namespace, the resources without a name are resolved from the namespace and the global config
+type EffectiveNamespaceConfig struct {
+	PipelineRun EffectiveConfig            `json:"pipelineRun"`
+	TaskRun     EffectiveConfig            `json:"taskRun"`
+	Pipelines   map[string]EffectiveConfig `json:"pipelines,omitempty"`
+	Tasks       map[string]EffectiveConfig `json:"tasks,omitempty"`
+}
+
+// resolved values of a resource, as applied by the ttl handler and the history limiter
+type EffectiveConfig struct {
+	EnforcedConfigLevel     tektonprunerv1alpha1.EnforcedConfigLevel `json:"enforcedConfigLevel"`
+	TTLSecondsAfterFinished *int32                                   `json:"ttlSecondsAfterFinished"`
+	SuccessfulHistoryLimit  *int32                                   `json:"successfulHistoryLimit"`
+	FailedHistoryLimit      *int32                                   `json:"failedHistoryLimit"`
+}
+
+// GetSnapshot returns a copy of the loaded config, with the resolved values of the namespaces and the resources defined on the config
+func (ps *prunerConfigStore) GetSnapshot() ConfigSnapshot {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	snapshot := ConfigSnapshot{
+		GlobalConfig:     ps.globalConfig,
+		NamespacedConfig: map[string]PrunerResourceSpec{},
+		Effective:        map[string]EffectiveNamespaceConfig{},
+	}
+	for namespace, spec := range ps.namespacedConfig {
+		snapshot.NamespacedConfig[namespace] = spec
+	}
+
+	namespaces := map[string]bool{}
+	for _, namespacedSpecs := range []map[string]PrunerResourceSpec{ps.globalConfig.Namespaces, ps.namespacedConfig} {
+		for namespace := range namespacedSpecs {
+			namespaces[namespace] = true
+		}
+	}
+	for namespace := range namespaces {
+		effective := EffectiveNamespaceConfig{
+			PipelineRun: ps.getEffectiveConfig(namespace, "", PrunerResourceTypePipeline),
+			TaskRun:     ps.getEffectiveConfig(namespace, "", PrunerResourceTypeTask),
+			Pipelines:   map[string]EffectiveConfig{},
+			Tasks:       map[string]EffectiveConfig{},
+		}
+		for _, name := range ps.getResourceNames(namespace, PrunerResourceTypePipeline) {
+			effective.Pipelines[name] = ps.getEffectiveConfig(namespace, name, PrunerResourceTypePipeline)
+		}
+		for _, name := range ps.getResourceNames(namespace, PrunerResourceTypeTask) {
+			effective.Tasks[name] = ps.getEffectiveConfig(namespace, name, PrunerResourceTypeTask)
+		}
+		snapshot.Effective[namespace] = effective
+	}
+	return snapshot
+}
+
+// ResolveEffectiveSpec resolves the values of a resource from the given global config and the specs of the TektonPruner resources,
+// the same way as the ttl handler and the history limiter do, without a loaded config store
+// an empty name resolves the values of the resources without a name label on the namespace
+func ResolveEffectiveSpec(globalConfig PrunerConfig, namespacedConfig map[string]PrunerResourceSpec, namespace, name string, resourceType PrunerResourceType) EffectiveConfig {
+	ps := &prunerConfigStore{globalConfig: globalConfig, namespacedConfig: namespacedConfig}
+	return ps.getEffectiveConfig(namespace, name, resourceType)
+}
+
+// resolves the values of a resource, the caller has to hold the lock
+func (ps *prunerConfigStore) getEffectiveConfig(namespace, name string, resourceType PrunerResourceType) EffectiveConfig {
+	enforcedConfigLevel := ps.getEnforcedConfigLevel(namespace, name, resourceType)
+	return EffectiveConfig{
+		EnforcedConfigLevel:     enforcedConfigLevel,
+		TTLSecondsAfterFinished: getResourceFieldData(ps.namespacedConfig, ps.globalConfig, namespace, name, resourceType, PrunerFieldTypeTTLSecondsAfterFinished, enforcedConfigLevel),
+		SuccessfulHistoryLimit:  getResourceFieldData(ps.namespacedConfig, ps.globalConfig, namespace, name, resourceType, PrunerFieldTypeSuccessfulHistoryLimit, enforcedConfigLevel),
+		FailedHistoryLimit:      getResourceFieldData(ps.namespacedConfig, ps.globalConfig, namespace, name, resourceType, PrunerFieldTypeFailedHistoryLimit, enforcedConfigLevel),
+	}
+}
+
+// returns the names of the Pipelines or the Tasks defined on the namespace, sorted
+func (ps *prunerConfigStore) getResourceNames(namespace string, resourceType PrunerResourceType) []string {
+	names := map[string]bool{}
+	for _, namespacedSpecs := range []map[string]PrunerResourceSpec{ps.globalConfig.Namespaces, ps.namespacedConfig} {
+		spec, found := namespacedSpecs[namespace]
+		if !found {
+			continue
+		}
+		resourceSpecs := spec.Pipelines
+		if resourceType == PrunerResourceTypeTask {
+			resourceSpecs = spec.Tasks
+		}
+		for _, resourceSpec := range resourceSpecs {
+			names[resourceSpec.Name] = true
+		}
+	}
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+	return sortedNames
+}
@@ -1,11 +1,22 @@
 package helper
 
 import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	tektonprunerv1alpha1 "github.com/openshift-pipelines/tektoncd-pruner/pkg/apis/tektonpruner/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/util/retry"
 )
 
 // for internal use
@@ -13,6 +24,12 @@ import (
 type PrunerResourceType string
 type PrunerFieldType string
 
+// action on the child TaskRuns, when a PipelineRun is pruned
+type PipelineRunChildHandling string
+
+// action on the PipelineRuns created by another PipelineRun
+type NestedPipelineRunHandling string
+
 const (
 	PrunerResourceTypePipeline PrunerResourceType = "pipeline"
 	PrunerResourceTypeTask     PrunerResourceType = "task"
@@ -20,30 +37,199 @@ const (
 	PrunerFieldTypeTTLSecondsAfterFinished PrunerFieldType = "ttlSecondsAfterFinished"
 	PrunerFieldTypeSuccessfulHistoryLimit  PrunerFieldType = "successfulHistoryLimit"
 	PrunerFieldTypeFailedHistoryLimit      PrunerFieldType = "failedHistoryLimit"
+	// the cancelled runs are counted as failed and take the ttl, if not defined
+	PrunerFieldTypeCancelledHistoryLimit            PrunerFieldType = "cancelledHistoryLimit"
+	PrunerFieldTypeCancelledTTLSecondsAfterFinished PrunerFieldType = "cancelledTTLSecondsAfterFinished"
+
+	// no explicit action on the child TaskRuns,
+	// the TaskRuns owned by the PipelineRun are still removed by the kubernetes garbage collector
+	PipelineRunChildHandlingLeave PipelineRunChildHandling = "leave"
+	// deletes the TaskRuns listed in the PipelineRun status.childReferences along with the PipelineRun
+	PipelineRunChildHandlingCascade PipelineRunChildHandling = "cascade"
+
+	// the nested PipelineRuns are pruned on their own, as any other PipelineRun
+	NestedPipelineRunHandlingIndependent NestedPipelineRunHandling = "independent"
+	// the nested PipelineRuns are pruned only along with the parent PipelineRun, or when the parent no longer exists
+	NestedPipelineRunHandlingParent NestedPipelineRunHandling = "parent"
 )
 
 // used to hold the config of a specific namespace
 type PrunerResourceSpec struct {
 	// EnforcedConfigLevel allowed values: global, namespace, resource (default: resource)
-	EnforcedConfigLevel     *tektonprunerv1alpha1.EnforcedConfigLevel `yaml:"enforcedConfigLevel"`
-	TTLSecondsAfterFinished *int32                                    `yaml:"ttlSecondsAfterFinished"`
-	SuccessfulHistoryLimit  *int32                                    `yaml:"successfulHistoryLimit"`
-	FailedHistoryLimit      *int32                                    `yaml:"failedHistoryLimit"`
-	HistoryLimit            *int32                                    `yaml:"historyLimit"`
-	Pipelines               []tektonprunerv1alpha1.ResourceSpec       `yaml:"pipelines"`
-	Tasks                   []tektonprunerv1alpha1.ResourceSpec       `yaml:"tasks"`
+	EnforcedConfigLevel     *tektonprunerv1alpha1.EnforcedConfigLevel `yaml:"enforcedConfigLevel" json:"enforcedConfigLevel,omitempty"`
+	TTLSecondsAfterFinished *int32                                    `yaml:"ttlSecondsAfterFinished" json:"ttlSecondsAfterFinished,omitempty"`
+	SuccessfulHistoryLimit  *int32                                    `yaml:"successfulHistoryLimit" json:"successfulHistoryLimit,omitempty"`
+	FailedHistoryLimit      *int32                                    `yaml:"failedHistoryLimit" json:"failedHistoryLimit,omitempty"`
+	HistoryLimit            *int32                                    `yaml:"historyLimit" json:"historyLimit,omitempty"`
+	Pipelines               []tektonprunerv1alpha1.ResourceSpec       `yaml:"pipelines" json:"pipelines,omitempty"`
+	Tasks                   []tektonprunerv1alpha1.ResourceSpec       `yaml:"tasks" json:"tasks,omitempty"`
+	// CancelledHistoryLimit of the cancelled runs in the namespace, the cancelled runs are counted as failed, if not defined
+	CancelledHistoryLimit *int32 `yaml:"cancelledHistoryLimit" json:"cancelledHistoryLimit,omitempty"`
+	// CancelledTTLSecondsAfterFinished of the cancelled runs in the namespace, takes precedence over the ttl of the namespace
+	CancelledTTLSecondsAfterFinished *int32 `yaml:"cancelledTTLSecondsAfterFinished" json:"cancelledTTLSecondsAfterFinished,omitempty"`
+	// DefaultPipelineRunTTL in seconds, takes precedence over ttlSecondsAfterFinished of the namespace for the PipelineRuns
+	DefaultPipelineRunTTL *int32 `yaml:"defaultPipelineRunTTL" json:"defaultPipelineRunTTL,omitempty"`
+	// DefaultTaskRunTTL in seconds, takes precedence over ttlSecondsAfterFinished of the namespace for the TaskRuns
+	DefaultTaskRunTTL *int32 `yaml:"defaultTaskRunTTL" json:"defaultTaskRunTTL,omitempty"`
+	// DryRun reports the resources to be deleted in the namespace, without deleting them (default: false)
+	DryRun *bool `yaml:"dryRun" json:"dryRun,omitempty"`
+	// MaxKeepDuration of the resources in the namespace, takes precedence over the global max keep duration
+	MaxKeepDuration *metav1.Duration `yaml:"maxKeepDuration" json:"maxKeepDuration,omitempty"`
+	// DeleteConcurrency of the resources in the namespace, takes precedence over the global delete concurrency
+	DeleteConcurrency *int32 `yaml:"deleteConcurrency" json:"deleteConcurrency,omitempty"`
+	// ResourceSelector prunes only the resources matching the label selector in the namespace (default: all the resources)
+	// example: "app=ci"
+	ResourceSelector string `yaml:"resourceSelector" json:"resourceSelector,omitempty"`
+	// TTLFrom of the resources in the namespace, allowed values: completion, start (default: completion)
+	TTLFrom tektonprunerv1alpha1.TTLFrom `yaml:"ttlFrom" json:"ttlFrom,omitempty"`
+	// MaxTotalRuns of the completed resources in the namespace per resource type, across all the pipelines or tasks
+	// the oldest completed resources are deleted first, applied after the history limits (default: no limit)
+	MaxTotalRuns *int32 `yaml:"maxTotalRuns" json:"maxTotalRuns,omitempty"`
 }
 
 // used to hold the config of namespaces
 // and global config
 type PrunerConfig struct {
 	// EnforcedConfigLevel allowed values: global, namespace, resource (default: resource)
-	EnforcedConfigLevel     *tektonprunerv1alpha1.EnforcedConfigLevel `yaml:"enforcedConfigLevel"`
-	TTLSecondsAfterFinished *int32                                    `yaml:"ttlSecondsAfterFinished"`
-	SuccessfulHistoryLimit  *int32                                    `yaml:"successfulHistoryLimit"`
-	FailedHistoryLimit      *int32                                    `yaml:"failedHistoryLimit"`
-	HistoryLimit            *int32                                    `yaml:"historyLimit"`
-	Namespaces              map[string]PrunerResourceSpec             `yaml:"namespaces"`
+	EnforcedConfigLevel     *tektonprunerv1alpha1.EnforcedConfigLevel `yaml:"enforcedConfigLevel" json:"enforcedConfigLevel,omitempty"`
+	TTLSecondsAfterFinished *int32                                    `yaml:"ttlSecondsAfterFinished" json:"ttlSecondsAfterFinished,omitempty"`
+	SuccessfulHistoryLimit  *int32                                    `yaml:"successfulHistoryLimit" json:"successfulHistoryLimit,omitempty"`
+	FailedHistoryLimit      *int32                                    `yaml:"failedHistoryLimit" json:"failedHistoryLimit,omitempty"`
+	HistoryLimit            *int32                                    `yaml:"historyLimit" json:"historyLimit,omitempty"`
+	Namespaces              map[string]PrunerResourceSpec             `yaml:"namespaces" json:"namespaces,omitempty"`
+	// CancelledHistoryLimit of the cancelled runs, the cancelled runs are counted as failed, if not defined
+	CancelledHistoryLimit *int32 `yaml:"cancelledHistoryLimit" json:"cancelledHistoryLimit,omitempty"`
+	// CancelledTTLSecondsAfterFinished of the cancelled runs, takes precedence over the root ttl for the cancelled runs
+	CancelledTTLSecondsAfterFinished *int32 `yaml:"cancelledTTLSecondsAfterFinished" json:"cancelledTTLSecondsAfterFinished,omitempty"`
+	// DefaultPipelineRunTTL in seconds, takes precedence over the root ttlSecondsAfterFinished for the PipelineRuns
+	DefaultPipelineRunTTL *int32 `yaml:"defaultPipelineRunTTL" json:"defaultPipelineRunTTL,omitempty"`
+	// DefaultTaskRunTTL in seconds, takes precedence over the root ttlSecondsAfterFinished for the TaskRuns
+	DefaultTaskRunTTL *int32 `yaml:"defaultTaskRunTTL" json:"defaultTaskRunTTL,omitempty"`
+	// LegalHold protects the matching resources from the deletion, takes precedence over all the policies
+	LegalHold *LegalHoldSpec `yaml:"legalHold" json:"legalHold,omitempty"`
+	// HistoryLimitCheckProcessedMaxAgeSeconds re-evaluates the history limit of a resource,
+	// if it is processed before the given seconds (default: never re-evaluated)
+	HistoryLimitCheckProcessedMaxAgeSeconds *int32 `yaml:"historyLimitCheckProcessedMaxAgeSeconds" json:"historyLimitCheckProcessedMaxAgeSeconds,omitempty"`
+	// HistoryLimitCompletionGraceSeconds waits the given seconds after the completion,
+	// before a resource is counted toward the history limits (default: 0, counted immediately)
+	HistoryLimitCompletionGraceSeconds *int32 `yaml:"historyLimitCompletionGraceSeconds" json:"historyLimitCompletionGraceSeconds,omitempty"`
+	// HistoryLimitHysteresis deletes the history only when it exceeds the limit by more than the given count,
+	// then trims it down to the limit in one batch (default: 0, trimmed on every resource over the limit)
+	HistoryLimitHysteresis *int32 `yaml:"historyLimitHysteresis" json:"historyLimitHysteresis,omitempty"`
+	// PipelineRunChildHandling allowed values: leave, cascade (default: leave)
+	PipelineRunChildHandling *PipelineRunChildHandling `yaml:"pipelineRunChildHandling" json:"pipelineRunChildHandling,omitempty"`
+	// NestedPipelineRunHandling allowed values: independent, parent (default: independent)
+	NestedPipelineRunHandling *NestedPipelineRunHandling `yaml:"nestedPipelineRunHandling" json:"nestedPipelineRunHandling,omitempty"`
+	// PruneOrphanedTaskRuns prunes the TaskRuns with a PipelineRun owner reference, when the owner no longer exists (default: false)
+	PruneOrphanedTaskRuns *bool `yaml:"pruneOrphanedTaskRuns" json:"pruneOrphanedTaskRuns,omitempty"`
+	// CollapseRetries counts a run and its retries as one toward the history limits (default: false)
+	CollapseRetries *bool `yaml:"collapseRetries" json:"collapseRetries,omitempty"`
+	// Paused stops all the pruning, no resource is evaluated or deleted till it is unset (default: false)
+	Paused *bool `yaml:"paused" json:"paused,omitempty"`
+	// CompletionTimeSource defines the source of the completion time, per resource type
+	CompletionTimeSource *CompletionTimeSourceSpec `yaml:"completionTimeSource" json:"completionTimeSource,omitempty"`
+	// BusinessCalendar defines the non-business days, used by the ttl in business days
+	BusinessCalendar *BusinessCalendarSpec `yaml:"businessCalendar" json:"businessCalendar,omitempty"`
+	// StuckRunMaxAgeSeconds reports the runs not completed after the given seconds from the creation (default: disabled)
+	StuckRunMaxAgeSeconds *int32 `yaml:"stuckRunMaxAgeSeconds" json:"stuckRunMaxAgeSeconds,omitempty"`
+	// StuckRunForceDelete deletes the stuck runs (default: false)
+	StuckRunForceDelete *bool `yaml:"stuckRunForceDelete" json:"stuckRunForceDelete,omitempty"`
+	// TTLRequeuePrecisionMilliseconds rounds up the requeue duration of a resource waiting for the ttl,
+	// to a multiple of the given milliseconds (default: 1000)
+	TTLRequeuePrecisionMilliseconds *int32 `yaml:"ttlRequeuePrecisionMilliseconds" json:"ttlRequeuePrecisionMilliseconds,omitempty"`
+	// MissingCondition defines the action on the completed resources without the Succeeded condition
+	MissingCondition *MissingConditionSpec `yaml:"missingCondition" json:"missingCondition,omitempty"`
+	// RequireAnnotationBeforePrune prunes a resource only when it has the annotation, set by an external system
+	RequireAnnotationBeforePrune *RequireAnnotationSpec `yaml:"requireAnnotationBeforePrune" json:"requireAnnotationBeforePrune,omitempty"`
+	// PruneRunsWithDeletedDefinition prunes the runs earlier, when the referenced Pipeline or Task is deleted
+	PruneRunsWithDeletedDefinition *DeletedDefinitionSpec `yaml:"pruneRunsWithDeletedDefinition" json:"pruneRunsWithDeletedDefinition,omitempty"`
+	// IncludeNamespaces prunes only the namespaces matching any of the patterns (default: all the namespaces)
+	// supports the "*" glob, example: "ci-*"
+	IncludeNamespaces []string `yaml:"includeNamespaces" json:"includeNamespaces,omitempty"`
+	// ExcludeNamespaces never prunes the namespaces matching any of the patterns, takes precedence over IncludeNamespaces
+	ExcludeNamespaces []string `yaml:"excludeNamespaces" json:"excludeNamespaces,omitempty"`
+	// ForceIncludeNamespaces prunes the namespaces with the exact names, even if they are filtered out
+	// by IncludeNamespaces or ExcludeNamespaces
+	ForceIncludeNamespaces []string `yaml:"forceIncludeNamespaces" json:"forceIncludeNamespaces,omitempty"`
+	// NamespaceSelector prunes only the namespaces matching the label selector (default: all the namespaces)
+	// example: "pruner.tekton.dev/enabled=true"
+	NamespaceSelector string `yaml:"namespaceSelector" json:"namespaceSelector,omitempty"`
+	// DryRun reports the resources to be deleted, without deleting them (default: false)
+	DryRun *bool `yaml:"dryRun" json:"dryRun,omitempty"`
+	// StrictConfig rejects the config with the unknown fields, the previous config stays in effect
+	// (default: false, the unknown fields are ignored)
+	StrictConfig *bool `yaml:"strictConfig" json:"strictConfig,omitempty"`
+	// MaxKeepDuration deletes the resources older than the duration after the completion, regardless of the ttl,
+	// example: "720h" (default: disabled)
+	MaxKeepDuration *metav1.Duration `yaml:"maxKeepDuration" json:"maxKeepDuration,omitempty"`
+	// EventPropagatedLabels copies the labels of a deleted resource to the annotations of the emitted event,
+	// limited to the first 10 label keys
+	EventPropagatedLabels []string `yaml:"eventPropagatedLabels" json:"eventPropagatedLabels,omitempty"`
+	// DeleteConcurrency is the number of parallel deletions on trimming the history of a namespace,
+	// limited to 20 (default: 1, deletes one by one)
+	DeleteConcurrency *int32 `yaml:"deleteConcurrency" json:"deleteConcurrency,omitempty"`
+	// AuditEnabled writes a JSON line to stdout for every deleted resource, on the "tekton-pruner-audit" logger (default: false)
+	AuditEnabled *bool `yaml:"auditEnabled" json:"auditEnabled,omitempty"`
+	// PerResourceLogSampleRate logs one in the given number of the per-resource deletion and skip lines,
+	// the error lines are not sampled (default: 1, all the lines are logged)
+	PerResourceLogSampleRate *int32 `yaml:"perResourceLogSampleRate" json:"perResourceLogSampleRate,omitempty"`
+	// AnnotationUpdateRetries is the number of retries of an annotation update on a conflict,
+	// the resource is fetched again before every retry (default: 4, 0 never retries)
+	AnnotationUpdateRetries *int32 `yaml:"annotationUpdateRetries" json:"annotationUpdateRetries,omitempty"`
+	// MaxDeletionFractionPerNamespace limits the deletion within an hour to the fraction of the completed runs
+	// of the resource type in the namespace, the rest are deferred, example: 0.9 (default: disabled)
+	MaxDeletionFractionPerNamespace *float64 `yaml:"maxDeletionFractionPerNamespace" json:"maxDeletionFractionPerNamespace,omitempty"`
+}
+
+// action on the completed resources without the Succeeded condition
+type MissingConditionSpec struct {
+	// Policy allowed values: failed, skip, maxAge (default: failed)
+	Policy MissingConditionPolicy `yaml:"policy" json:"policy,omitempty"`
+	// MaxAgeSeconds after the completion, used by the maxAge policy
+	MaxAgeSeconds *int32 `yaml:"maxAgeSeconds" json:"maxAgeSeconds,omitempty"`
+}
+
+// non-business days of the calendar
+type BusinessCalendarSpec struct {
+	// time zone of the calendar (default: UTC)
+	TimeZone string `yaml:"timeZone" json:"timeZone,omitempty"`
+	// example: Saturday, Sunday (default: Saturday, Sunday)
+	WeekendDays []string `yaml:"weekendDays" json:"weekendDays,omitempty"`
+	// dates in YYYY-MM-DD format
+	Holidays []string `yaml:"holidays" json:"holidays,omitempty"`
+}
+
+// source of the completion time, per resource type
+// allowed values: completionTime, condition, conditionOnly (default: completionTime)
+type CompletionTimeSourceSpec struct {
+	PipelineRun CompletionTimeSource `yaml:"pipelineRun" json:"pipelineRun,omitempty"`
+	TaskRun     CompletionTimeSource `yaml:"taskRun" json:"taskRun,omitempty"`
+	CustomRun   CompletionTimeSource `yaml:"customRun" json:"customRun,omitempty"`
+}
+
+// used to identify the resources on legal hold
+// a resource is on hold, if it has a label or an annotation with the given key
+// if the value is not empty, the label or the annotation value should match with it
+type LegalHoldSpec struct {
+	Key   string `yaml:"key" json:"key,omitempty"`
+	Value string `yaml:"value" json:"value,omitempty"`
+}
+
+// used to identify the resources ready for the pruning, annotated by an external system, example: an archiver
+// a resource is prunable, if it has an annotation with the given key
+// if the value is not empty, the annotation value should match with it
+type RequireAnnotationSpec struct {
+	Key   string `yaml:"key" json:"key,omitempty"`
+	Value string `yaml:"value" json:"value,omitempty"`
+	// MaxWaitSeconds prunes the resource without the annotation, after the given seconds from the completion
+	// (default: waits forever)
+	MaxWaitSeconds *int32 `yaml:"maxWaitSeconds" json:"maxWaitSeconds,omitempty"`
+}
+
+// used to prune the runs of a deleted Pipeline or Task definition
+type DeletedDefinitionSpec struct {
+	// TTLSecondsAfterFinished of the runs, applied when it is shorter than the ttl of the run (0: pruned immediately)
+	TTLSecondsAfterFinished *int32 `yaml:"ttlSecondsAfterFinished" json:"ttlSecondsAfterFinished,omitempty"`
 }
 
 // defines the store structure
@@ -52,6 +238,12 @@ type prunerConfigStore struct {
 	mutex            sync.RWMutex
 	globalConfig     PrunerConfig
 	namespacedConfig map[string]PrunerResourceSpec
+	// fields of the global config not known by the pruner, ignored on loading
+	unknownFields []string
+	// parsed namespace selector of the global config
+	namespaceSelector labels.Selector
+	// parsed resource selectors of the namespaces in the global config
+	resourceSelectors map[string]labels.Selector
 }
 
 var (
@@ -66,15 +258,25 @@ func (ps *prunerConfigStore) LoadGlobalConfig(configMap *corev1.ConfigMap) error
 	ps.mutex.Lock()
 	defer ps.mutex.Unlock()
 
-	globalConfig := &PrunerConfig{}
-	if configMap.Data != nil && configMap.Data[PrunerGlobalConfigKey] != "" {
-		err := yaml.Unmarshal([]byte(configMap.Data[PrunerGlobalConfigKey]), globalConfig)
-		if err != nil {
-			return err
-		}
+	globalConfig, unknownFields, err := parseGlobalConfig(configMap)
+	if err != nil {
+		return err
 	}
 
+	// the selector is validated on parsing
+	namespaceSelector, _ := labels.Parse(globalConfig.NamespaceSelector)
+
 	ps.globalConfig = *globalConfig
+	ps.namespaceSelector = namespaceSelector
+	ps.resourceSelectors = map[string]labels.Selector{}
+	for namespace, spec := range globalConfig.Namespaces {
+		if spec.ResourceSelector == "" {
+			continue
+		}
+		// the selector is validated on parsing
+		ps.resourceSelectors[namespace], _ = labels.Parse(spec.ResourceSelector)
+	}
+	ps.unknownFields = unknownFields
 
 	if ps.globalConfig.Namespaces == nil {
 		ps.globalConfig.Namespaces = map[string]PrunerResourceSpec{}
@@ -87,6 +289,63 @@ func (ps *prunerConfigStore) LoadGlobalConfig(configMap *corev1.ConfigMap) error
 	return nil
 }
 
+// decodes and validates the global config of the ConfigMap, returns the unknown fields of the config
+// on the strict config, the unknown fields are rejected
+func parseGlobalConfig(configMap *corev1.ConfigMap) (*PrunerConfig, []string, error) {
+	globalConfig := &PrunerConfig{}
+	unknownFields := []string{}
+	if configMap.Data != nil && configMap.Data[PrunerGlobalConfigKey] != "" {
+		data := configMap.Data[PrunerGlobalConfigKey]
+		err := yaml.Unmarshal([]byte(data), globalConfig)
+		if err != nil {
+			return nil, nil, newConfigLoadError(PrunerGlobalConfigKey, data, err)
+		}
+		// the unknown fields are ignored, reported to catch the typos
+		unknownFields, err = findUnknownFields([]byte(data), globalConfig)
+		if err != nil {
+			return nil, nil, newConfigLoadError(PrunerGlobalConfigKey, data, err)
+		}
+		if len(unknownFields) > 0 && globalConfig.StrictConfig != nil && *globalConfig.StrictConfig {
+			return nil, nil, &ConfigLoadError{
+				Key: PrunerGlobalConfigKey,
+				Err: fmt.Errorf("unknown fields on strict config: %s", strings.Join(unknownFields, ", ")),
+			}
+		}
+	}
+
+	if err := validateGlobalConfig(globalConfig); err != nil {
+		return nil, nil, &ConfigLoadError{Key: PrunerGlobalConfigKey, Err: err}
+	}
+
+	for _, pattern := range append(slices.Clone(globalConfig.IncludeNamespaces), globalConfig.ExcludeNamespaces...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, nil, &ConfigLoadError{
+				Key: PrunerGlobalConfigKey,
+				Err: fmt.Errorf("invalid namespace pattern:%s, %w", pattern, err),
+			}
+		}
+	}
+
+	// the force included namespaces are the exact names, not the patterns
+	for _, namespace := range globalConfig.ForceIncludeNamespaces {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return nil, nil, &ConfigLoadError{
+				Key: PrunerGlobalConfigKey,
+				Err: fmt.Errorf("invalid forceIncludeNamespaces name:%s, %s", namespace, strings.Join(errs, ", ")),
+			}
+		}
+	}
+
+	if _, err := labels.Parse(globalConfig.NamespaceSelector); err != nil {
+		return nil, nil, &ConfigLoadError{
+			Key: PrunerGlobalConfigKey,
+			Err: fmt.Errorf("invalid namespaceSelector:%s, %w", globalConfig.NamespaceSelector, err),
+		}
+	}
+
+	return globalConfig, unknownFields, nil
+}
+
 func (ps *prunerConfigStore) UpdateNamespacedSpec(prunerCR *tektonprunerv1alpha1.TektonPruner) {
 	ps.mutex.Lock()
 	defer ps.mutex.Unlock()
@@ -95,19 +354,416 @@ func (ps *prunerConfigStore) UpdateNamespacedSpec(prunerCR *tektonprunerv1alpha1
 
 	// update in the local store
 	namespacedSpec := PrunerResourceSpec{
+		EnforcedConfigLevel:     prunerCR.Spec.EnforcedConfigLevel,
 		TTLSecondsAfterFinished: prunerCR.Spec.TTLSecondsAfterFinished,
+		SuccessfulHistoryLimit:  prunerCR.Spec.SuccessfulHistoryLimit,
+		FailedHistoryLimit:      prunerCR.Spec.FailedHistoryLimit,
+		HistoryLimit:            prunerCR.Spec.HistoryLimit,
 		Pipelines:               prunerCR.Spec.Pipelines,
 		Tasks:                   prunerCR.Spec.Tasks,
 	}
 	ps.namespacedConfig[namespace] = namespacedSpec
 }
 
+// returns the fields of the loaded global config, not known by the pruner
+func (ps *prunerConfigStore) GetUnknownFields() []string {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return append([]string{}, ps.unknownFields...)
+}
+
+// returns the legal hold spec, if not defined on global config, returns the default spec
+func (ps *prunerConfigStore) GetLegalHold() LegalHoldSpec {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	if ps.globalConfig.LegalHold != nil && ps.globalConfig.LegalHold.Key != "" {
+		return *ps.globalConfig.LegalHold
+	}
+	return LegalHoldSpec{Key: AnnotationLegalHold, Value: "true"}
+}
+
+// returns the annotation required before the pruning, nil if not defined
+func (ps *prunerConfigStore) GetRequireAnnotationBeforePrune() *RequireAnnotationSpec {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	if ps.globalConfig.RequireAnnotationBeforePrune == nil || ps.globalConfig.RequireAnnotationBeforePrune.Key == "" {
+		return nil
+	}
+	spec := *ps.globalConfig.RequireAnnotationBeforePrune
+	return &spec
+}
+
+// returns the ttl of the runs with a deleted definition, nil if not defined
+func (ps *prunerConfigStore) GetDeletedDefinitionTTL() *time.Duration {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	spec := ps.globalConfig.PruneRunsWithDeletedDefinition
+	if spec == nil || spec.TTLSecondsAfterFinished == nil || *spec.TTLSecondsAfterFinished < 0 {
+		return nil
+	}
+	ttl := time.Duration(*spec.TTLSecondsAfterFinished) * time.Second
+	return &ttl
+}
+
+// returns true, if the namespace is filtered out by the include and the exclude namespace patterns
+func (ps *prunerConfigStore) IsNamespaceExcluded(namespace string) bool {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	if slices.Contains(ps.globalConfig.ForceIncludeNamespaces, namespace) {
+		return false
+	}
+	if matchesAnyPattern(ps.globalConfig.ExcludeNamespaces, namespace) {
+		return true
+	}
+	return len(ps.globalConfig.IncludeNamespaces) > 0 && !matchesAnyPattern(ps.globalConfig.IncludeNamespaces, namespace)
+}
+
+// returns the namespace selector, nil if not defined
+func (ps *prunerConfigStore) GetNamespaceSelector() labels.Selector {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	if ps.namespaceSelector == nil || ps.namespaceSelector.Empty() {
+		return nil
+	}
+	return ps.namespaceSelector
+}
+
+// returns the resource selector of the namespace, nil if not defined
+func (ps *prunerConfigStore) GetResourceSelector(namespace string) labels.Selector {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	selector, found := ps.resourceSelectors[namespace]
+	if !found || selector.Empty() {
+		return nil
+	}
+	return selector
+}
+
+// returns true, if the dry run is enabled globally or on the namespace
+func (ps *prunerConfigStore) IsDryRunEnabled(namespace string) bool {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	if ps.globalConfig.DryRun != nil && *ps.globalConfig.DryRun {
+		return true
+	}
+	for _, namespacedSpecs := range []map[string]PrunerResourceSpec{ps.globalConfig.Namespaces, ps.namespacedConfig} {
+		if spec, found := namespacedSpecs[namespace]; found && spec.DryRun != nil && *spec.DryRun {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the maximum duration to keep a completed resource, the namespace config takes precedence over the global config
+func (ps *prunerConfigStore) GetMaxKeepDuration(namespace string) *time.Duration {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	maxKeepDuration := ps.globalConfig.MaxKeepDuration
+	if spec, found := ps.globalConfig.Namespaces[namespace]; found && spec.MaxKeepDuration != nil {
+		maxKeepDuration = spec.MaxKeepDuration
+	}
+	if spec, found := ps.namespacedConfig[namespace]; found && spec.MaxKeepDuration != nil {
+		maxKeepDuration = spec.MaxKeepDuration
+	}
+	if maxKeepDuration == nil || maxKeepDuration.Duration <= 0 {
+		return nil
+	}
+	duration := maxKeepDuration.Duration
+	return &duration
+}
+
+// returns the maximum number of the completed resources of a type in the namespace, nil if not limited
+func (ps *prunerConfigStore) GetMaxTotalRuns(namespace string) *int32 {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	var maxTotalRuns *int32
+	if spec, found := ps.globalConfig.Namespaces[namespace]; found && spec.MaxTotalRuns != nil {
+		maxTotalRuns = spec.MaxTotalRuns
+	}
+	if spec, found := ps.namespacedConfig[namespace]; found && spec.MaxTotalRuns != nil {
+		maxTotalRuns = spec.MaxTotalRuns
+	}
+	if maxTotalRuns == nil || *maxTotalRuns < 0 {
+		return nil
+	}
+	return maxTotalRuns
+}
+
+// returns the number of parallel deletions on trimming the history of a namespace
+func (ps *prunerConfigStore) GetDeleteConcurrency(namespace string) int {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	deleteConcurrency := ps.globalConfig.DeleteConcurrency
+	if spec, found := ps.globalConfig.Namespaces[namespace]; found && spec.DeleteConcurrency != nil {
+		deleteConcurrency = spec.DeleteConcurrency
+	}
+	if spec, found := ps.namespacedConfig[namespace]; found && spec.DeleteConcurrency != nil {
+		deleteConcurrency = spec.DeleteConcurrency
+	}
+	if deleteConcurrency == nil || *deleteConcurrency < 1 {
+		return DefaultDeleteConcurrency
+	}
+	if *deleteConcurrency > MaxDeleteConcurrency {
+		return MaxDeleteConcurrency
+	}
+	return int(*deleteConcurrency)
+}
+
+// returns the label keys to copy on the emitted events, bounded to keep the events small
+func (ps *prunerConfigStore) GetEventPropagatedLabels() []string {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	keys := ps.globalConfig.EventPropagatedLabels
+	if len(keys) > MaxEventPropagatedLabels {
+		keys = keys[:MaxEventPropagatedLabels]
+	}
+	return append([]string{}, keys...)
+}
+
+// the patterns are validated on loading the config
+func matchesAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the maximum age of the history limit check processed annotation
+// returns nil, if there is no maximum age defined
+func (ps *prunerConfigStore) GetHistoryLimitCheckProcessedMaxAge() *time.Duration {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	if ps.globalConfig.HistoryLimitCheckProcessedMaxAgeSeconds == nil || *ps.globalConfig.HistoryLimitCheckProcessedMaxAgeSeconds < 0 {
+		return nil
+	}
+	maxAge := time.Duration(*ps.globalConfig.HistoryLimitCheckProcessedMaxAgeSeconds) * time.Second
+	return &maxAge
+}
+
+// returns the duration to wait after the completion, before a resource is counted toward the history limits
+func (ps *prunerConfigStore) GetHistoryLimitCompletionGrace() time.Duration {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	if ps.globalConfig.HistoryLimitCompletionGraceSeconds == nil || *ps.globalConfig.HistoryLimitCompletionGraceSeconds < 0 {
+		return 0
+	}
+	return time.Duration(*ps.globalConfig.HistoryLimitCompletionGraceSeconds) * time.Second
+}
+
+// returns the number of resources allowed over the history limit, before the history is trimmed
+func (ps *prunerConfigStore) GetHistoryLimitHysteresis() int {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	if ps.globalConfig.HistoryLimitHysteresis == nil || *ps.globalConfig.HistoryLimitHysteresis < 0 {
+		return 0
+	}
+	return int(*ps.globalConfig.HistoryLimitHysteresis)
+}
+
+// returns the action on the child TaskRuns of a pruned PipelineRun
+func (ps *prunerConfigStore) GetPipelineRunChildHandling() PipelineRunChildHandling {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	if ps.globalConfig.PipelineRunChildHandling == nil || *ps.globalConfig.PipelineRunChildHandling == "" {
+		return PipelineRunChildHandlingLeave
+	}
+	return *ps.globalConfig.PipelineRunChildHandling
+}
+
+func (ps *prunerConfigStore) GetNestedPipelineRunHandling() NestedPipelineRunHandling {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	if ps.globalConfig.NestedPipelineRunHandling == nil || *ps.globalConfig.NestedPipelineRunHandling == "" {
+		return NestedPipelineRunHandlingIndependent
+	}
+	return *ps.globalConfig.NestedPipelineRunHandling
+}
+
+func (ps *prunerConfigStore) IsPruneOrphanedTaskRunsEnabled() bool {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.globalConfig.PruneOrphanedTaskRuns != nil && *ps.globalConfig.PruneOrphanedTaskRuns
+}
+
+// returns true, if the pruning is paused with the kill switch of the global config
+func (ps *prunerConfigStore) IsPaused() bool {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.globalConfig.Paused != nil && *ps.globalConfig.Paused
+}
+
+func (ps *prunerConfigStore) IsCollapseRetriesEnabled() bool {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.globalConfig.CollapseRetries != nil && *ps.globalConfig.CollapseRetries
+}
+
+// returns the source of the completion time of a resource type
+func (ps *prunerConfigStore) GetCompletionTimeSource(resourceType string) CompletionTimeSource {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	var source CompletionTimeSource
+	if ps.globalConfig.CompletionTimeSource != nil {
+		switch resourceType {
+		case KindPipelineRun:
+			source = ps.globalConfig.CompletionTimeSource.PipelineRun
+		case KindTaskRun:
+			source = ps.globalConfig.CompletionTimeSource.TaskRun
+		case KindCustomRun:
+			source = ps.globalConfig.CompletionTimeSource.CustomRun
+		}
+	}
+	if source == "" {
+		return CompletionTimeSourceCompletionTime
+	}
+	return source
+}
+
+// returns the namespaces defined in the global config
+func (ps *prunerConfigStore) GetGlobalConfigNamespaces() []string {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	namespaces := make([]string, 0, len(ps.globalConfig.Namespaces))
+	for namespace := range ps.globalConfig.Namespaces {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// returns the calendar to compute the ttl in business days
+func (ps *prunerConfigStore) GetBusinessCalendar() (*businessCalendar, error) {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return newBusinessCalendar(ps.globalConfig.BusinessCalendar)
+}
+
+// returns the maximum age of a run to be in the non completed state
+// returns nil, if the stuck run detection is disabled
+func (ps *prunerConfigStore) GetStuckRunMaxAge() *time.Duration {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	if ps.globalConfig.StuckRunMaxAgeSeconds == nil || *ps.globalConfig.StuckRunMaxAgeSeconds <= 0 {
+		return nil
+	}
+	maxAge := time.Duration(*ps.globalConfig.StuckRunMaxAgeSeconds) * time.Second
+	return &maxAge
+}
+
+// returns the action on the completed resources without the Succeeded condition, with the maximum age of the maxAge policy
+// the maxAge policy without a valid maximum age falls back to the failed policy
+func (ps *prunerConfigStore) GetMissingConditionPolicy() (MissingConditionPolicy, *time.Duration) {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	spec := ps.globalConfig.MissingCondition
+	if spec == nil || spec.Policy == "" {
+		return MissingConditionPolicyFailed, nil
+	}
+	if spec.Policy == MissingConditionPolicyMaxAge {
+		if spec.MaxAgeSeconds == nil || *spec.MaxAgeSeconds < 0 {
+			return MissingConditionPolicyFailed, nil
+		}
+		maxAge := time.Duration(*spec.MaxAgeSeconds) * time.Second
+		return spec.Policy, &maxAge
+	}
+	return spec.Policy, nil
+}
+
+func (ps *prunerConfigStore) IsStuckRunForceDeleteEnabled() bool {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.globalConfig.StuckRunForceDelete != nil && *ps.globalConfig.StuckRunForceDelete
+}
+
+func (ps *prunerConfigStore) IsAuditEnabled() bool {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.globalConfig.AuditEnabled != nil && *ps.globalConfig.AuditEnabled
+}
+
+// returns the sample rate of the per-resource log lines, 1 logs all the lines
+func (ps *prunerConfigStore) GetPerResourceLogSampleRate() int {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	if ps.globalConfig.PerResourceLogSampleRate == nil || *ps.globalConfig.PerResourceLogSampleRate < 1 {
+		return 1
+	}
+	return int(*ps.globalConfig.PerResourceLogSampleRate)
+}
+
+// returns the precision of the requeue duration of a resource waiting for the ttl
+func (ps *prunerConfigStore) GetTTLRequeuePrecision() time.Duration {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	if ps.globalConfig.TTLRequeuePrecisionMilliseconds == nil || *ps.globalConfig.TTLRequeuePrecisionMilliseconds <= 0 {
+		return DefaultTTLRequeuePrecision
+	}
+	return time.Duration(*ps.globalConfig.TTLRequeuePrecisionMilliseconds) * time.Millisecond
+}
+
+// returns the backoff of an annotation update retried on a conflict
+func (ps *prunerConfigStore) GetAnnotationUpdateBackoff() wait.Backoff {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	backoff := retry.DefaultRetry
+	backoff.Steps = DefaultAnnotationUpdateRetries + 1
+	if ps.globalConfig.AnnotationUpdateRetries != nil && *ps.globalConfig.AnnotationUpdateRetries >= 0 {
+		backoff.Steps = int(*ps.globalConfig.AnnotationUpdateRetries) + 1
+	}
+	return backoff
+}
+
+// returns the maximum fraction of the completed runs of a namespace deleted in a sweep, nil if not limited
+func (ps *prunerConfigStore) GetMaxDeletionFractionPerNamespace() *float64 {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.globalConfig.MaxDeletionFractionPerNamespace
+}
+
 func (ps *prunerConfigStore) DeleteNamespacedSpec(namespace string) {
 	ps.mutex.Lock()
 	defer ps.mutex.Unlock()
 	delete(ps.namespacedConfig, namespace)
 }
 
+// HasEffectivePolicy reports if any ttl or history limit is defined at any level
+// with no effective policy, nothing is pruned, unless the limits are set with the resource annotations
+func (ps *prunerConfigStore) HasEffectivePolicy() bool {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	if hasPolicy(ps.globalConfig.TTLSecondsAfterFinished, ps.globalConfig.SuccessfulHistoryLimit, ps.globalConfig.FailedHistoryLimit) {
+		return true
+	}
+	for _, namespacesSpec := range []map[string]PrunerResourceSpec{ps.globalConfig.Namespaces, ps.namespacedConfig} {
+		for _, spec := range namespacesSpec {
+			if hasPolicy(spec.TTLSecondsAfterFinished, spec.SuccessfulHistoryLimit, spec.FailedHistoryLimit) {
+				return true
+			}
+			for _, resourceSpecs := range [][]tektonprunerv1alpha1.ResourceSpec{spec.Pipelines, spec.Tasks} {
+				for _, resourceSpec := range resourceSpecs {
+					if hasPolicy(resourceSpec.TTLSecondsAfterFinished, resourceSpec.SuccessfulHistoryLimit, resourceSpec.FailedHistoryLimit) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// a negative value disables the policy
+func hasPolicy(values ...*int32) bool {
+	for _, value := range values {
+		if value != nil && *value >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func getFromPrunerConfigResourceLevel(namespacesSpec map[string]PrunerResourceSpec, namespace, name string, resourceType PrunerResourceType, fieldType PrunerFieldType) *int32 {
 	prunerResourceSpec, found := namespacesSpec[namespace]
 	if !found {
@@ -135,12 +791,101 @@ func getFromPrunerConfigResourceLevel(namespacesSpec map[string]PrunerResourceSp
 
 			case PrunerFieldTypeFailedHistoryLimit:
 				return resourceSpec.FailedHistoryLimit
+
+			case PrunerFieldTypeCancelledHistoryLimit:
+				return resourceSpec.CancelledHistoryLimit
+
+			case PrunerFieldTypeCancelledTTLSecondsAfterFinished:
+				return resourceSpec.CancelledTTLSecondsAfterFinished
 			}
 		}
 	}
 	return nil
 }
 
+// returns the group by label keys of a resource, defined only on the resource level
+func getResourceGroupBy(namespacedSpec map[string]PrunerResourceSpec, globalSpec PrunerConfig, namespace, name string, resourceType PrunerResourceType, enforcedConfigLevel tektonprunerv1alpha1.EnforcedConfigLevel) []string {
+	findGroupBy := func(namespacesSpec map[string]PrunerResourceSpec) []string {
+		prunerResourceSpec, found := namespacesSpec[namespace]
+		if !found {
+			return nil
+		}
+		resourceSpecs := prunerResourceSpec.Tasks
+		if resourceType == PrunerResourceTypePipeline {
+			resourceSpecs = prunerResourceSpec.Pipelines
+		}
+		for _, resourceSpec := range resourceSpecs {
+			if resourceSpec.Name == name {
+				return resourceSpec.GroupBy
+			}
+		}
+		return nil
+	}
+
+	var groupBy []string
+	// the namespaced spec is honored, only on the resource level
+	if enforcedConfigLevel == tektonprunerv1alpha1.EnforcedConfigLevelResource {
+		groupBy = findGroupBy(namespacedSpec)
+	}
+	if groupBy == nil {
+		groupBy = findGroupBy(globalSpec.Namespaces)
+	}
+	return append([]string{}, groupBy...)
+}
+
+// returns the reference time of the ttl, the resource level takes precedence over the namespace level
+func getResourceTTLFrom(namespacedSpec map[string]PrunerResourceSpec, globalSpec PrunerConfig, namespace, name string, resourceType PrunerResourceType, enforcedConfigLevel tektonprunerv1alpha1.EnforcedConfigLevel) tektonprunerv1alpha1.TTLFrom {
+	findTTLFrom := func(namespacesSpec map[string]PrunerResourceSpec, resourceLevel bool) tektonprunerv1alpha1.TTLFrom {
+		prunerResourceSpec, found := namespacesSpec[namespace]
+		if !found {
+			return ""
+		}
+		if resourceLevel {
+			resourceSpecs := prunerResourceSpec.Tasks
+			if resourceType == PrunerResourceTypePipeline {
+				resourceSpecs = prunerResourceSpec.Pipelines
+			}
+			for _, resourceSpec := range resourceSpecs {
+				if resourceSpec.Name == name && resourceSpec.TTLFrom != "" {
+					return resourceSpec.TTLFrom
+				}
+			}
+		}
+		return prunerResourceSpec.TTLFrom
+	}
+
+	var ttlFrom tektonprunerv1alpha1.TTLFrom
+	switch enforcedConfigLevel {
+	case tektonprunerv1alpha1.EnforcedConfigLevelResource:
+		ttlFrom = findTTLFrom(namespacedSpec, true)
+	case tektonprunerv1alpha1.EnforcedConfigLevelNamespace:
+		ttlFrom = findTTLFrom(namespacedSpec, false)
+	}
+	if ttlFrom == "" {
+		ttlFrom = findTTLFrom(globalSpec.Namespaces, true)
+	}
+	if ttlFrom == "" {
+		return tektonprunerv1alpha1.TTLFromCompletion
+	}
+	return ttlFrom
+}
+
+// returns the ttl of a root level, the default of the resource type takes precedence over the shared ttl
+// the runs of the Tasks (TaskRuns, CustomRuns) take the TaskRun default
+func getRootTTL(resourceType PrunerResourceType, defaultPipelineRunTTL, defaultTaskRunTTL, ttlSecondsAfterFinished *int32) *int32 {
+	switch resourceType {
+	case PrunerResourceTypePipeline:
+		if defaultPipelineRunTTL != nil {
+			return defaultPipelineRunTTL
+		}
+	case PrunerResourceTypeTask:
+		if defaultTaskRunTTL != nil {
+			return defaultTaskRunTTL
+		}
+	}
+	return ttlSecondsAfterFinished
+}
+
 func getResourceFieldData(namespacedSpec map[string]PrunerResourceSpec, globalSpec PrunerConfig, namespace, name string, resourceType PrunerResourceType, fieldType PrunerFieldType, enforcedConfigLevel tektonprunerv1alpha1.EnforcedConfigLevel) *int32 {
 	var ttl *int32
 
@@ -158,13 +903,19 @@ func getResourceFieldData(namespacedSpec map[string]PrunerResourceSpec, globalSp
 			if found {
 				switch fieldType {
 				case PrunerFieldTypeTTLSecondsAfterFinished:
-					ttl = spec.TTLSecondsAfterFinished
+					ttl = getRootTTL(resourceType, spec.DefaultPipelineRunTTL, spec.DefaultTaskRunTTL, spec.TTLSecondsAfterFinished)
 
 				case PrunerFieldTypeSuccessfulHistoryLimit:
 					ttl = spec.SuccessfulHistoryLimit
 
 				case PrunerFieldTypeFailedHistoryLimit:
 					ttl = spec.FailedHistoryLimit
+
+				case PrunerFieldTypeCancelledHistoryLimit:
+					ttl = spec.CancelledHistoryLimit
+
+				case PrunerFieldTypeCancelledTTLSecondsAfterFinished:
+					ttl = spec.CancelledTTLSecondsAfterFinished
 				}
 			}
 		}
@@ -182,13 +933,19 @@ func getResourceFieldData(namespacedSpec map[string]PrunerResourceSpec, globalSp
 			if found {
 				switch fieldType {
 				case PrunerFieldTypeTTLSecondsAfterFinished:
-					ttl = spec.TTLSecondsAfterFinished
+					ttl = getRootTTL(resourceType, spec.DefaultPipelineRunTTL, spec.DefaultTaskRunTTL, spec.TTLSecondsAfterFinished)
 
 				case PrunerFieldTypeSuccessfulHistoryLimit:
 					ttl = spec.SuccessfulHistoryLimit
 
 				case PrunerFieldTypeFailedHistoryLimit:
 					ttl = spec.FailedHistoryLimit
+
+				case PrunerFieldTypeCancelledHistoryLimit:
+					ttl = spec.CancelledHistoryLimit
+
+				case PrunerFieldTypeCancelledTTLSecondsAfterFinished:
+					ttl = spec.CancelledTTLSecondsAfterFinished
 				}
 			}
 		}
@@ -197,13 +954,19 @@ func getResourceFieldData(namespacedSpec map[string]PrunerResourceSpec, globalSp
 			// get it from global spec, root level
 			switch fieldType {
 			case PrunerFieldTypeTTLSecondsAfterFinished:
-				ttl = globalSpec.TTLSecondsAfterFinished
+				ttl = getRootTTL(resourceType, globalSpec.DefaultPipelineRunTTL, globalSpec.DefaultTaskRunTTL, globalSpec.TTLSecondsAfterFinished)
 
 			case PrunerFieldTypeSuccessfulHistoryLimit:
 				ttl = globalSpec.SuccessfulHistoryLimit
 
 			case PrunerFieldTypeFailedHistoryLimit:
 				ttl = globalSpec.FailedHistoryLimit
+
+			case PrunerFieldTypeCancelledHistoryLimit:
+				ttl = globalSpec.CancelledHistoryLimit
+
+			case PrunerFieldTypeCancelledTTLSecondsAfterFinished:
+				ttl = globalSpec.CancelledTTLSecondsAfterFinished
 			}
 		}
 
@@ -301,6 +1064,34 @@ func (ps *prunerConfigStore) GetPipelineFailedHistoryLimitCount(namespace, name
 	return getResourceFieldData(ps.namespacedConfig, ps.globalConfig, namespace, name, PrunerResourceTypePipeline, PrunerFieldTypeFailedHistoryLimit, enforcedConfigLevel)
 }
 
+func (ps *prunerConfigStore) GetPipelineCancelledHistoryLimitCount(namespace, name string) *int32 {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	enforcedConfigLevel := ps.GetPipelineEnforcedConfigLevel(namespace, name)
+	return getResourceFieldData(ps.namespacedConfig, ps.globalConfig, namespace, name, PrunerResourceTypePipeline, PrunerFieldTypeCancelledHistoryLimit, enforcedConfigLevel)
+}
+
+func (ps *prunerConfigStore) GetPipelineCancelledTTLSecondsAfterFinished(namespace, name string) *int32 {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	enforcedConfigLevel := ps.GetPipelineEnforcedConfigLevel(namespace, name)
+	return getResourceFieldData(ps.namespacedConfig, ps.globalConfig, namespace, name, PrunerResourceTypePipeline, PrunerFieldTypeCancelledTTLSecondsAfterFinished, enforcedConfigLevel)
+}
+
+func (ps *prunerConfigStore) GetPipelineGroupBy(namespace, name string) []string {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	enforcedConfigLevel := ps.GetPipelineEnforcedConfigLevel(namespace, name)
+	return getResourceGroupBy(ps.namespacedConfig, ps.globalConfig, namespace, name, PrunerResourceTypePipeline, enforcedConfigLevel)
+}
+
+func (ps *prunerConfigStore) GetPipelineTTLFrom(namespace, name string) tektonprunerv1alpha1.TTLFrom {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	enforcedConfigLevel := ps.GetPipelineEnforcedConfigLevel(namespace, name)
+	return getResourceTTLFrom(ps.namespacedConfig, ps.globalConfig, namespace, name, PrunerResourceTypePipeline, enforcedConfigLevel)
+}
+
 func (ps *prunerConfigStore) GetTaskTTLSecondsAfterFinished(namespace, name string) *int32 {
 	ps.mutex.Lock()
 	defer ps.mutex.Unlock()
@@ -321,3 +1112,31 @@ func (ps *prunerConfigStore) GetTaskFailedHistoryLimitCount(namespace, name stri
 	enforcedConfigLevel := ps.GetTaskEnforcedConfigLevel(namespace, name)
 	return getResourceFieldData(ps.namespacedConfig, ps.globalConfig, namespace, name, PrunerResourceTypeTask, PrunerFieldTypeFailedHistoryLimit, enforcedConfigLevel)
 }
+
+func (ps *prunerConfigStore) GetTaskCancelledHistoryLimitCount(namespace, name string) *int32 {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	enforcedConfigLevel := ps.GetTaskEnforcedConfigLevel(namespace, name)
+	return getResourceFieldData(ps.namespacedConfig, ps.globalConfig, namespace, name, PrunerResourceTypeTask, PrunerFieldTypeCancelledHistoryLimit, enforcedConfigLevel)
+}
+
+func (ps *prunerConfigStore) GetTaskCancelledTTLSecondsAfterFinished(namespace, name string) *int32 {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	enforcedConfigLevel := ps.GetTaskEnforcedConfigLevel(namespace, name)
+	return getResourceFieldData(ps.namespacedConfig, ps.globalConfig, namespace, name, PrunerResourceTypeTask, PrunerFieldTypeCancelledTTLSecondsAfterFinished, enforcedConfigLevel)
+}
+
+func (ps *prunerConfigStore) GetTaskGroupBy(namespace, name string) []string {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	enforcedConfigLevel := ps.GetTaskEnforcedConfigLevel(namespace, name)
+	return getResourceGroupBy(ps.namespacedConfig, ps.globalConfig, namespace, name, PrunerResourceTypeTask, enforcedConfigLevel)
+}
+
+func (ps *prunerConfigStore) GetTaskTTLFrom(namespace, name string) tektonprunerv1alpha1.TTLFrom {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	enforcedConfigLevel := ps.GetTaskEnforcedConfigLevel(namespace, name)
+	return getResourceTTLFrom(ps.namespacedConfig, ps.globalConfig, namespace, name, PrunerResourceTypeTask, enforcedConfigLevel)
+}
@@ -0,0 +1,101 @@
+package helper
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// returns the fields of the config data not known by the given type, with the full path, example: "namespaces.ns-1.tasks[0].nme"
+// the data is decoded with the json rules, the field names are matched case-insensitively
+func findUnknownFields(data []byte, target interface{}) ([]string, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	unknownFields := []string{}
+	collectUnknownFields(raw, reflect.TypeOf(target), "", &unknownFields)
+	sort.Strings(unknownFields)
+	return unknownFields, nil
+}
+
+func collectUnknownFields(raw interface{}, t reflect.Type, path string, unknownFields *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		data, ok := raw.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := map[string]reflect.Type{}
+		collectStructFields(t, fields)
+		for key, value := range data {
+			fieldType, found := fields[strings.ToLower(key)]
+			if !found {
+				*unknownFields = append(*unknownFields, joinFieldPath(path, key))
+				continue
+			}
+			collectUnknownFields(value, fieldType, joinFieldPath(path, key), unknownFields)
+		}
+
+	case reflect.Map:
+		data, ok := raw.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for key, value := range data {
+			collectUnknownFields(value, t.Elem(), joinFieldPath(path, key), unknownFields)
+		}
+
+	case reflect.Slice:
+		items, ok := raw.([]interface{})
+		if !ok {
+			return
+		}
+		for index, item := range items {
+			collectUnknownFields(item, t.Elem(), path+"["+strconv.Itoa(index)+"]", unknownFields)
+		}
+	}
+}
+
+// collects the json field names of the struct, in lower case, the embedded structs are flattened
+func collectStructFields(t reflect.Type, fields map[string]reflect.Type) {
+	for index := 0; index < t.NumField(); index++ {
+		field := t.Field(index)
+		tagName := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tagName == "-" {
+			continue
+		}
+		if tagName == "" && field.Anonymous {
+			embeddedType := field.Type
+			if embeddedType.Kind() == reflect.Ptr {
+				embeddedType = embeddedType.Elem()
+			}
+			if embeddedType.Kind() == reflect.Struct {
+				collectStructFields(embeddedType, fields)
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tagName != "" {
+			name = tagName
+		}
+		fields[strings.ToLower(name)] = field.Type
+	}
+}
+
+func joinFieldPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,176 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+
+	tektonprunerv1alpha1 "github.com/openshift-pipelines/tektoncd-pruner/pkg/apis/tektonpruner/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// NewPrunerConfigFromConfigMap decodes and validates the global config of the ConfigMap
+// used by the webhook to reject an invalid config, before it reaches the controller
+func NewPrunerConfigFromConfigMap(configMap *corev1.ConfigMap) (*PrunerConfig, error) {
+	globalConfig, _, err := parseGlobalConfig(configMap)
+	return globalConfig, err
+}
+
+// validates the values of the global config, all the errors are reported together
+// -1 disables the ttl and the history limits, lower values are rejected
+func validateGlobalConfig(globalConfig *PrunerConfig) error {
+	errs := []error{}
+	errs = append(errs, validateEnforcedConfigLevel("enforcedConfigLevel", globalConfig.EnforcedConfigLevel)...)
+	errs = append(errs, validateLimits("", globalConfig.TTLSecondsAfterFinished, globalConfig.SuccessfulHistoryLimit, globalConfig.FailedHistoryLimit, globalConfig.HistoryLimit)...)
+	errs = append(errs, validateTypeTTLs("", globalConfig.DefaultPipelineRunTTL, globalConfig.DefaultTaskRunTTL)...)
+	errs = append(errs, validateCancelledLimits("", globalConfig.CancelledHistoryLimit, globalConfig.CancelledTTLSecondsAfterFinished)...)
+	errs = append(errs, validateMissingCondition(globalConfig.MissingCondition)...)
+	errs = append(errs, validatePipelineRunChildHandling(globalConfig.PipelineRunChildHandling)...)
+	errs = append(errs, validateNestedPipelineRunHandling(globalConfig.NestedPipelineRunHandling)...)
+	if globalConfig.PerResourceLogSampleRate != nil && *globalConfig.PerResourceLogSampleRate < 1 {
+		errs = append(errs, fmt.Errorf("perResourceLogSampleRate should be 1 or greater"))
+	}
+	if globalConfig.AnnotationUpdateRetries != nil && *globalConfig.AnnotationUpdateRetries < 0 {
+		errs = append(errs, fmt.Errorf("annotationUpdateRetries should be 0 or greater"))
+	}
+	if fraction := globalConfig.MaxDeletionFractionPerNamespace; fraction != nil && (*fraction <= 0 || *fraction > 1) {
+		errs = append(errs, fmt.Errorf("maxDeletionFractionPerNamespace should be greater than 0 and up to 1"))
+	}
+	// an invalid calendar fails the ttl in business days, rejected on the load
+	if _, err := newBusinessCalendar(globalConfig.BusinessCalendar); err != nil {
+		errs = append(errs, err)
+	}
+
+	for namespace, spec := range globalConfig.Namespaces {
+		prefix := fmt.Sprintf("namespaces.%s.", namespace)
+		errs = append(errs, validateEnforcedConfigLevel(prefix+"enforcedConfigLevel", spec.EnforcedConfigLevel)...)
+		errs = append(errs, validateLimits(prefix, spec.TTLSecondsAfterFinished, spec.SuccessfulHistoryLimit, spec.FailedHistoryLimit, spec.HistoryLimit)...)
+		errs = append(errs, validateTypeTTLs(prefix, spec.DefaultPipelineRunTTL, spec.DefaultTaskRunTTL)...)
+		errs = append(errs, validateCancelledLimits(prefix, spec.CancelledHistoryLimit, spec.CancelledTTLSecondsAfterFinished)...)
+		errs = append(errs, validateLimitValues(prefix, []limitValue{{"maxTotalRuns", spec.MaxTotalRuns}})...)
+		errs = append(errs, validateTTLFrom(prefix+"ttlFrom", spec.TTLFrom)...)
+		if _, err := labels.Parse(spec.ResourceSelector); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %sresourceSelector:%s, %w", prefix, spec.ResourceSelector, err))
+		}
+		errs = append(errs, validateResourceSpecs(prefix+"pipelines", spec.Pipelines)...)
+		errs = append(errs, validateResourceSpecs(prefix+"tasks", spec.Tasks)...)
+	}
+	return errors.Join(errs...)
+}
+
+func validateResourceSpecs(field string, resourceSpecs []tektonprunerv1alpha1.ResourceSpec) []error {
+	errs := []error{}
+	for index, resourceSpec := range resourceSpecs {
+		prefix := fmt.Sprintf("%s[%d].", field, index)
+		errs = append(errs, validateEnforcedConfigLevel(prefix+"enforcedConfigLevel", resourceSpec.EnforcedConfigLevel)...)
+		errs = append(errs, validateLimits(prefix, resourceSpec.TTLSecondsAfterFinished, resourceSpec.SuccessfulHistoryLimit, resourceSpec.FailedHistoryLimit, resourceSpec.HistoryLimit)...)
+		errs = append(errs, validateCancelledLimits(prefix, resourceSpec.CancelledHistoryLimit, resourceSpec.CancelledTTLSecondsAfterFinished)...)
+		errs = append(errs, validateTTLFrom(prefix+"ttlFrom", resourceSpec.TTLFrom)...)
+	}
+	return errs
+}
+
+// allowed policies: failed, skip, maxAge, the maxAge policy requires the maximum age
+func validateMissingCondition(spec *MissingConditionSpec) []error {
+	if spec == nil {
+		return nil
+	}
+	switch spec.Policy {
+	case "", MissingConditionPolicyFailed, MissingConditionPolicySkip:
+		return nil
+	case MissingConditionPolicyMaxAge:
+		if spec.MaxAgeSeconds == nil || *spec.MaxAgeSeconds < 0 {
+			return []error{fmt.Errorf("missingCondition.maxAgeSeconds should be 0 or greater on the %s policy", spec.Policy)}
+		}
+		return nil
+	}
+	return []error{fmt.Errorf("invalid value '%s' on missingCondition.policy, allowed values: %s, %s, %s", spec.Policy,
+		MissingConditionPolicyFailed, MissingConditionPolicySkip, MissingConditionPolicyMaxAge)}
+}
+
+// allowed values: leave, cascade
+func validatePipelineRunChildHandling(handling *PipelineRunChildHandling) []error {
+	if handling == nil {
+		return nil
+	}
+	switch *handling {
+	case "", PipelineRunChildHandlingLeave, PipelineRunChildHandlingCascade:
+		return nil
+	}
+	return []error{fmt.Errorf("invalid value '%s' on pipelineRunChildHandling, allowed values: %s, %s", *handling,
+		PipelineRunChildHandlingLeave, PipelineRunChildHandlingCascade)}
+}
+
+// allowed values: independent, parent
+func validateNestedPipelineRunHandling(handling *NestedPipelineRunHandling) []error {
+	if handling == nil {
+		return nil
+	}
+	switch *handling {
+	case "", NestedPipelineRunHandlingIndependent, NestedPipelineRunHandlingParent:
+		return nil
+	}
+	return []error{fmt.Errorf("invalid value '%s' on nestedPipelineRunHandling, allowed values: %s, %s", *handling,
+		NestedPipelineRunHandlingIndependent, NestedPipelineRunHandlingParent)}
+}
+
+// allowed values: completion, start
+func validateTTLFrom(field string, ttlFrom tektonprunerv1alpha1.TTLFrom) []error {
+	switch ttlFrom {
+	case "", tektonprunerv1alpha1.TTLFromCompletion, tektonprunerv1alpha1.TTLFromStart:
+		return nil
+	}
+	return []error{fmt.Errorf("invalid value '%s' on %s, allowed values: %s, %s", ttlFrom, field,
+		tektonprunerv1alpha1.TTLFromCompletion, tektonprunerv1alpha1.TTLFromStart)}
+}
+
+// allowed values: global, namespace, resource
+func validateEnforcedConfigLevel(field string, enforcedConfigLevel *tektonprunerv1alpha1.EnforcedConfigLevel) []error {
+	if enforcedConfigLevel == nil {
+		return nil
+	}
+	switch *enforcedConfigLevel {
+	case tektonprunerv1alpha1.EnforcedConfigLevelGlobal, tektonprunerv1alpha1.EnforcedConfigLevelNamespace, tektonprunerv1alpha1.EnforcedConfigLevelResource:
+		return nil
+	}
+	return []error{fmt.Errorf("invalid value '%s' on %s, allowed values: %s, %s, %s", *enforcedConfigLevel, field,
+		tektonprunerv1alpha1.EnforcedConfigLevelGlobal, tektonprunerv1alpha1.EnforcedConfigLevelNamespace, tektonprunerv1alpha1.EnforcedConfigLevelResource)}
+}
+
+func validateLimits(prefix string, ttlSecondsAfterFinished, successfulHistoryLimit, failedHistoryLimit, historyLimit *int32) []error {
+	return validateLimitValues(prefix, []limitValue{
+		{"ttlSecondsAfterFinished", ttlSecondsAfterFinished},
+		{"successfulHistoryLimit", successfulHistoryLimit},
+		{"failedHistoryLimit", failedHistoryLimit},
+		{"historyLimit", historyLimit},
+	})
+}
+
+func validateCancelledLimits(prefix string, cancelledHistoryLimit, cancelledTTLSecondsAfterFinished *int32) []error {
+	return validateLimitValues(prefix, []limitValue{
+		{"cancelledHistoryLimit", cancelledHistoryLimit},
+		{"cancelledTTLSecondsAfterFinished", cancelledTTLSecondsAfterFinished},
+	})
+}
+
+func validateTypeTTLs(prefix string, defaultPipelineRunTTL, defaultTaskRunTTL *int32) []error {
+	return validateLimitValues(prefix, []limitValue{
+		{"defaultPipelineRunTTL", defaultPipelineRunTTL},
+		{"defaultTaskRunTTL", defaultTaskRunTTL},
+	})
+}
+
+type limitValue struct {
+	field string
+	value *int32
+}
+
+func validateLimitValues(prefix string, limits []limitValue) []error {
+	errs := []error{}
+	for _, limit := range limits {
+		if limit.value != nil && *limit.value < -1 {
+			errs = append(errs, fmt.Errorf("invalid value %d on %s%s, should be -1 or greater", *limit.value, prefix, limit.field))
+		}
+	}
+	return errs
+}
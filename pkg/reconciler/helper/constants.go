@@ -3,12 +3,23 @@ package helper
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 const (
 	EnvSystemNamespace                 = "SYSTEM_NAMESPACE"
 	EnvTTLConcurrentWorkersPipelineRun = "TTL_CONCURRENT_WORKERS_PIPELINE_RUN"
 	EnvTTLConcurrentWorkersTaskRun     = "TTL_CONCURRENT_WORKERS_TASK_RUN"
+	EnvTTLConcurrentWorkersCustomRun   = "TTL_CONCURRENT_WORKERS_CUSTOM_RUN"
+	EnvMetricsTextfilePath             = "METRICS_TEXTFILE_PATH"
+	EnvMetricsTextfileIntervalSeconds  = "METRICS_TEXTFILE_INTERVAL_SECONDS"
+	EnvMetricsTextfilePrefix           = "METRICS_TEXTFILE_PREFIX"
+	EnvEmitDeletionEvents              = "EMIT_DELETION_EVENTS"
+	EnvHistoryLimitListFromCache       = "HISTORY_LIMIT_LIST_FROM_CACHE"
+	EnvStartupPermissionCheck          = "STARTUP_PERMISSION_CHECK"
+	EnvInstanceName                    = "PRUNER_INSTANCE_NAME"
+	EnvDebugServerAddress              = "DEBUG_SERVER_ADDRESS"
+	EnvDeletionHoldAnnotation          = "DELETION_HOLD_ANNOTATION"
 
 	LabelPipelineName    = "tekton.dev/pipeline"
 	LabelPipelineRunName = "tekton.dev/pipelineRun"
@@ -17,12 +28,28 @@ const (
 
 	KindPipelineRun = "PipelineRun"
 	KindTaskRun     = "TaskRun"
+	KindCustomRun   = "CustomRun"
 
 	AnnotationTTLSecondsAfterFinished    = "pruner.tekton.dev/ttlSecondsAfterFinished"
+	AnnotationTTLBusinessDays            = "pruner.tekton.dev/ttlBusinessDays"
 	AnnotationResourceNameLabelKey       = "pruner.tekton.dev/resourceNameLabelKey"
 	AnnotationSuccessfulHistoryLimit     = "pruner.tekton.dev/successfulHistoryLimit"
 	AnnotationFailedHistoryLimit         = "pruner.tekton.dev/failedHistoryLimit"
+	AnnotationCancelledHistoryLimit      = "pruner.tekton.dev/cancelledHistoryLimit"
 	AnnotationHistoryLimitCheckProcessed = "pruner.tekton.dev/historyLimitCheckProcessed"
+	// resource annotation, name of the run retried by this run, the retries are counted as one with collapseRetries
+	AnnotationRetryOf = "pruner.tekton.dev/retryOf"
+	// used as a label or an annotation
+	AnnotationLegalHold = "pruner.tekton.dev/legalHold"
+	// annotation on the emitted events, identifies the pruner instance
+	AnnotationInstanceName = "pruner.tekton.dev/instance"
+	// resource annotation, the resource is never pruned when the value is "true"
+	AnnotationSkip = "pruner.tekton.dev/skip"
+	// namespace annotation, disables the pruner policies on the namespace
+	AnnotationNamespaceDisable = "pruner.tekton.dev/disable"
+
+	// reason of the event emitted on deletion
+	EventReasonPruned = "Pruned"
 
 	// name of the config map to hold pruner global config data
 	PrunerConfigMapName = "tekton-pruner-default-spec"
@@ -33,6 +60,40 @@ const (
 	DefaultTTLConcurrentWorkersPipelineRun = int(5)
 	// number of workers on TaskRun controller
 	DefaultTTLConcurrentWorkersTaskRun = int(5)
+	// number of workers on CustomRun controller
+	DefaultTTLConcurrentWorkersCustomRun = int(5)
+	// interval to write the metrics into the textfile
+	DefaultMetricsTextfileIntervalSeconds = int(60)
+	// delay to evaluate a resource again, when the deletion is aborted by a hook
+	// doubled on each abort of the same resource, up to the maximum delay
+	DefaultDeletionAbortedRequeueDelay    = time.Minute
+	DefaultDeletionAbortedRequeueMaxDelay = time.Hour
+	// window of the maximum deletion fraction of a namespace, the fraction is applied to all the sweeps within the window
+	DefaultDeletionFractionWindow = time.Hour
+	// maximum number of labels copied to an emitted event
+	MaxEventPropagatedLabels = 10
+	// number of parallel deletions on trimming the history of a namespace
+	DefaultDeleteConcurrency = 1
+	// maximum number of parallel deletions on trimming the history of a namespace
+	MaxDeleteConcurrency = 20
+	// number of retries of an annotation update on a conflict
+	DefaultAnnotationUpdateRetries = 4
+	// number of resources listed per page
+	DefaultListPageSize = int64(500)
+	// precision of the requeue duration of a resource waiting for the ttl
+	DefaultTTLRequeuePrecision = time.Second
+	// maximum number of retained resources tracked per namespace, to report the retention reasons
+	DefaultRetentionTrackerMaxResourcesPerNamespace = 10000
+	// interval to refresh the retention breakdown on the TektonPruner status
+	DefaultRetentionBreakdownRefreshInterval = time.Minute
+	// interval to detect the stuck runs
+	DefaultStuckRunDetectionInterval = 5 * time.Minute
+	// interval to evaluate a completed resource again, while the pruning is paused
+	DefaultPausedRequeueInterval = time.Minute
+	// delay to evaluate a resource again, when its namespace is not yet in the cache and the namespace selector is configured
+	DefaultNamespaceNotCachedRequeueDelay = 10 * time.Second
+	// history limiter lists the resources with a quorum read, the api server cache is opt-in
+	DefaultHistoryLimitListFromCache = false
 )
 
 func GetEnvValueAsInt(envKey string, defaultValue int) (int, error) {
@@ -42,3 +103,42 @@ func GetEnvValueAsInt(envKey string, defaultValue int) (int, error) {
 	}
 	return strconv.Atoi(strValue)
 }
+
+func GetEnvValueAsBool(envKey string, defaultValue bool) (bool, error) {
+	strValue := os.Getenv(envKey)
+	if strValue == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseBool(strValue)
+}
+
+// returns the resource version to be used on the history limiter list calls
+// "0" serves the list from the api server watch cache, cheaper but can be slightly stale.
+// a stale list can miss the latest resources or include resources already deleted,
+// either way the history is trimmed fully on the next event.
+// a stale list can miss the latest annotations too, the resources are deleted with the uid and the resource version
+// preconditions, a resource changed since the listing is not deleted, evaluated again on its update event
+// an empty resource version forces a quorum read from etcd
+func GetHistoryLimitListResourceVersion() (string, error) {
+	fromCache, err := GetEnvValueAsBool(EnvHistoryLimitListFromCache, DefaultHistoryLimitListFromCache)
+	if err != nil {
+		return "", err
+	}
+	if fromCache {
+		return "0", nil
+	}
+	return "", nil
+}
+
+// returns the name of the pruner instance, used to identify the source of the events
+// defaults to the hostname, the pod name on kubernetes
+func GetInstanceName() string {
+	if instanceName := os.Getenv(EnvInstanceName); instanceName != "" {
+		return instanceName
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
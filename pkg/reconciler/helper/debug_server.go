@@ -0,0 +1,73 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"knative.dev/pkg/logging"
+)
+
+// RunDebugServer serves the read-only debug endpoints on the given address, until the context is cancelled
+// - /debug/config: the loaded config, with the resolved values
+// - /debug/namespaces: the namespaces the policies apply to, "?reasons=true" includes the reasons of the skipped policies
+func RunDebugServer(ctx context.Context, address string, namespaceLister corelisters.NamespaceLister) {
+	logger := logging.FromContext(ctx)
+
+	server := &http.Server{
+		Addr:              address,
+		Handler:           newDebugServeMux(ctx, namespaceLister),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Infow("starting the debug server", "address", address)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Errorw("error on serving the debug endpoints", "address", address, zap.Error(err))
+	}
+}
+
+// returns the handler of the debug endpoints
+func newDebugServeMux(ctx context.Context, namespaceLister corelisters.NamespaceLister) *http.ServeMux {
+	logger := logging.FromContext(ctx)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/config", func(w http.ResponseWriter, r *http.Request) {
+		writeDebugResponse(ctx, w, r, PrunerConfigStore.GetSnapshot())
+	})
+	mux.HandleFunc("/debug/namespaces", func(w http.ResponseWriter, r *http.Request) {
+		withReasons, _ := strconv.ParseBool(r.URL.Query().Get("reasons"))
+		report, err := GetNamespacesReport(namespaceLister, withReasons)
+		if err != nil {
+			logger.Errorw("error on listing the namespaces", zap.Error(err))
+			http.Error(w, "error on listing the namespaces", http.StatusInternalServerError)
+			return
+		}
+		writeDebugResponse(ctx, w, r, report)
+	})
+	return mux
+}
+
+func writeDebugResponse(ctx context.Context, w http.ResponseWriter, r *http.Request, data interface{}) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		logger := logging.FromContext(ctx)
+		logger.Errorw("error on writing the debug response", "path", r.URL.Path, zap.Error(err))
+	}
+}
@@ -0,0 +1,85 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDebugNamespacesHandler(t *testing.T) {
+	loadTestGlobalConfig(t, `
+excludeNamespaces: [kube-system]
+`)
+	namespaceLister := newTestNamespaceLister(t,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns-b"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns-a"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "ns-disabled",
+			Annotations: map[string]string{AnnotationNamespaceDisable: "true"},
+		}},
+	)
+	mux := newDebugServeMux(context.Background(), namespaceLister)
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		expectedStatus int
+		expected       NamespacesReport
+	}{
+		{
+			name:           "filtered namespaces",
+			method:         http.MethodGet,
+			target:         "/debug/namespaces",
+			expectedStatus: http.StatusOK,
+			expected:       NamespacesReport{Namespaces: []string{"ns-a", "ns-b"}},
+		},
+		{
+			name:           "filtered namespaces with the reasons of the skipped",
+			method:         http.MethodGet,
+			target:         "/debug/namespaces?reasons=true",
+			expectedStatus: http.StatusOK,
+			expected: NamespacesReport{
+				Namespaces: []string{"ns-a", "ns-b"},
+				Skipped: map[string]map[PrunerPolicy]string{
+					"kube-system": {PrunerPolicyTTL: NamespaceFilteredReasonConfig, PrunerPolicyHistoryLimit: NamespaceFilteredReasonConfig},
+					"ns-disabled": {PrunerPolicyTTL: NamespaceFilteredReasonAnnotation, PrunerPolicyHistoryLimit: NamespaceFilteredReasonAnnotation},
+				},
+			},
+		},
+		{
+			name:           "read-only",
+			method:         http.MethodPost,
+			target:         "/debug/namespaces",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(test.method, test.target, nil))
+
+			if recorder.Code != test.expectedStatus {
+				t.Fatalf("expected the status %d, got %d: %s", test.expectedStatus, recorder.Code, recorder.Body.String())
+			}
+			if test.expectedStatus != http.StatusOK {
+				return
+			}
+			report := NamespacesReport{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+				t.Fatalf("error on decoding the response: %v", err)
+			}
+			if !reflect.DeepEqual(report, test.expected) {
+				t.Errorf("expected the report %+v, got %+v", test.expected, report)
+			}
+		})
+	}
+}
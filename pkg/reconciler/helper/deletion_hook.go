@@ -0,0 +1,181 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+)
+
+// DeletionHook is invoked around each resource deletion done by the ttl handler and the history limiter
+type DeletionHook interface {
+	// BeforeDelete is invoked before deleting a resource
+	// returning an error aborts the deletion, the resource will be evaluated again later, with a backoff
+	BeforeDelete(ctx context.Context, resource metav1.Object) error
+	// AfterDelete is invoked after the resource is deleted, best effort
+	AfterDelete(ctx context.Context, resource metav1.Object)
+}
+
+type deletionHookRegistry struct {
+	mutex sync.RWMutex
+	hooks []DeletionHook
+}
+
+// number of the deletions aborted by the hooks, per resource UID
+type deletionAbortedBackoff struct {
+	mutex    sync.Mutex
+	attempts map[types.UID]int
+}
+
+var (
+	// registry of the deletion hooks
+	// singleton instance
+	deletionHooks = deletionHookRegistry{mutex: sync.RWMutex{}}
+
+	// backoff of the resources retained by the hooks
+	// singleton instance
+	deletionAborted = deletionAbortedBackoff{attempts: map[types.UID]int{}}
+)
+
+// RegisterDeletionHook adds a hook to be invoked around each deletion
+// should be called on startup, before the controllers start
+func RegisterDeletionHook(hook DeletionHook) {
+	deletionHooks.mutex.Lock()
+	defer deletionHooks.mutex.Unlock()
+	deletionHooks.hooks = append(deletionHooks.hooks, hook)
+}
+
+// registers the built-in hooks enabled on the environment
+func RegisterBuiltinDeletionHooks() error {
+	emitEvents, err := GetEnvValueAsBool(EnvEmitDeletionEvents, false)
+	if err != nil {
+		return err
+	}
+	if emitEvents {
+		RegisterDeletionHook(&EventDeletionHook{InstanceName: GetInstanceName()})
+	}
+	if holdAnnotation := os.Getenv(EnvDeletionHoldAnnotation); holdAnnotation != "" {
+		RegisterDeletionHook(&AnnotationHoldDeletionHook{Key: holdAnnotation})
+	}
+	return nil
+}
+
+func hasDeletionHooks() bool {
+	deletionHooks.mutex.RLock()
+	defer deletionHooks.mutex.RUnlock()
+	return len(deletionHooks.hooks) > 0
+}
+
+func getDeletionHooks() []DeletionHook {
+	deletionHooks.mutex.RLock()
+	defer deletionHooks.mutex.RUnlock()
+	return deletionHooks.hooks
+}
+
+// runs all the before delete hooks, stops on the first error
+func runBeforeDeleteHooks(ctx context.Context, resource metav1.Object) error {
+	for _, hook := range getDeletionHooks() {
+		if err := hook.BeforeDelete(ctx, resource); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runAfterDeleteHooks(ctx context.Context, resource metav1.Object) {
+	for _, hook := range getDeletionHooks() {
+		hook.AfterDelete(ctx, resource)
+	}
+}
+
+// returns a requeue error, when a deletion is aborted by a hook
+// the delay is doubled on each abort of the resources, up to the maximum delay,
+// the resource aborted the least number of times decides the delay
+func deletionAbortedRequeue(resources ...metav1.Object) error {
+	deletionAborted.mutex.Lock()
+	defer deletionAborted.mutex.Unlock()
+	minAttempts := 0
+	for index, resource := range resources {
+		deletionAborted.attempts[resource.GetUID()]++
+		if attempts := deletionAborted.attempts[resource.GetUID()]; index == 0 || attempts < minAttempts {
+			minAttempts = attempts
+		}
+	}
+
+	delay := DefaultDeletionAbortedRequeueDelay
+	for attempt := 1; attempt < minAttempts && delay < DefaultDeletionAbortedRequeueMaxDelay; attempt++ {
+		delay *= 2
+	}
+	return controller.NewRequeueAfter(min(delay, DefaultDeletionAbortedRequeueMaxDelay))
+}
+
+// the deleted resource is not retained by the hooks anymore
+func (dab *deletionAbortedBackoff) forget(resource metav1.Object) {
+	dab.mutex.Lock()
+	defer dab.mutex.Unlock()
+	delete(dab.attempts, resource.GetUID())
+}
+
+// EventDeletionHook emits a kubernetes event for each deleted resource
+// the event is annotated with the pruner instance name, to identify the source across the clusters
+type EventDeletionHook struct {
+	InstanceName string
+}
+
+func (edh *EventDeletionHook) BeforeDelete(ctx context.Context, resource metav1.Object) error {
+	return nil
+}
+
+func (edh *EventDeletionHook) AfterDelete(ctx context.Context, resource metav1.Object) {
+	recorder := controller.GetEventRecorder(ctx)
+	if recorder == nil {
+		return
+	}
+	object, ok := resource.(runtime.Object)
+	if !ok {
+		logger := logging.FromContext(ctx)
+		logger.Debugw("resource is not a runtime object, can not emit an event",
+			"namespace", resource.GetNamespace(), "name", resource.GetName(),
+			"type", fmt.Sprintf("%T", resource),
+		)
+		return
+	}
+	annotations := map[string]string{}
+	// the selected labels of the resource, to route the events by them
+	labels := resource.GetLabels()
+	for _, key := range PrunerConfigStore.GetEventPropagatedLabels() {
+		if value, found := labels[key]; found {
+			annotations[key] = value
+		}
+	}
+	annotations[AnnotationInstanceName] = edh.InstanceName
+	recorder.AnnotatedEventf(object, annotations, corev1.EventTypeNormal, EventReasonPruned,
+		"deleted by the pruner instance %q at %s", edh.InstanceName, time.Now().UTC().Format(time.RFC3339))
+}
+
+// AnnotationHoldDeletionHook holds the deletion of the resources with the annotation, managed by an external system
+// example: an audit system referencing the runs by the UID, holds the runs until the references are released
+// the resource is held while the annotation is present, except the value "false"
+// the hold is checked again on each evaluation, the resource is deleted once the annotation is removed
+type AnnotationHoldDeletionHook struct {
+	Key string
+}
+
+func (ahdh *AnnotationHoldDeletionHook) BeforeDelete(ctx context.Context, resource metav1.Object) error {
+	value, found := resource.GetAnnotations()[ahdh.Key]
+	if found && !strings.EqualFold(value, "false") {
+		return fmt.Errorf("deletion is held by the annotation '%s=%s'", ahdh.Key, value)
+	}
+	return nil
+}
+
+func (ahdh *AnnotationHoldDeletionHook) AfterDelete(ctx context.Context, resource metav1.Object) {}
@@ -0,0 +1,148 @@
+package helper
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/ptr"
+)
+
+// records the resources deleted
+type recordDeletionHook struct {
+	deleted []string
+}
+
+func (h *recordDeletionHook) BeforeDelete(ctx context.Context, resource metav1.Object) error {
+	return nil
+}
+
+func (h *recordDeletionHook) AfterDelete(ctx context.Context, resource metav1.Object) {
+	h.deleted = append(h.deleted, resource.GetName())
+}
+
+func registerTestDeletionHooks(t *testing.T, hooks ...DeletionHook) {
+	t.Helper()
+	for _, hook := range hooks {
+		RegisterDeletionHook(hook)
+	}
+	t.Cleanup(func() {
+		deletionHooks.mutex.Lock()
+		defer deletionHooks.mutex.Unlock()
+		deletionHooks.hooks = nil
+	})
+}
+
+func TestDeletionAbortedBackoff(t *testing.T) {
+	resource := &metav1.ObjectMeta{Namespace: "ns-1", Name: "run-0", UID: types.UID("uid-backoff")}
+	t.Cleanup(func() { deletionAborted.forget(resource) })
+
+	expectedDelays := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 16 * time.Minute, 32 * time.Minute, time.Hour, time.Hour}
+	for index, expectedDelay := range expectedDelays {
+		if _, delay := controller.IsRequeueKey(deletionAbortedRequeue(resource)); delay != expectedDelay {
+			t.Fatalf("expected the delay %s on the abort %d, got %s", expectedDelay, index+1, delay)
+		}
+	}
+
+	// the resource aborted the least number of times decides the delay
+	other := &metav1.ObjectMeta{Namespace: "ns-1", Name: "run-1", UID: types.UID("uid-backoff-other")}
+	t.Cleanup(func() { deletionAborted.forget(other) })
+	if _, delay := controller.IsRequeueKey(deletionAbortedRequeue(resource, other)); delay != time.Minute {
+		t.Fatalf("expected the delay %s for the resource aborted first time, got %s", time.Minute, delay)
+	}
+
+	deletionAborted.forget(resource)
+	if _, delay := controller.IsRequeueKey(deletionAbortedRequeue(resource)); delay != time.Minute {
+		t.Fatalf("expected the delay %s after forget, got %s", time.Minute, delay)
+	}
+}
+
+func TestHistoryLimitDeletionVetoedByHook(t *testing.T) {
+	loadTestGlobalConfig(t, `
+namespaces:
+  ns-1:
+    maxTotalRuns: 2
+`)
+	recorder := &recordDeletionHook{}
+	registerTestDeletionHooks(t, &abortDeletionHook{}, recorder)
+	resourceFn := &fakeHistoryLimiterResourceFuncs{resources: newFakeResources("ns-1", 5), resourceVersion: "1"}
+	t.Cleanup(func() {
+		for _, res := range resourceFn.resources {
+			deletionAborted.forget(res)
+		}
+	})
+	hl, err := NewHistoryLimiter(nil, resourceFn)
+	if err != nil {
+		t.Fatalf("error on getting history limiter: %v", err)
+	}
+
+	err = hl.doNamespaceBudgetCleanup(context.Background(), resourceFn.resources[0])
+	if isRequeueKey, _ := controller.IsRequeueKey(err); !isRequeueKey {
+		t.Fatalf("expected a requeue for the resources retained by the hook, got: %v", err)
+	}
+	if len(resourceFn.deleted) != 0 || len(recorder.deleted) != 0 {
+		t.Fatalf("expected no deletion, got deleted %v, after delete hook %v", resourceFn.deleted, recorder.deleted)
+	}
+}
+
+func TestTTLDeletionVetoedByHook(t *testing.T) {
+	loadTestGlobalConfig(t, "")
+	recorder := &recordDeletionHook{}
+	registerTestDeletionHooks(t, &abortDeletionHook{}, recorder)
+	completedAt := time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC)
+	resource := &metav1.ObjectMeta{
+		Namespace:         "ns-1",
+		Name:              "run-0",
+		UID:               types.UID("uid-0"),
+		Labels:            map[string]string{LabelPipelineName: "foo"},
+		CreationTimestamp: metav1.NewTime(completedAt),
+	}
+	t.Cleanup(func() { deletionAborted.forget(resource) })
+	resourceFn := &fakeTTLResourceFuncs{resources: []metav1.Object{resource}, ttl: ptr.Int32(60)}
+	th, err := NewTTLHandler(clocktesting.NewFakeClock(completedAt.Add(time.Hour)), resourceFn)
+	if err != nil {
+		t.Fatalf("error on getting ttl handler: %v", err)
+	}
+
+	for _, expectedDelay := range []time.Duration{time.Minute, 2 * time.Minute} {
+		err = th.ProcessEvent(context.Background(), resource)
+		if isRequeueKey, delay := controller.IsRequeueKey(err); !isRequeueKey || delay != expectedDelay {
+			t.Fatalf("expected a requeue after %s, got: %v", expectedDelay, err)
+		}
+	}
+	if len(resourceFn.deleted) != 0 || len(recorder.deleted) != 0 {
+		t.Fatalf("expected no deletion, got deleted %v, after delete hook %v", resourceFn.deleted, recorder.deleted)
+	}
+}
+
+func TestAfterDeleteHookOncePerDeletedRun(t *testing.T) {
+	loadTestGlobalConfig(t, `
+namespaces:
+  ns-1:
+    maxTotalRuns: 2
+`)
+	recorder := &recordDeletionHook{}
+	registerTestDeletionHooks(t, recorder)
+	resourceFn := &fakeHistoryLimiterResourceFuncs{resources: newFakeResources("ns-1", 5), resourceVersion: "1"}
+	hl, err := NewHistoryLimiter(nil, resourceFn)
+	if err != nil {
+		t.Fatalf("error on getting history limiter: %v", err)
+	}
+
+	if err := hl.doNamespaceBudgetCleanup(context.Background(), resourceFn.resources[0]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resourceFn.deleted) != 3 {
+		t.Fatalf("expected 3 deleted resources, got %d: %v", len(resourceFn.deleted), resourceFn.deleted)
+	}
+	slices.Sort(recorder.deleted)
+	slices.Sort(resourceFn.deleted)
+	if !slices.Equal(recorder.deleted, resourceFn.deleted) {
+		t.Fatalf("expected the after delete hook once per deleted resource %v, got %v", resourceFn.deleted, recorder.deleted)
+	}
+}
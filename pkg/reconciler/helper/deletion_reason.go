@@ -0,0 +1,47 @@
+package helper
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reasons reported on the deleted resources
+//
+// a resource can be eligible for more than one policy at the time of the deletion,
+// the reported reason does not depend on the policy executed first, the precedence is:
+// definitionDeleted > ttlExpired, missingConditionMaxAge > historyLimit, namespaceBudget
+// the time based policies are specific to the resource, the history limit is specific to its group
+// and the namespace budget is specific to its namespace
+const (
+	DeletionReasonDefinitionDeleted = "definitionDeleted"
+	DeletionReasonTTLExpired        = "ttlExpired"
+	DeletionReasonMissingCondition  = "missingConditionMaxAge"
+	DeletionReasonHistoryLimit      = "historyLimit"
+	DeletionReasonNamespaceBudget   = "namespaceBudget"
+	DeletionReasonStuckRun          = "stuckRun"
+)
+
+// returns the reason of a resource deleted on the ttl expiry
+func (th *TTLHandler) getDeletionReason(resource metav1.Object) string {
+	if th.getDeletedDefinitionTTL(resource) != nil {
+		return DeletionReasonDefinitionDeleted
+	}
+	if getMissingConditionMaxAge(resource, th.resourceFn.IsCompleted) != nil {
+		return DeletionReasonMissingCondition
+	}
+	return DeletionReasonTTLExpired
+}
+
+// returns the reason of a resource deleted on the history limit or on the namespace budget,
+// the ttl reason takes precedence, when the ttl of the resource is expired too
+func (hl *HistoryLimiter) getDeletionReason(resource metav1.Object, limitReason string) string {
+	ttlResourceFn, ok := hl.resourceFn.(TTLResourceFuncs)
+	if !ok {
+		return limitReason
+	}
+	th := &TTLHandler{clock: hl.clock, resourceFn: ttlResourceFn}
+	_, expireAt, err := th.getFinishAndExpireTime(resource)
+	if err != nil || expireAt.After(th.clock.Now()) {
+		return limitReason
+	}
+	return th.getDeletionReason(resource)
+}
@@ -1,7 +1,18 @@
 package helper
 
 import (
+	"context"
+	"strings"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
 )
 
 // common functions used across history limiter and ttl handler
@@ -26,3 +37,147 @@ func getResourceName(resource metav1.Object, labelKey string) string {
 	// get label value
 	return labels[labelKey]
 }
+
+// returns true, if the resource is on legal hold
+// a resource on legal hold is never deleted, takes precedence over all the deletion policies
+// the hold is verified on each evaluation, once the hold is removed the resource is prunable again
+func isOnLegalHold(resource metav1.Object) bool {
+	legalHold := PrunerConfigStore.GetLegalHold()
+	for _, data := range []map[string]string{resource.GetLabels(), resource.GetAnnotations()} {
+		value, found := data[legalHold.Key]
+		if found && (legalHold.Value == "" || legalHold.Value == value) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns true, if the resource opted out of the pruning with the skip annotation
+// a skipped resource is not evaluated by any of the policies, not counted toward the history limits
+func isSkipped(resource metav1.Object) bool {
+	return strings.EqualFold(resource.GetAnnotations()[AnnotationSkip], "true")
+}
+
+// returns true, if the resource matches the resource selector of the namespace
+// the resources not matching are not evaluated by any of the policies, not counted toward the history limits
+func isSelected(resource metav1.Object) bool {
+	selector := PrunerConfigStore.GetResourceSelector(resource.GetNamespace())
+	return selector == nil || selector.Matches(labels.Set(resource.GetLabels()))
+}
+
+// records a resource skipped by the pruner, with the reason
+func reportSkipped(ctx context.Context, resourceType string, resource metav1.Object, reason string) {
+	perResourceLogger(ctx).Debugw("resource is skipped, no action needed",
+		"resource", resourceType, "namespace", resource.GetNamespace(), "name", resource.GetName(), "reason", reason,
+	)
+	retentionReason := RetentionReasonSkipAnnotation
+	switch reason {
+	case SkippedReasonMissingCondition:
+		retentionReason = RetentionReasonMissingCondition
+	case SkippedReasonResourceSelector:
+		retentionReason = RetentionReasonResourceSelector
+	}
+	RetentionTracker.Retain(resourceType, resource, retentionReason)
+	metrics.RecordResourceSkipped(ctx, resourceType, resource.GetNamespace(), reason)
+}
+
+// returns true, if the dry run is enabled on the namespace of the resource, without reporting the resource
+func isDryRunEnabled(resource metav1.Object) bool {
+	return PrunerConfigStore.IsDryRunEnabled(resource.GetNamespace())
+}
+
+// returns true, if the dry run is enabled on the namespace of the resource
+// the resource to be deleted is logged and counted, instead of the deletion
+func isDryRun(ctx context.Context, resourceType string, resource metav1.Object, policy PrunerPolicy) bool {
+	if !isDryRunEnabled(resource) {
+		return false
+	}
+	logger := logging.FromContext(ctx)
+	logger.Infow("dry run, the resource would be deleted",
+		"resource", resourceType, "namespace", resource.GetNamespace(), "name", resource.GetName(), "policy", policy,
+	)
+	metrics.RecordResourceDryRun(ctx, resourceType, resource.GetNamespace())
+	return true
+}
+
+// IsChildDeletable returns true, if a child resource can be deleted along with its parent
+// a child on legal hold, opted out with the skip annotation or on the dry run is retained
+func IsChildDeletable(ctx context.Context, resourceType string, child metav1.Object) bool {
+	if isOnLegalHold(child) {
+		perResourceLogger(ctx).Debugw("child resource is on legal hold, skipping the deletion",
+			"resource", resourceType, "namespace", child.GetNamespace(), "name", child.GetName(),
+		)
+		RetentionTracker.Retain(resourceType, child, RetentionReasonLegalHold)
+		return false
+	}
+	if isSkipped(child) {
+		reportSkipped(ctx, resourceType, child, SkippedReasonAnnotation)
+		return false
+	}
+	return !isDryRun(ctx, resourceType, child, PrunerPolicyChildCascade)
+}
+
+// IsLeaderForFunc returns a function to check the replica is the leader for a key of the controller
+// a controller not aware of the leader election, is the leader for all the keys
+func IsLeaderForFunc(impl *controller.Impl) func(key types.NamespacedName) bool {
+	leaderAware, ok := impl.Reconciler.(interface {
+		IsLeaderFor(key types.NamespacedName) bool
+	})
+	if !ok {
+		return func(key types.NamespacedName) bool { return true }
+	}
+	return leaderAware.IsLeaderFor
+}
+
+// ForgetOnDelete returns an informer delete handler, removes the deleted resources from the in-memory trackers
+// the resources can be deleted out of the pruner too
+func ForgetOnDelete(resourceType string) func(obj interface{}) {
+	return func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		resource, ok := obj.(metav1.Object)
+		if !ok {
+			return
+		}
+		RetentionTracker.Forget(resourceType, resource)
+		QueueLatencyTracker.Forget(resourceType, resource)
+		deletionAborted.forget(resource)
+		metrics.ForgetResource(resourceType, string(resource.GetUID()))
+	}
+}
+
+// UnchangedPreconditions returns the delete preconditions of the uid and the resource version of the resource
+// the deletion fails with a conflict, when the resource is changed or recreated since it is read
+func UnchangedPreconditions(resource metav1.Object) *metav1.Preconditions {
+	uid := resource.GetUID()
+	resourceVersion := resource.GetResourceVersion()
+	return &metav1.Preconditions{UID: &uid, ResourceVersion: &resourceVersion}
+}
+
+// updates an annotation on the resource
+// on a conflict, the resource is fetched again and the update is retried, up to the configured number of times
+func updateAnnotation(ctx context.Context, resourceType string, resource metav1.Object, key, value string,
+	getFn func(ctx context.Context, namespace, name string) (metav1.Object, error),
+	updateFn func(ctx context.Context, resource metav1.Object) error) error {
+	target := resource
+	return retry.RetryOnConflict(PrunerConfigStore.GetAnnotationUpdateBackoff(), func() error {
+		annotations := target.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[key] = value
+		target.SetAnnotations(annotations)
+
+		err := updateFn(ctx, target)
+		if errors.IsConflict(err) {
+			metrics.RecordUpdateConflict(ctx, resourceType, resource.GetNamespace())
+			latest, getErr := getFn(ctx, resource.GetNamespace(), resource.GetName())
+			if getErr != nil {
+				return getErr
+			}
+			target = latest
+		}
+		return err
+	})
+}
@@ -0,0 +1,44 @@
+package helper
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestRecreatedRunTrackedAsNew(t *testing.T) {
+	oldRun := &metav1.ObjectMeta{Namespace: "ns-recreated", Name: "run-1", UID: types.UID("uid-old")}
+	newRun := &metav1.ObjectMeta{Namespace: "ns-recreated", Name: "run-1", UID: types.UID("uid-new")}
+	completionTime := func(resource metav1.Object) (metav1.Time, error) { return resource.GetCreationTimestamp(), nil }
+	t.Cleanup(func() {
+		RetentionTracker.Forget(KindPipelineRun, newRun)
+		QueueLatencyTracker.Forget(KindPipelineRun, newRun)
+	})
+
+	// the old run is retained and its completion observed
+	RetentionTracker.Retain(KindPipelineRun, oldRun, RetentionReasonLegalHold)
+	QueueLatencyTracker.MarkEligible(context.Background(), KindPipelineRun, oldRun, completionTime)
+
+	// the run is recreated with the same name, the state of the old run is not inherited
+	if _, found := QueueLatencyTracker.takeLatency(KindPipelineRun, newRun); found {
+		t.Errorf("expected the recreated run to have no observed completion")
+	}
+	RetentionTracker.Retain(KindPipelineRun, newRun, RetentionReasonWithinTTL)
+	QueueLatencyTracker.MarkEligible(context.Background(), KindPipelineRun, newRun, completionTime)
+	breakdown := RetentionTracker.GetBreakdown("ns-recreated")
+	if breakdown[RetentionReasonLegalHold] != 1 || breakdown[RetentionReasonWithinTTL] != 1 {
+		t.Errorf("expected the old and the recreated runs to be tracked separately, got %v", breakdown)
+	}
+
+	// the late delete event of the old run does not drop the state of the recreated run
+	ForgetOnDelete(KindPipelineRun)(oldRun)
+	breakdown = RetentionTracker.GetBreakdown("ns-recreated")
+	if len(breakdown) != 1 || breakdown[RetentionReasonWithinTTL] != 1 {
+		t.Errorf("expected only the recreated run to be retained, got %v", breakdown)
+	}
+	if _, found := QueueLatencyTracker.takeLatency(KindPipelineRun, newRun); !found {
+		t.Errorf("expected the observed completion of the recreated run to be kept")
+	}
+}
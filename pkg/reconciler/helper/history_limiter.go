@@ -3,14 +3,21 @@ package helper
 import (
 	"context"
 	"fmt"
+	"math"
 	"slices"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	tektonprunerv1alpha1 "github.com/openshift-pipelines/tektoncd-pruner/pkg/apis/tektonpruner/v1alpha1"
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
 	"go.uber.org/zap"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clockUtil "k8s.io/utils/clock"
+	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/ptr"
 )
@@ -20,28 +27,63 @@ type HistoryLimiterResourceFuncs interface {
 	Get(ctx context.Context, namespace, name string) (metav1.Object, error)
 	Update(ctx context.Context, resource metav1.Object) error
 	Delete(ctx context.Context, namespace, name string) error
-	List(ctx context.Context, namespace, label string) ([]metav1.Object, error)
+	// deletes the resource, only if the uid and the resource version are not changed since the resource is read
+	DeleteUnchanged(ctx context.Context, resource metav1.Object) error
+	// deletes all the resources matching the label, as seen on the given resource version
+	DeleteCollection(ctx context.Context, namespace, label, resourceVersion string) error
+	// returns the resources matching the label and the resource version of the list,
+	// the resource version is empty, when the list is not a quorum read
+	List(ctx context.Context, namespace, label string) ([]metav1.Object, string, error)
+	// returns the resources matching the label from the informer cache, without an api call
+	ListFromCache(namespace, label string) ([]metav1.Object, error)
 	GetFailedHistoryLimitCount(namespace, name string) *int32
 	GetSuccessHistoryLimitCount(namespace, name string) *int32
+	GetCancelledHistoryLimitCount(namespace, name string) *int32
+	// returns the label keys to group the history
+	GetGroupByLabelKeys(namespace, name string) []string
 	IsSuccessful(resource metav1.Object) bool
 	IsFailed(resource metav1.Object) bool
+	// returns true, if the resource is cancelled, a cancelled resource is also failed
+	IsCancelled(resource metav1.Object) bool
 	IsCompleted(resource metav1.Object) bool
+	// returns the reason of the Succeeded condition
+	GetReason(resource metav1.Object) string
+	GetCompletionTime(resource metav1.Object) (metav1.Time, error)
 	GetDefaultLabelKey() string
 	GetEnforcedConfigLevel(namespace, name string) tektonprunerv1alpha1.EnforcedConfigLevel
 }
 
 type HistoryLimiter struct {
+	clock      clockUtil.Clock // the clock for tracking time
 	resourceFn HistoryLimiterResourceFuncs
+	// number of the workers deleting the resources, across the namespaces
+	activeDeleteWorkers atomic.Int64
+	// deletion windows of the maximum deletion fraction, per namespace
+	deletionWindowsMutex sync.Mutex
+	deletionWindows      map[string]*deletionWindow
 }
 
-func NewHistoryLimiter(resourceFn HistoryLimiterResourceFuncs) (*HistoryLimiter, error) {
+// resources deleted in a namespace since the start of the window, the budget is fixed at the start of the window
+type deletionWindow struct {
+	startedAt time.Time
+	budget    int
+	deleted   int
+}
+
+func NewHistoryLimiter(clock clockUtil.Clock, resourceFn HistoryLimiterResourceFuncs) (*HistoryLimiter, error) {
 	hl := &HistoryLimiter{
-		resourceFn: resourceFn,
+		clock:           clock,
+		resourceFn:      resourceFn,
+		deletionWindows: map[string]*deletionWindow{},
 	}
 	if hl.resourceFn == nil {
 		return nil, fmt.Errorf("resourceFunc interface can not be nil")
 	}
 
+	if hl.clock == nil {
+		hl.clock = clockUtil.RealClock{}
+	}
+
 	return hl, nil
 }
 
@@ -59,7 +101,29 @@ func (hl *HistoryLimiter) ProcessEvent(ctx context.Context, resource metav1.Obje
 		return nil
 	}
 
-	if hl.isProcessed(resource) {
+	// the resource with the skip annotation is not evaluated
+	if isSkipped(resource) {
+		reportSkipped(ctx, hl.resourceFn.Type(), resource, SkippedReasonAnnotation)
+		return nil
+	}
+
+	// the resource not matching the resource selector of the namespace is not evaluated
+	if !isSelected(resource) {
+		reportSkipped(ctx, hl.resourceFn.Type(), resource, SkippedReasonResourceSelector)
+		return nil
+	}
+
+	// a completed resource without the Succeeded condition is counted as failed, only on the failed policy
+	// on the maxAge policy, it is deleted by the ttl handler
+	switch getMissingConditionPolicy(resource, hl.resourceFn.IsCompleted) {
+	case MissingConditionPolicySkip:
+		reportSkipped(ctx, hl.resourceFn.Type(), resource, SkippedReasonMissingCondition)
+		return nil
+	case MissingConditionPolicyMaxAge:
+		return nil
+	}
+
+	if hl.isProcessed(ctx, resource) {
 		logger.Debugw("already processed",
 			"resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
 		)
@@ -74,17 +138,42 @@ func (hl *HistoryLimiter) ProcessEvent(ctx context.Context, resource metav1.Obje
 		return nil
 	}
 
-	defer hl.markAsProcessed(ctx, resource)
+	// the terminal status of a just completed resource may not be stable yet,
+	// evaluate it again after the completion grace period
+	if settleTimeLeft := hl.settleTimeLeft(resource); settleTimeLeft > 0 {
+		logger.Debugw("resource is not settled yet, will be evaluated later",
+			"resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
+			"waitDuration", settleTimeLeft,
+		)
+		return controller.NewRequeueAfter(settleTimeLeft)
+	}
 
+	logger.Debugw("evaluating the history limit",
+		"resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
+		"reason", hl.resourceFn.GetReason(resource), "successful", hl.resourceFn.IsSuccessful(resource),
+	)
+
+	var err error
 	if hl.resourceFn.IsSuccessful(resource) {
-		return hl.doSuccessfulResourceCleanup(ctx, resource)
+		err = hl.doSuccessfulResourceCleanup(ctx, resource)
+	} else if hl.isCountedAsCancelled(resource) {
+		err = hl.doCancelledResourceCleanup(ctx, resource)
+	} else if hl.resourceFn.IsFailed(resource) {
+		err = hl.doFailedResourceCleanup(ctx, resource)
 	}
 
-	if hl.resourceFn.IsFailed(resource) {
-		return hl.doFailedResourceCleanup(ctx, resource)
+	// the namespace budget is applied after the history limits
+	if err == nil {
+		err = hl.doNamespaceBudgetCleanup(ctx, resource)
 	}
 
-	return nil
+	// on requeue, the resource has to be evaluated again, do not mark it as processed
+	if isRequeueKey, _ := controller.IsRequeueKey(err); isRequeueKey {
+		return err
+	}
+
+	hl.markAsProcessed(ctx, resource)
+	return err
 }
 
 // adds an annotation, indicates this resource is already processed
@@ -108,15 +197,13 @@ func (hl *HistoryLimiter) markAsProcessed(ctx context.Context, resource metav1.O
 		return
 	}
 
-	processedTimeAsString := time.Now().Format(time.RFC3339)
-	annotations := resourceLatest.GetAnnotations()
-	if annotations == nil {
-		annotations = map[string]string{}
-	}
-	annotations[AnnotationHistoryLimitCheckProcessed] = processedTimeAsString
-	resourceLatest.SetAnnotations(annotations)
-	err = hl.resourceFn.Update(ctx, resourceLatest)
+	processedTimeAsString := hl.clock.Now().Format(time.RFC3339)
+	err = updateAnnotation(ctx, hl.resourceFn.Type(), resourceLatest, AnnotationHistoryLimitCheckProcessed, processedTimeAsString,
+		hl.resourceFn.Get, hl.resourceFn.Update)
 	if err != nil {
+		if errors.IsNotFound(err) {
+			return
+		}
 		logger := logging.FromContext(ctx)
 		logger.Errorw("error on updating 'mark as processed' on a resource",
 			"resource", hl.resourceFn.Type(), "namespace", resourceLatest.GetNamespace(), "name", resourceLatest.GetName(),
@@ -125,13 +212,39 @@ func (hl *HistoryLimiter) markAsProcessed(ctx context.Context, resource metav1.O
 	}
 }
 
-func (hl *HistoryLimiter) isProcessed(resource metav1.Object) bool {
+// a processed resource is evaluated again, if the processed annotation is older than the configured maximum age
+// helps to enforce the history limits periodically, the resource is evaluated on the next event or on the informer resync
+func (hl *HistoryLimiter) isProcessed(ctx context.Context, resource metav1.Object) bool {
 	annotations := resource.GetAnnotations()
 	if annotations == nil {
 		return false
 	}
-	_, found := annotations[AnnotationHistoryLimitCheckProcessed]
-	return found
+	processedTimeAsString, found := annotations[AnnotationHistoryLimitCheckProcessed]
+	if !found {
+		return false
+	}
+
+	maxAge := PrunerConfigStore.GetHistoryLimitCheckProcessedMaxAge()
+	if maxAge == nil {
+		return true
+	}
+
+	processedTime, err := time.Parse(time.RFC3339, processedTimeAsString)
+	if err != nil {
+		logger := logging.FromContext(ctx)
+		logger.Warnw("error on parsing processed time, the resource will be evaluated again",
+			"resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
+			"processedTime", processedTimeAsString,
+			zap.Error(err),
+		)
+		metrics.RecordHistoryReevaluation(ctx, hl.resourceFn.Type(), resource.GetNamespace(), "invalidAnnotation")
+		return false
+	}
+	if hl.clock.Since(processedTime) > *maxAge {
+		metrics.RecordHistoryReevaluation(ctx, hl.resourceFn.Type(), resource.GetNamespace(), "maxAgeExceeded")
+		return false
+	}
+	return true
 }
 
 func (hl *HistoryLimiter) doSuccessfulResourceCleanup(ctx context.Context, resource metav1.Object) error {
@@ -142,12 +255,51 @@ func (hl *HistoryLimiter) doFailedResourceCleanup(ctx context.Context, resource
 	return hl.doResourceCleanup(ctx, resource, AnnotationFailedHistoryLimit, hl.resourceFn.GetFailedHistoryLimitCount, hl.isFailedResource)
 }
 
+func (hl *HistoryLimiter) doCancelledResourceCleanup(ctx context.Context, resource metav1.Object) error {
+	return hl.doResourceCleanup(ctx, resource, AnnotationCancelledHistoryLimit, hl.resourceFn.GetCancelledHistoryLimitCount, hl.isCancelledResource)
+}
+
+// the cancelled resources are counted separately, only when the cancelled history limit is defined in the config,
+// otherwise counted as failed
+func (hl *HistoryLimiter) isCountedAsCancelled(resource metav1.Object) bool {
+	if !hl.resourceFn.IsCancelled(resource) {
+		return false
+	}
+	labelKey := getResourceNameLabelKey(resource, hl.resourceFn.GetDefaultLabelKey())
+	resourceName := getResourceName(resource, labelKey)
+	return hl.resourceFn.GetCancelledHistoryLimitCount(resource.GetNamespace(), resourceName) != nil
+}
+
 func (hl *HistoryLimiter) isFailedResource(resource metav1.Object) bool {
-	return hl.resourceFn.IsCompleted(resource) && hl.resourceFn.IsFailed(resource)
+	return hl.resourceFn.IsCompleted(resource) && hl.isSettled(resource) && hl.resourceFn.IsFailed(resource) && !hl.isCountedAsCancelled(resource)
+}
+
+func (hl *HistoryLimiter) isCancelledResource(resource metav1.Object) bool {
+	return hl.resourceFn.IsCompleted(resource) && hl.isSettled(resource) && hl.isCountedAsCancelled(resource)
 }
 
 func (hl *HistoryLimiter) isSuccessfulResource(resource metav1.Object) bool {
-	return hl.resourceFn.IsCompleted(resource) && hl.resourceFn.IsSuccessful(resource)
+	return hl.resourceFn.IsCompleted(resource) && hl.isSettled(resource) && hl.resourceFn.IsSuccessful(resource)
+}
+
+// a completed resource is settled, when the completion grace period is passed
+// only the settled resources are counted toward the history limits
+func (hl *HistoryLimiter) isSettled(resource metav1.Object) bool {
+	return hl.settleTimeLeft(resource) <= 0
+}
+
+// returns the remaining time of the completion grace period
+func (hl *HistoryLimiter) settleTimeLeft(resource metav1.Object) time.Duration {
+	grace := PrunerConfigStore.GetHistoryLimitCompletionGrace()
+	if grace <= 0 {
+		return 0
+	}
+	completionTime, err := hl.resourceFn.GetCompletionTime(resource)
+	if err != nil {
+		// can not determine the completion time, treat it as settled
+		return 0
+	}
+	return completionTime.Add(grace).Sub(hl.clock.Now())
 }
 
 func (hl *HistoryLimiter) doResourceCleanup(ctx context.Context, resource metav1.Object, historyLimitAnnotation string, getHistoryLimitFn func(string, string) *int32, getResourceFilterFn func(metav1.Object) bool) error {
@@ -162,6 +314,7 @@ func (hl *HistoryLimiter) doResourceCleanup(ctx context.Context, resource metav1
 	}
 
 	enforcedConfigLevel := hl.resourceFn.GetEnforcedConfigLevel(resource.GetNamespace(), resourceName)
+	metrics.ObserveEnforcedConfigLevel(hl.resourceFn.Type(), string(resource.GetUID()), string(enforcedConfigLevel))
 	var historyLimit *int32
 	// check the limit history from the resource annotations
 	annotations := resource.GetAnnotations()
@@ -190,32 +343,76 @@ func (hl *HistoryLimiter) doResourceCleanup(ctx context.Context, resource metav1
 
 	// get resource list with a label filter
 	label := fmt.Sprintf("%s=%s", labelKey, resourceName)
-	resources, err := hl.resourceFn.List(ctx, resource.GetNamespace(), label)
+	// the history is limited per distinct combination of the group by label values
+	for _, groupByKey := range hl.resourceFn.GetGroupByLabelKeys(resource.GetNamespace(), resourceName) {
+		if value, found := resource.GetLabels()[groupByKey]; found {
+			label = fmt.Sprintf("%s,%s=%s", label, groupByKey, value)
+		} else {
+			label = fmt.Sprintf("%s,!%s", label, groupByKey)
+		}
+	}
+	// only the resources matching the resource selector of the namespace are counted
+	if selector := PrunerConfigStore.GetResourceSelector(resource.GetNamespace()); selector != nil {
+		label = fmt.Sprintf("%s,%s", label, selector.String())
+	}
+	resources, resourceVersion, err := hl.resourceFn.List(ctx, resource.GetNamespace(), label)
 	if err != nil {
 		return err
 	}
+	listedCount := len(resources)
+
+	// the retry groups are resolved on all the listed resources, a retried run might not pass the filter
+	var groups map[types.UID]string
+	if PrunerConfigStore.IsCollapseRetriesEnabled() {
+		groups = retryGroups(resources)
+	}
 
 	// if the resource is within the count, no action is needed
 	if int(*historyLimit) > len(resources) {
+		hl.retainAll(resources, getResourceFilterFn)
 		return nil
 	}
 
-	// filter only completed resources
+	// filter only completed resources, the skipped resources are not counted
 	resourcesFiltered := []metav1.Object{}
 	for _, res := range resources {
-		if getResourceFilterFn(res) {
+		if getResourceFilterFn(res) && !isSkipped(res) && hl.isCountedOnMissingCondition(res) {
 			resourcesFiltered = append(resourcesFiltered, res)
 		}
 	}
 	// add the filtered result into resources
 	resources = resourcesFiltered
 
+	// number of the runs in the history, a run and its retries are counted as one with collapseRetries
+	historyCount := len(resources)
+	if groups != nil {
+		historyCount = countRetryGroups(resources, groups)
+	}
+
 	// recheck the count after filtered
 	// if the resource is within the count, no action is needed
-	if int(*historyLimit) > len(resources) {
+	if int(*historyLimit) > historyCount {
+		hl.retainAll(resources, getResourceFilterFn)
 		return nil
 	}
 
+	// with hysteresis, wait till the history exceeds the limit by the margin,
+	// then trim it down to the limit in one batch
+	hysteresis := PrunerConfigStore.GetHistoryLimitHysteresis()
+	if hysteresis > 0 && historyCount <= int(*historyLimit)+hysteresis {
+		logger.Debugw("history is within the hysteresis margin, no action needed",
+			"resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "label", label,
+			"historyLimit", *historyLimit, "hysteresis", hysteresis, "count", historyCount,
+		)
+		hl.retainAll(resources, getResourceFilterFn)
+		return nil
+	}
+
+	// number of resources over the limit, at the time of trimming
+	if overage := historyCount - int(*historyLimit); overage > 0 {
+		metrics.RecordHistoryOverage(ctx, hl.resourceFn.Type(), resource.GetNamespace(), overage)
+	}
+
 	slices.SortStableFunc(resources, func(a, b metav1.Object) int {
 		objA := a.GetCreationTimestamp()
 		objB := b.GetCreationTimestamp()
@@ -234,27 +431,324 @@ func (hl *HistoryLimiter) doResourceCleanup(ctx context.Context, resource metav1
 	if *historyLimit == 0 {
 		// remove all the history
 		selectionForDeletion = resources
+	} else if groups != nil {
+		// retain all the runs of the newest retry groups
+		var retained []metav1.Object
+		retained, selectionForDeletion = splitByRetryGroups(resources, groups, int(*historyLimit))
+		hl.retainAll(retained, getResourceFilterFn)
 	} else {
 		selectionForDeletion = resources[*historyLimit:]
+		hl.retainAll(resources[:*historyLimit], getResourceFilterFn)
 	}
 
-	for _, _res := range selectionForDeletion {
-		logger.Debugw("deleting a resource",
-			"resource", hl.resourceFn.Type(), "namespace", _res.GetNamespace(), "name", _res.GetName(),
-			"resourceCreationTimestamp", _res.GetCreationTimestamp(),
+	// delete all the selected resources in a single call, if it is safe
+	if hl.canDeleteCollection(selectionForDeletion, listedCount, resourceVersion) {
+		err = hl.resourceFn.DeleteCollection(ctx, resource.GetNamespace(), label, resourceVersion)
+		if err == nil {
+			logger.Debugw("deleted resources as a collection",
+				"resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "label", label, "count", len(selectionForDeletion),
+			)
+			for _, _res := range selectionForDeletion {
+				reason := hl.getDeletionReason(_res, DeletionReasonHistoryLimit)
+				metrics.RecordResourceDeleted(ctx, hl.resourceFn.Type(), _res.GetNamespace(), reason)
+				PruneTracker.Pruned(hl.resourceFn.Type(), _res.GetNamespace())
+				auditDeletion(hl.resourceFn.Type(), _res, reason, nil)
+				RetentionTracker.Forget(hl.resourceFn.Type(), _res)
+			}
+			return nil
+		}
+		// the list resource version might be compacted on the api server, delete one by one
+		logger.Debugw("error on deleting resources as a collection, deleting one by one",
+			"resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "label", label,
+			zap.Error(err),
 		)
-		err := hl.resourceFn.Delete(ctx, _res.GetNamespace(), _res.GetName())
-		if err != nil {
-			// ignore the error, if the resource is not found
-			if errors.IsNotFound(err) {
-				return nil
+	}
+
+	return hl.deleteSelection(ctx, resource.GetNamespace(), selectionForDeletion, DeletionReasonHistoryLimit)
+}
+
+// keeps at most the maximum total runs of the resource type in the namespace, across all the pipelines or tasks
+// applied after the history limits, the oldest completed runs are deleted first
+func (hl *HistoryLimiter) doNamespaceBudgetCleanup(ctx context.Context, resource metav1.Object) error {
+	logger := logging.FromContext(ctx)
+
+	maxTotalRuns := PrunerConfigStore.GetMaxTotalRuns(resource.GetNamespace())
+	if maxTotalRuns == nil {
+		return nil
+	}
+
+	// only the resources matching the resource selector of the namespace are counted
+	label := ""
+	if selector := PrunerConfigStore.GetResourceSelector(resource.GetNamespace()); selector != nil {
+		label = selector.String()
+	}
+	// counted from the informer cache first, the api server is listed only when the budget is exceeded
+	cached, err := hl.resourceFn.ListFromCache(resource.GetNamespace(), label)
+	if err != nil {
+		return err
+	}
+	if len(hl.getCountedCompleted(cached)) <= int(*maxTotalRuns) {
+		return nil
+	}
+
+	resources, _, err := hl.resourceFn.List(ctx, resource.GetNamespace(), label)
+	if err != nil {
+		return err
+	}
+	completed := hl.getCountedCompleted(resources)
+	if len(completed) <= int(*maxTotalRuns) {
+		return nil
+	}
+
+	// sort by the completion time, newer to older
+	// the completion time falls back to the creation time, if not known
+	completionTime := func(res metav1.Object) time.Time {
+		if completionTime, err := hl.resourceFn.GetCompletionTime(res); err == nil {
+			return completionTime.Time
+		}
+		return res.GetCreationTimestamp().Time
+	}
+	slices.SortStableFunc(completed, func(a, b metav1.Object) int {
+		return completionTime(b).Compare(completionTime(a))
+	})
+
+	logger.Debugw("completed resources exceed the maximum total runs of the namespace",
+		"resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(),
+		"maxTotalRuns", *maxTotalRuns, "count", len(completed),
+	)
+	return hl.deleteSelection(ctx, resource.GetNamespace(), completed[*maxTotalRuns:], DeletionReasonNamespaceBudget)
+}
+
+// returns the completed resources counted on the namespace budget and on the deletion fraction
+// the skipped resources and the resources in deletion state are not counted
+func (hl *HistoryLimiter) getCountedCompleted(resources []metav1.Object) []metav1.Object {
+	completed := []metav1.Object{}
+	for _, res := range resources {
+		if res.GetDeletionTimestamp() == nil && hl.resourceFn.IsCompleted(res) && hl.isSettled(res) && !isSkipped(res) && hl.isCountedOnMissingCondition(res) {
+			completed = append(completed, res)
+		}
+	}
+	return completed
+}
+
+// deletes the selected resources, except the resources on legal hold, waiting for the required annotation
+// or retained by a hook, the limitReason is reported on the deleted resources
+func (hl *HistoryLimiter) deleteSelection(ctx context.Context, namespace string, selectionForDeletion []metav1.Object, limitReason string) error {
+	logger := logging.FromContext(ctx)
+
+	abortedResources := []metav1.Object{}
+	// resources passed the checks and the hooks
+	toDelete := []metav1.Object{}
+	// minimum time left for the resources waiting for the required annotation
+	awaitingAnnotation := false
+	awaitingWaitLeft := time.Duration(0)
+	for _, _res := range selectionForDeletion {
+		// resource on legal hold should not be deleted
+		if isOnLegalHold(_res) {
+			logger.Debugw("resource is on legal hold, skipping the deletion",
+				"resource", hl.resourceFn.Type(), "namespace", _res.GetNamespace(), "name", _res.GetName(),
+			)
+			RetentionTracker.Retain(hl.resourceFn.Type(), _res, RetentionReasonLegalHold)
+			continue
+		}
+		// resource without the required annotation should not be deleted, until the maximum wait
+		if awaiting, waitLeft := hl.isAwaitingRequiredAnnotation(_res); awaiting {
+			logger.Debugw("resource is waiting for the required annotation, skipping the deletion",
+				"resource", hl.resourceFn.Type(), "namespace", _res.GetNamespace(), "name", _res.GetName(),
+			)
+			RetentionTracker.Retain(hl.resourceFn.Type(), _res, RetentionReasonAwaitingAnnotation)
+			if !awaitingAnnotation || (waitLeft > 0 && (awaitingWaitLeft == 0 || waitLeft < awaitingWaitLeft)) {
+				awaitingWaitLeft = waitLeft
 			}
-			logger.Errorw("error on removing a resource",
+			awaitingAnnotation = true
+			continue
+		}
+		// the resource is only reported on the dry run
+		if isDryRun(ctx, hl.resourceFn.Type(), _res, PrunerPolicyHistoryLimit) {
+			continue
+		}
+		// a hook can abort the deletion
+		if err := runBeforeDeleteHooks(ctx, _res); err != nil {
+			logger.Infow("deletion aborted by a hook",
 				"resource", hl.resourceFn.Type(), "namespace", _res.GetNamespace(), "name", _res.GetName(),
 				zap.Error(err),
 			)
+			RetentionTracker.Retain(hl.resourceFn.Type(), _res, RetentionReasonDeletionHook)
+			abortedResources = append(abortedResources, _res)
+			continue
 		}
+		toDelete = append(toDelete, _res)
+	}
+
+	// the sweeps over the maximum deletion fraction are capped, the rest are deferred
+	toDelete, err := hl.capDeletionFraction(ctx, namespace, toDelete)
+	if err != nil {
+		return err
+	}
+
+	// the resources are deleted in parallel, bounded to the delete concurrency of the namespace
+	hl.deleteResources(ctx, toDelete, PrunerConfigStore.GetDeleteConcurrency(namespace), limitReason)
+
+	// evaluate the history again later, for the resources retained by a hook
+	if len(abortedResources) > 0 {
+		return deletionAbortedRequeue(abortedResources...)
+	}
+
+	// evaluate the history again later, for the resources waiting for the required annotation
+	if awaitingAnnotation {
+		return awaitingRequiredAnnotationRequeue(awaitingWaitLeft)
 	}
 
 	return nil
 }
+
+// limits the resources to delete to the maximum deletion fraction of the completed resources of the namespace
+// the fraction is counted on the completed resources at the start of the window, and shared by all the sweeps
+// of the namespace within the window, the deferred resources are deleted on an event after the window
+// the selection is sorted newer to older, the oldest resources are kept for the deletion
+func (hl *HistoryLimiter) capDeletionFraction(ctx context.Context, namespace string, toDelete []metav1.Object) ([]metav1.Object, error) {
+	fraction := PrunerConfigStore.GetMaxDeletionFractionPerNamespace()
+	if fraction == nil || len(toDelete) == 0 {
+		return toDelete, nil
+	}
+
+	hl.deletionWindowsMutex.Lock()
+	window, found := hl.deletionWindows[namespace]
+	if !found || hl.clock.Since(window.startedAt) >= DefaultDeletionFractionWindow {
+		cached, err := hl.resourceFn.ListFromCache(namespace, "")
+		if err != nil {
+			hl.deletionWindowsMutex.Unlock()
+			return nil, err
+		}
+		window = &deletionWindow{
+			startedAt: hl.clock.Now(),
+			budget:    int(math.Floor(*fraction * float64(len(hl.getCountedCompleted(cached))))),
+		}
+		hl.deletionWindows[namespace] = window
+	}
+	allowed := max(window.budget-window.deleted, 0)
+	if len(toDelete) <= allowed {
+		window.deleted += len(toDelete)
+		hl.deletionWindowsMutex.Unlock()
+		return toDelete, nil
+	}
+	// the allowed resources are taken from the budget, before the deletion, the concurrent sweeps see the rest only
+	window.deleted += allowed
+	budget, windowStartedAt := window.budget, window.startedAt
+	hl.deletionWindowsMutex.Unlock()
+
+	logging.FromContext(ctx).Warnw("deletion exceeds the maximum deletion fraction of the namespace, likely a misconfiguration, the rest of the resources are deferred",
+		"resource", hl.resourceFn.Type(), "namespace", namespace, "maxDeletionFractionPerNamespace", *fraction,
+		"windowBudget", budget, "windowStartedAt", windowStartedAt.UTC(), "selectedCount", len(toDelete), "allowedCount", allowed,
+	)
+	metrics.RecordDeletionFractionCap(ctx, hl.resourceFn.Type(), namespace)
+	return toDelete[len(toDelete)-allowed:], nil
+}
+
+// deletes the resources with the given number of workers
+// a resource already deleted by another event does not stop the deletion of the remaining resources
+// the client side rate limiter of the kubernetes client still applies, the workers wait on it
+func (hl *HistoryLimiter) deleteResources(ctx context.Context, resources []metav1.Object, concurrency int, limitReason string) {
+	logger := logging.FromContext(ctx)
+
+	var wg sync.WaitGroup
+	workQueue := make(chan metav1.Object)
+	for worker := 0; worker < concurrency && worker < len(resources); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			metrics.RecordActiveDeleteWorkers(ctx, hl.resourceFn.Type(), hl.activeDeleteWorkers.Add(1))
+			defer func() {
+				metrics.RecordActiveDeleteWorkers(ctx, hl.resourceFn.Type(), hl.activeDeleteWorkers.Add(-1))
+			}()
+			for _res := range workQueue {
+				reason := hl.getDeletionReason(_res, limitReason)
+				perResourceLogger(ctx).Debugw("deleting a resource",
+					"resource", hl.resourceFn.Type(), "namespace", _res.GetNamespace(), "name", _res.GetName(),
+					"resourceCreationTimestamp", _res.GetCreationTimestamp(), "reason", reason,
+				)
+				err := hl.resourceFn.DeleteUnchanged(ctx, _res)
+				if err != nil {
+					// ignore the error, if the resource is not found
+					if errors.IsNotFound(err) {
+						continue
+					}
+					// the resource is changed since the listing, can be on hold now, evaluated again on its update event
+					if errors.IsConflict(err) {
+						logger.Debugw("resource is changed since the listing, skipping the deletion",
+							"resource", hl.resourceFn.Type(), "namespace", _res.GetNamespace(), "name", _res.GetName(),
+						)
+						continue
+					}
+					logger.Errorw("error on removing a resource",
+						"resource", hl.resourceFn.Type(), "namespace", _res.GetNamespace(), "name", _res.GetName(),
+						zap.Error(err),
+					)
+					continue
+				}
+				metrics.RecordResourceDeleted(ctx, hl.resourceFn.Type(), _res.GetNamespace(), reason)
+				PruneTracker.Pruned(hl.resourceFn.Type(), _res.GetNamespace())
+				auditDeletion(hl.resourceFn.Type(), _res, reason, nil)
+				RetentionTracker.Forget(hl.resourceFn.Type(), _res)
+				runAfterDeleteHooks(ctx, _res)
+			}
+		}()
+	}
+
+	for _, _res := range resources {
+		workQueue <- _res
+	}
+	close(workQueue)
+	wg.Wait()
+}
+
+// a resource without the Succeeded condition is counted toward the history limits, only on the failed policy
+func (hl *HistoryLimiter) isCountedOnMissingCondition(resource metav1.Object) bool {
+	policy := getMissingConditionPolicy(resource, hl.resourceFn.IsCompleted)
+	return policy == "" || policy == MissingConditionPolicyFailed
+}
+
+// records the completed resources kept within the history limit
+func (hl *HistoryLimiter) retainAll(resources []metav1.Object, getResourceFilterFn func(metav1.Object) bool) {
+	for _, _res := range resources {
+		if getResourceFilterFn(_res) {
+			RetentionTracker.Retain(hl.resourceFn.Type(), _res, RetentionReasonWithinHistoryLimit)
+		}
+	}
+}
+
+// a collection delete is safe, only when the label selector matches exactly with the resources selected for deletion
+// - all the listed resources are selected for deletion
+// - none of the resources is on legal hold or waiting for the required annotation
+// - the list is a quorum read with the resource version known, the resources created after the listing are not deleted
+// - there is no deletion hook registered, the hooks are invoked around each deletion
+// - the dry run is not enabled on any of the resources, the resources are reported one by one
+// - the maximum deletion fraction is not configured, the deletion is capped one by one
+// a list served from the api server cache can miss the latest hold or skip annotations, deleted one by one then
+func (hl *HistoryLimiter) canDeleteCollection(selectionForDeletion []metav1.Object, listedCount int, resourceVersion string) bool {
+	if hasDeletionHooks() || resourceVersion == "" || len(selectionForDeletion) == 0 || len(selectionForDeletion) != listedCount {
+		return false
+	}
+	if PrunerConfigStore.GetMaxDeletionFractionPerNamespace() != nil {
+		return false
+	}
+	for _, _res := range selectionForDeletion {
+		// the same checks as the deletion one by one, not reported here
+		if isOnLegalHold(_res) || isDryRunEnabled(_res) {
+			return false
+		}
+		if awaiting, _ := hl.isAwaitingRequiredAnnotation(_res); awaiting {
+			return false
+		}
+	}
+	return true
+}
+
+// returns true, if the resource waits for the required annotation, with the time left to wait
+func (hl *HistoryLimiter) isAwaitingRequiredAnnotation(resource metav1.Object) (bool, time.Duration) {
+	completionTime, err := hl.resourceFn.GetCompletionTime(resource)
+	if err != nil {
+		return false, 0
+	}
+	return isAwaitingRequiredAnnotation(resource, completionTime, hl.clock.Now())
+}
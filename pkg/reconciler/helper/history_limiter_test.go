@@ -0,0 +1,489 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	tektonprunerv1alpha1 "github.com/openshift-pipelines/tektoncd-pruner/pkg/apis/tektonpruner/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/ptr"
+)
+
+// completed resources of a namespace, deleted in memory
+type fakeHistoryLimiterResourceFuncs struct {
+	resources       []metav1.Object
+	resourceVersion string
+	deleted         []string
+	// history limit of the successful resources, nil if not limited
+	successfulHistoryLimit *int32
+	// the collection delete removes all the resources, when supported
+	collectionDeleteSupported bool
+	// resource versions of the collection delete calls
+	collectionDeletes []string
+}
+
+func (f *fakeHistoryLimiterResourceFuncs) Type() string { return KindPipelineRun }
+
+func (f *fakeHistoryLimiterResourceFuncs) Get(ctx context.Context, namespace, name string) (metav1.Object, error) {
+	for _, res := range f.resources {
+		if res.GetNamespace() == namespace && res.GetName() == name {
+			return res, nil
+		}
+	}
+	return nil, fmt.Errorf("resource '%s/%s' not found", namespace, name)
+}
+
+func (f *fakeHistoryLimiterResourceFuncs) Update(ctx context.Context, resource metav1.Object) error {
+	return nil
+}
+
+func (f *fakeHistoryLimiterResourceFuncs) Delete(ctx context.Context, namespace, name string) error {
+	for index, res := range f.resources {
+		if res.GetNamespace() == namespace && res.GetName() == name {
+			f.resources = append(f.resources[:index], f.resources[index+1:]...)
+			f.deleted = append(f.deleted, name)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (f *fakeHistoryLimiterResourceFuncs) DeleteUnchanged(ctx context.Context, resource metav1.Object) error {
+	return f.Delete(ctx, resource.GetNamespace(), resource.GetName())
+}
+
+func (f *fakeHistoryLimiterResourceFuncs) DeleteCollection(ctx context.Context, namespace, label, resourceVersion string) error {
+	f.collectionDeletes = append(f.collectionDeletes, resourceVersion)
+	if !f.collectionDeleteSupported {
+		return fmt.Errorf("collection delete is not supported")
+	}
+	for _, res := range f.resources {
+		f.deleted = append(f.deleted, res.GetName())
+	}
+	f.resources = nil
+	return nil
+}
+
+func (f *fakeHistoryLimiterResourceFuncs) List(ctx context.Context, namespace, label string) ([]metav1.Object, string, error) {
+	return append([]metav1.Object{}, f.resources...), f.resourceVersion, nil
+}
+
+func (f *fakeHistoryLimiterResourceFuncs) ListFromCache(namespace, label string) ([]metav1.Object, error) {
+	return append([]metav1.Object{}, f.resources...), nil
+}
+
+func (f *fakeHistoryLimiterResourceFuncs) GetFailedHistoryLimitCount(namespace, name string) *int32 {
+	return nil
+}
+
+func (f *fakeHistoryLimiterResourceFuncs) GetSuccessHistoryLimitCount(namespace, name string) *int32 {
+	return f.successfulHistoryLimit
+}
+
+func (f *fakeHistoryLimiterResourceFuncs) GetCancelledHistoryLimitCount(namespace, name string) *int32 {
+	return nil
+}
+
+func (f *fakeHistoryLimiterResourceFuncs) GetGroupByLabelKeys(namespace, name string) []string {
+	return nil
+}
+
+func (f *fakeHistoryLimiterResourceFuncs) IsSuccessful(resource metav1.Object) bool { return true }
+func (f *fakeHistoryLimiterResourceFuncs) IsFailed(resource metav1.Object) bool     { return false }
+func (f *fakeHistoryLimiterResourceFuncs) IsCancelled(resource metav1.Object) bool  { return false }
+func (f *fakeHistoryLimiterResourceFuncs) IsCompleted(resource metav1.Object) bool  { return true }
+func (f *fakeHistoryLimiterResourceFuncs) GetReason(resource metav1.Object) string  { return "" }
+
+func (f *fakeHistoryLimiterResourceFuncs) GetCompletionTime(resource metav1.Object) (metav1.Time, error) {
+	return resource.GetCreationTimestamp(), nil
+}
+
+func (f *fakeHistoryLimiterResourceFuncs) GetDefaultLabelKey() string { return LabelPipelineName }
+
+func (f *fakeHistoryLimiterResourceFuncs) GetEnforcedConfigLevel(namespace, name string) tektonprunerv1alpha1.EnforcedConfigLevel {
+	return tektonprunerv1alpha1.EnforcedConfigLevelResource
+}
+
+// returns the given number of resources of the same pipeline, created a minute apart, older to newer
+// the completion time of the fake resources is the creation time
+func newFakeResources(namespace string, count int) []metav1.Object {
+	createdAt := time.Now().Add(-time.Duration(count) * time.Minute)
+	resources := []metav1.Object{}
+	for index := 0; index < count; index++ {
+		resources = append(resources, &metav1.ObjectMeta{
+			Namespace:         namespace,
+			Name:              fmt.Sprintf("run-%d", index),
+			UID:               types.UID(fmt.Sprintf("uid-%d", index)),
+			Labels:            map[string]string{LabelPipelineName: "foo"},
+			CreationTimestamp: metav1.NewTime(createdAt.Add(time.Duration(index) * time.Minute)),
+		})
+	}
+	return resources
+}
+
+func loadTestGlobalConfig(t *testing.T, config string) {
+	t.Helper()
+	err := PrunerConfigStore.LoadGlobalConfig(&corev1.ConfigMap{Data: map[string]string{PrunerGlobalConfigKey: config}})
+	if err != nil {
+		t.Fatalf("error on loading the global config: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = PrunerConfigStore.LoadGlobalConfig(&corev1.ConfigMap{})
+	})
+}
+
+func TestNamespaceBudgetCappedByDeletionFraction(t *testing.T) {
+	// the namespace budget of zero runs wipes the namespace, without the deletion fraction
+	loadTestGlobalConfig(t, `
+maxDeletionFractionPerNamespace: 0.5
+namespaces:
+  ns-1:
+    maxTotalRuns: 0
+`)
+	resourceFn := &fakeHistoryLimiterResourceFuncs{resources: newFakeResources("ns-1", 10), resourceVersion: "1"}
+	hl, err := NewHistoryLimiter(nil, resourceFn)
+	if err != nil {
+		t.Fatalf("error on getting history limiter: %v", err)
+	}
+
+	// the deferred resources wait for the next event, no requeue
+	err = hl.doNamespaceBudgetCleanup(context.Background(), resourceFn.resources[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resourceFn.deleted) != 5 {
+		t.Fatalf("expected 5 deleted resources, got %d: %v", len(resourceFn.deleted), resourceFn.deleted)
+	}
+	// the oldest resources are deleted first
+	for _, res := range resourceFn.resources {
+		for _, name := range []string{"run-0", "run-1", "run-2", "run-3", "run-4"} {
+			if res.GetName() == name {
+				t.Errorf("expected the oldest resource %s to be deleted", name)
+			}
+		}
+	}
+}
+
+func TestDeletionFractionSharedWithinWindow(t *testing.T) {
+	loadTestGlobalConfig(t, `
+maxDeletionFractionPerNamespace: 0.5
+namespaces:
+  ns-1:
+    maxTotalRuns: 0
+`)
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	resourceFn := &fakeHistoryLimiterResourceFuncs{resources: newFakeResources("ns-1", 10), resourceVersion: "1"}
+	hl, err := NewHistoryLimiter(fakeClock, resourceFn)
+	if err != nil {
+		t.Fatalf("error on getting history limiter: %v", err)
+	}
+
+	// several reconciles within the window delete no more than the fraction in total
+	for i := 0; i < 3; i++ {
+		if err := hl.doNamespaceBudgetCleanup(context.Background(), resourceFn.resources[0]); err != nil {
+			t.Fatalf("unexpected error on reconcile %d: %v", i, err)
+		}
+		if len(resourceFn.deleted) != 5 {
+			t.Fatalf("expected 5 deleted resources after reconcile %d, got %d: %v", i, len(resourceFn.deleted), resourceFn.deleted)
+		}
+	}
+
+	// the next window takes the fraction of the remaining resources
+	fakeClock.Step(DefaultDeletionFractionWindow)
+	if err := hl.doNamespaceBudgetCleanup(context.Background(), resourceFn.resources[0]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resourceFn.deleted) != 7 {
+		t.Fatalf("expected 7 deleted resources in the next window, got %d: %v", len(resourceFn.deleted), resourceFn.deleted)
+	}
+}
+
+func TestNamespaceBudgetWithinDeletionFraction(t *testing.T) {
+	loadTestGlobalConfig(t, `
+maxDeletionFractionPerNamespace: 0.5
+namespaces:
+  ns-1:
+    maxTotalRuns: 6
+`)
+	resourceFn := &fakeHistoryLimiterResourceFuncs{resources: newFakeResources("ns-1", 10), resourceVersion: "1"}
+	hl, err := NewHistoryLimiter(nil, resourceFn)
+	if err != nil {
+		t.Fatalf("error on getting history limiter: %v", err)
+	}
+
+	err = hl.doNamespaceBudgetCleanup(context.Background(), resourceFn.resources[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resourceFn.deleted) != 4 {
+		t.Fatalf("expected 4 deleted resources, got %d: %v", len(resourceFn.deleted), resourceFn.deleted)
+	}
+}
+
+// aborts all the deletions
+type abortDeletionHook struct{}
+
+func (h *abortDeletionHook) BeforeDelete(ctx context.Context, resource metav1.Object) error {
+	return fmt.Errorf("deletion aborted")
+}
+
+func (h *abortDeletionHook) AfterDelete(ctx context.Context, resource metav1.Object) {}
+
+func TestCanDeleteCollection(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          string
+		hook            DeletionHook
+		annotations     map[string]string
+		listedCount     int
+		resourceVersion string
+		expected        bool
+	}{
+		{
+			name:            "all the listed resources selected",
+			listedCount:     3,
+			resourceVersion: "1",
+			expected:        true,
+		},
+		{
+			name:            "resource on legal hold",
+			annotations:     map[string]string{AnnotationLegalHold: "true"},
+			listedCount:     3,
+			resourceVersion: "1",
+		},
+		{
+			name:            "deletion hook registered",
+			hook:            &abortDeletionHook{},
+			listedCount:     3,
+			resourceVersion: "1",
+		},
+		{
+			name:            "label selector matches more resources than selected",
+			listedCount:     4,
+			resourceVersion: "1",
+		},
+		{
+			name:        "resource version not known",
+			listedCount: 3,
+		},
+		{
+			name: "dry run on the namespace",
+			config: `
+namespaces:
+  ns-1:
+    dryRun: true
+`,
+			listedCount:     3,
+			resourceVersion: "1",
+		},
+		{
+			name:            "maximum deletion fraction configured",
+			config:          "maxDeletionFractionPerNamespace: 1",
+			listedCount:     3,
+			resourceVersion: "1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loadTestGlobalConfig(t, test.config)
+			if test.hook != nil {
+				RegisterDeletionHook(test.hook)
+				t.Cleanup(func() {
+					deletionHooks.mutex.Lock()
+					defer deletionHooks.mutex.Unlock()
+					deletionHooks.hooks = nil
+				})
+			}
+			resources := newFakeResources("ns-1", 3)
+			resources[1].SetAnnotations(test.annotations)
+
+			hl, err := NewHistoryLimiter(nil, &fakeHistoryLimiterResourceFuncs{resources: resources})
+			if err != nil {
+				t.Fatalf("error on getting history limiter: %v", err)
+			}
+			if actual := hl.canDeleteCollection(resources, test.listedCount, test.resourceVersion); actual != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDeleteCollectionCallPath(t *testing.T) {
+	tests := []struct {
+		name                      string
+		resourceVersion           string
+		collectionDeleteSupported bool
+		expectedCollectionDeletes []string
+	}{
+		{
+			name:                      "quorum list deletes as a collection",
+			resourceVersion:           "1",
+			collectionDeleteSupported: true,
+			expectedCollectionDeletes: []string{"1"},
+		},
+		{
+			name:                      "failed collection delete falls back to one by one",
+			resourceVersion:           "1",
+			expectedCollectionDeletes: []string{"1"},
+		},
+		{
+			name:                      "list served from the cache deletes one by one",
+			collectionDeleteSupported: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loadTestGlobalConfig(t, "")
+			resourceFn := &fakeHistoryLimiterResourceFuncs{
+				resources:                 newFakeResources("ns-1", 3),
+				resourceVersion:           test.resourceVersion,
+				successfulHistoryLimit:    ptr.Int32(0),
+				collectionDeleteSupported: test.collectionDeleteSupported,
+			}
+			hl, err := NewHistoryLimiter(nil, resourceFn)
+			if err != nil {
+				t.Fatalf("error on getting history limiter: %v", err)
+			}
+
+			if err := hl.ProcessEvent(context.Background(), resourceFn.resources[0]); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(resourceFn.collectionDeletes, test.expectedCollectionDeletes) {
+				t.Errorf("expected the collection deletes %v, got %v", test.expectedCollectionDeletes, resourceFn.collectionDeletes)
+			}
+			if len(resourceFn.deleted) != 3 || len(resourceFn.resources) != 0 {
+				t.Errorf("expected all the resources to be deleted, got deleted %v, remaining %d", resourceFn.deleted, len(resourceFn.resources))
+			}
+		})
+	}
+}
+
+func TestHistoryLimitHysteresis(t *testing.T) {
+	loadTestGlobalConfig(t, "historyLimitHysteresis: 2")
+	resourceFn := &fakeHistoryLimiterResourceFuncs{resources: newFakeResources("ns-1", 6), successfulHistoryLimit: ptr.Int32(3)}
+	// the history grows a run at a time, starts within the margin
+	pending := resourceFn.resources[5:]
+	resourceFn.resources = resourceFn.resources[:5]
+	hl, err := NewHistoryLimiter(nil, resourceFn)
+	if err != nil {
+		t.Fatalf("error on getting history limiter: %v", err)
+	}
+
+	// the history exceeds the limit within the margin, nothing is deleted
+	if err := hl.ProcessEvent(context.Background(), resourceFn.resources[4]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resourceFn.deleted) != 0 {
+		t.Fatalf("expected no deletion within the hysteresis margin, got: %v", resourceFn.deleted)
+	}
+
+	// the history exceeds the margin, trimmed down to the limit in one batch
+	resourceFn.resources = append(resourceFn.resources, pending...)
+	if err := hl.ProcessEvent(context.Background(), resourceFn.resources[5]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	slices.Sort(resourceFn.deleted)
+	if expected := []string{"run-0", "run-1", "run-2"}; !slices.Equal(resourceFn.deleted, expected) {
+		t.Fatalf("expected the oldest resources %v to be deleted, got: %v", expected, resourceFn.deleted)
+	}
+	if len(resourceFn.resources) != 3 {
+		t.Errorf("expected the history to be trimmed to the limit of 3, got %d", len(resourceFn.resources))
+	}
+}
+
+func TestStaleProcessedAnnotationEvaluatedAgain(t *testing.T) {
+	loadTestGlobalConfig(t, "historyLimitCheckProcessedMaxAgeSeconds: 3600")
+	now := time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC)
+	fakeClock := clocktesting.NewFakeClock(now)
+	hl, err := NewHistoryLimiter(fakeClock, &fakeHistoryLimiterResourceFuncs{})
+	if err != nil {
+		t.Fatalf("error on getting history limiter: %v", err)
+	}
+
+	resource := newFakeResources("ns-1", 1)[0]
+	resource.SetAnnotations(map[string]string{AnnotationHistoryLimitCheckProcessed: now.Add(-30 * time.Minute).Format(time.RFC3339)})
+	if !hl.isProcessed(context.Background(), resource) {
+		t.Errorf("expected the resource processed within the maximum age to be skipped")
+	}
+
+	// the processed annotation gets older than the maximum age, without a config change
+	fakeClock.Step(time.Hour)
+	if hl.isProcessed(context.Background(), resource) {
+		t.Errorf("expected the resource with the stale processed annotation to be evaluated again")
+	}
+}
+
+func TestRunCountedAfterCompletionGrace(t *testing.T) {
+	loadTestGlobalConfig(t, "historyLimitCompletionGraceSeconds: 90")
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	// the newest resource is completed a minute ago, within the grace period
+	resourceFn := &fakeHistoryLimiterResourceFuncs{resources: newFakeResources("ns-1", 4), successfulHistoryLimit: ptr.Int32(3)}
+	hl, err := NewHistoryLimiter(fakeClock, resourceFn)
+	if err != nil {
+		t.Fatalf("error on getting history limiter: %v", err)
+	}
+	newest := resourceFn.resources[3]
+
+	err = hl.ProcessEvent(context.Background(), newest)
+	if isRequeueKey, _ := controller.IsRequeueKey(err); !isRequeueKey {
+		t.Fatalf("expected a requeue for the resource within the grace period, got: %v", err)
+	}
+	// the resource within the grace period is not counted by the other resources either
+	if err := hl.ProcessEvent(context.Background(), resourceFn.resources[2]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resourceFn.deleted) != 0 {
+		t.Fatalf("expected no deletion within the grace period, got: %v", resourceFn.deleted)
+	}
+
+	// the status is settled, the resource is counted and the oldest resource is over the limit
+	fakeClock.Step(time.Minute)
+	if err := hl.ProcessEvent(context.Background(), newest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resourceFn.deleted) != 1 || resourceFn.deleted[0] != "run-0" {
+		t.Fatalf("expected the oldest resource to be deleted, got: %v", resourceFn.deleted)
+	}
+}
+
+func TestRequiredAnnotationMaxWaitBoundary(t *testing.T) {
+	loadTestGlobalConfig(t, `
+requireAnnotationBeforePrune:
+  key: archive.example.com/done
+  maxWaitSeconds: 60
+`)
+	completedAt := time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC)
+	fakeClock := clocktesting.NewFakeClock(completedAt.Add(59 * time.Second))
+	hl, err := NewHistoryLimiter(fakeClock, &fakeHistoryLimiterResourceFuncs{})
+	if err != nil {
+		t.Fatalf("error on getting history limiter: %v", err)
+	}
+	resource := &metav1.ObjectMeta{Namespace: "ns-1", Name: "run-0", CreationTimestamp: metav1.NewTime(completedAt)}
+
+	awaiting, waitLeft := hl.isAwaitingRequiredAnnotation(resource)
+	if !awaiting || waitLeft != time.Second {
+		t.Errorf("expected to wait for a second before the maximum wait, got awaiting:%v, waitLeft:%s", awaiting, waitLeft)
+	}
+
+	// exactly at the maximum wait, the resource is prunable without the annotation
+	fakeClock.Step(time.Second)
+	if awaiting, _ := hl.isAwaitingRequiredAnnotation(resource); awaiting {
+		t.Errorf("expected the resource to be prunable at the maximum wait")
+	}
+
+	// the annotation makes the resource prunable before the maximum wait
+	fakeClock.SetTime(completedAt)
+	resource.SetAnnotations(map[string]string{"archive.example.com/done": "true"})
+	if awaiting, _ := hl.isAwaitingRequiredAnnotation(resource); awaiting {
+		t.Errorf("expected the annotated resource to be prunable")
+	}
+}
@@ -0,0 +1,64 @@
+package helper
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// lists a page of the resources, returns the resources with the list meta of the page
+type ListPageFunc func(ctx context.Context, options metav1.ListOptions) ([]metav1.Object, metav1.ListMeta, error)
+
+// ListEach lists the resources page by page, invokes the given function on each page, the memory is bounded by the page size
+// the pages are served from a consistent snapshot, the resource version of the snapshot is returned
+// the continue token can expire between the pages, the expired error is returned, the received pages are not consistent anymore
+// note: the api server ignores the limit when the list is served from the cache (resource version "0")
+func ListEach(ctx context.Context, options metav1.ListOptions, listPage ListPageFunc, pageFn func([]metav1.Object) error) (string, error) {
+	if options.Limit == 0 {
+		options.Limit = DefaultListPageSize
+	}
+	resourceVersion := ""
+	for {
+		resources, listMeta, err := listPage(ctx, options)
+		if err != nil {
+			return "", err
+		}
+		// the resource version of the first page identifies the snapshot,
+		// the resource version can not be set along with the continue token
+		if options.Continue == "" {
+			resourceVersion = listMeta.ResourceVersion
+			options.ResourceVersion = ""
+		}
+		if err := pageFn(resources); err != nil {
+			return "", err
+		}
+		if listMeta.Continue == "" {
+			return resourceVersion, nil
+		}
+		options.Continue = listMeta.Continue
+	}
+}
+
+// ListAll lists all the resources page by page
+// when the continue token expires between the pages, the listing starts over with a fresh snapshot, once
+// returns the resource version of the list, only on a quorum read, a list served from the api server cache can be stale
+func ListAll(ctx context.Context, options metav1.ListOptions, listPage ListPageFunc) ([]metav1.Object, string, error) {
+	for attempt := 0; ; attempt++ {
+		resources := []metav1.Object{}
+		resourceVersion, err := ListEach(ctx, options, listPage, func(page []metav1.Object) error {
+			resources = append(resources, page...)
+			return nil
+		})
+		if err != nil {
+			if errors.IsResourceExpired(err) && attempt == 0 {
+				continue
+			}
+			return nil, "", err
+		}
+		if options.ResourceVersion != "" {
+			resourceVersion = ""
+		}
+		return resources, resourceVersion, nil
+	}
+}
@@ -0,0 +1,36 @@
+package helper
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestListAllResourceVersionOnQuorumReadOnly(t *testing.T) {
+	tests := []struct {
+		name                    string
+		listResourceVersion     string
+		expectedResourceVersion string
+	}{
+		{name: "quorum read", listResourceVersion: "", expectedResourceVersion: "42"},
+		{name: "api server cache", listResourceVersion: "0", expectedResourceVersion: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			listPage := func(ctx context.Context, options metav1.ListOptions) ([]metav1.Object, metav1.ListMeta, error) {
+				return []metav1.Object{&metav1.ObjectMeta{Name: "run-0"}}, metav1.ListMeta{ResourceVersion: "42"}, nil
+			}
+			resources, resourceVersion, err := ListAll(context.Background(), metav1.ListOptions{ResourceVersion: test.listResourceVersion}, listPage)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(resources) != 1 {
+				t.Fatalf("expected 1 listed resource, got %d", len(resources))
+			}
+			if resourceVersion != test.expectedResourceVersion {
+				t.Errorf("expected the resource version %q, got %q", test.expectedResourceVersion, resourceVersion)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package helper
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"knative.dev/pkg/logging"
+)
+
+// counts the per-resource log lines, to sample them
+var perResourceLogCounter atomic.Uint64
+
+// logger of the per-resource lines dropped by the sampling
+var nopLogger = zap.NewNop().Sugar()
+
+// returns the logger for the per-resource deletion and skip lines, sampled with the configured rate
+// the errors, the summaries and the audit log are never sampled, they use their own loggers
+func perResourceLogger(ctx context.Context) *zap.SugaredLogger {
+	logger := logging.FromContext(ctx)
+	rate := PrunerConfigStore.GetPerResourceLogSampleRate()
+	if rate <= 1 || perResourceLogCounter.Add(1)%uint64(rate) == 1 {
+		return logger
+	}
+	return nopLogger
+}
@@ -0,0 +1,41 @@
+package helper
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+)
+
+// action on a completed resource without the Succeeded condition, the result of such resource is unknown
+type MissingConditionPolicy string
+
+const (
+	// counted and pruned as a failed resource
+	MissingConditionPolicyFailed MissingConditionPolicy = "failed"
+	// never pruned, not counted toward the history limits
+	MissingConditionPolicySkip MissingConditionPolicy = "skip"
+	// not counted toward the history limits, deleted after the maximum age from the completion, regardless of the ttl
+	MissingConditionPolicyMaxAge MissingConditionPolicy = "maxAge"
+)
+
+// returns the policy applies to the resource, empty if the resource has the Succeeded condition or not completed
+func getMissingConditionPolicy(resource metav1.Object, isCompleted func(metav1.Object) bool) MissingConditionPolicy {
+	accessor, ok := resource.(interface {
+		GetStatusCondition() apis.ConditionAccessor
+	})
+	if !ok || accessor.GetStatusCondition().GetCondition(apis.ConditionSucceeded) != nil || !isCompleted(resource) {
+		return ""
+	}
+	policy, _ := PrunerConfigStore.GetMissingConditionPolicy()
+	return policy
+}
+
+// returns the maximum age of a resource without the Succeeded condition, nil if the policy is not maxAge
+func getMissingConditionMaxAge(resource metav1.Object, isCompleted func(metav1.Object) bool) *time.Duration {
+	if getMissingConditionPolicy(resource, isCompleted) != MissingConditionPolicyMaxAge {
+		return nil
+	}
+	_, maxAge := PrunerConfigStore.GetMissingConditionPolicy()
+	return maxAge
+}
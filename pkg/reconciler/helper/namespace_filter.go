@@ -0,0 +1,142 @@
+package helper
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+)
+
+// policies can be disabled per namespace, with the namespace annotation
+type PrunerPolicy string
+
+const (
+	PrunerPolicyTTL          PrunerPolicy = "ttl"
+	PrunerPolicyHistoryLimit PrunerPolicy = "history"
+	// the stuck run force deletion, disabled along with the other policies on the annotation value "true"
+	PrunerPolicyStuckRun PrunerPolicy = "stuckRun"
+	// reported on the dry run of the child TaskRuns deleted along with a PipelineRun, can not be disabled per namespace
+	PrunerPolicyChildCascade PrunerPolicy = "childCascade"
+
+	// reason reported on the namespaces filtered metric
+	NamespaceFilteredReasonAnnotation = "namespace_annotation"
+	NamespaceFilteredReasonConfig     = "namespace_pattern"
+	NamespaceFilteredReasonSelector   = "namespace_selector"
+	NamespaceFilteredReasonNotCached  = "namespace_not_cached"
+)
+
+// IsPolicyDisabledOnNamespace checks the disable annotation on the namespace, managed by the namespace owner
+// the annotation value "true" disables all the policies,
+// or a comma separated list of the policies to disable, example: "ttl", "history", "stuckRun", "ttl,history"
+// all the policies are disabled on the namespaces filtered out by the include and the exclude namespace patterns,
+// and on the namespaces not matching the namespace selector
+// the namespace selector can not be evaluated on a namespace missing in the cache, the policies are disabled on it
+func IsPolicyDisabledOnNamespace(ctx context.Context, namespaceLister corelisters.NamespaceLister, namespace string, policy PrunerPolicy) bool {
+	if PrunerConfigStore.IsNamespaceExcluded(namespace) {
+		metrics.RecordNamespaceFiltered(ctx, namespace, string(policy), NamespaceFilteredReasonConfig)
+		return true
+	}
+
+	ns, err := namespaceLister.Get(namespace)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			logger := logging.FromContext(ctx)
+			logger.Errorw("error on getting a namespace", "namespace", namespace, zap.Error(err))
+		}
+		if PrunerConfigStore.GetNamespaceSelector() != nil {
+			metrics.RecordNamespaceFiltered(ctx, namespace, string(policy), NamespaceFilteredReasonNotCached)
+			return true
+		}
+		return false
+	}
+
+	reason := getNamespaceFilteredReason(ns, policy)
+	if reason == "" {
+		return false
+	}
+	metrics.RecordNamespaceFiltered(ctx, namespace, string(policy), reason)
+	return true
+}
+
+// NamespaceNotCachedRequeue returns a requeue error, when the namespace is missing in the cache and the namespace selector is configured,
+// the policies are disabled on such a namespace, the resource is evaluated again once the namespace is in the cache
+func NamespaceNotCachedRequeue(namespaceLister corelisters.NamespaceLister, namespace string) error {
+	if PrunerConfigStore.GetNamespaceSelector() == nil || PrunerConfigStore.IsNamespaceExcluded(namespace) {
+		return nil
+	}
+	if _, err := namespaceLister.Get(namespace); err == nil {
+		return nil
+	}
+	return controller.NewRequeueAfter(DefaultNamespaceNotCachedRequeueDelay)
+}
+
+// returns the reason the policy is disabled on the namespace, empty if the policy is enabled
+func getNamespaceFilteredReason(ns *corev1.Namespace, policy PrunerPolicy) string {
+	if PrunerConfigStore.IsNamespaceExcluded(ns.GetName()) {
+		return NamespaceFilteredReasonConfig
+	}
+
+	if selector := PrunerConfigStore.GetNamespaceSelector(); selector != nil && !selector.Matches(labels.Set(ns.GetLabels())) {
+		return NamespaceFilteredReasonSelector
+	}
+
+	value, found := ns.GetAnnotations()[AnnotationNamespaceDisable]
+	if !found {
+		return ""
+	}
+
+	for _, _value := range strings.Split(value, ",") {
+		_value = strings.TrimSpace(_value)
+		if strings.EqualFold(_value, "true") || _value == string(policy) {
+			return NamespaceFilteredReasonAnnotation
+		}
+	}
+	return ""
+}
+
+// NamespacesReport lists the namespaces considered by the pruner
+type NamespacesReport struct {
+	// namespaces with at least one of the policies enabled
+	Namespaces []string `json:"namespaces"`
+	// namespace -> policy -> reason, for the namespaces with any of the policies disabled
+	// included only on request
+	Skipped map[string]map[PrunerPolicy]string `json:"skipped,omitempty"`
+}
+
+// GetNamespacesReport returns the namespaces the policies apply to, optionally with the reasons of the skipped policies
+func GetNamespacesReport(namespaceLister corelisters.NamespaceLister, withReasons bool) (NamespacesReport, error) {
+	namespaces, err := namespaceLister.List(labels.Everything())
+	if err != nil {
+		return NamespacesReport{}, err
+	}
+
+	policies := []PrunerPolicy{PrunerPolicyTTL, PrunerPolicyHistoryLimit}
+	report := NamespacesReport{Namespaces: []string{}}
+	if withReasons {
+		report.Skipped = map[string]map[PrunerPolicy]string{}
+	}
+	for _, ns := range namespaces {
+		reasons := map[PrunerPolicy]string{}
+		for _, policy := range policies {
+			if reason := getNamespaceFilteredReason(ns, policy); reason != "" {
+				reasons[policy] = reason
+			}
+		}
+		if len(reasons) < len(policies) {
+			report.Namespaces = append(report.Namespaces, ns.GetName())
+		}
+		if withReasons && len(reasons) > 0 {
+			report.Skipped[ns.GetName()] = reasons
+		}
+	}
+	sort.Strings(report.Namespaces)
+	return report, nil
+}
@@ -0,0 +1,155 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/controller"
+)
+
+// returns a namespace lister of the given namespaces
+func newTestNamespaceLister(t *testing.T, namespaces ...*corev1.Namespace) corelisters.NamespaceLister {
+	t.Helper()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, ns := range namespaces {
+		if err := indexer.Add(ns); err != nil {
+			t.Fatalf("error on adding the namespace: %v", err)
+		}
+	}
+	return corelisters.NewNamespaceLister(indexer)
+}
+
+func TestNamespaceNotCachedWithSelector(t *testing.T) {
+	loadTestGlobalConfig(t, `
+namespaceSelector: team=a
+`)
+	namespaceLister := newTestNamespaceLister(t, &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "ns-1", Labels: map[string]string{"team": "a"}},
+	})
+
+	// fails closed on the namespace missing in the cache
+	for _, policy := range []PrunerPolicy{PrunerPolicyTTL, PrunerPolicyHistoryLimit} {
+		if !IsPolicyDisabledOnNamespace(context.Background(), namespaceLister, "ns-2", policy) {
+			t.Errorf("expected the %s policy to be disabled on the namespace missing in the cache", policy)
+		}
+		if IsPolicyDisabledOnNamespace(context.Background(), namespaceLister, "ns-1", policy) {
+			t.Errorf("expected the %s policy to be enabled on the namespace matching the selector", policy)
+		}
+	}
+
+	if isRequeueKey, _ := controller.IsRequeueKey(NamespaceNotCachedRequeue(namespaceLister, "ns-2")); !isRequeueKey {
+		t.Error("expected a requeue for the namespace missing in the cache")
+	}
+	if err := NamespaceNotCachedRequeue(namespaceLister, "ns-1"); err != nil {
+		t.Errorf("unexpected error for the cached namespace: %v", err)
+	}
+}
+
+func TestNamespaceNotCachedWithoutSelector(t *testing.T) {
+	loadTestGlobalConfig(t, ``)
+	namespaceLister := newTestNamespaceLister(t)
+
+	if IsPolicyDisabledOnNamespace(context.Background(), namespaceLister, "ns-1", PrunerPolicyTTL) {
+		t.Error("expected the policy to be enabled on the namespace missing in the cache, without the selector")
+	}
+	if err := NamespaceNotCachedRequeue(namespaceLister, "ns-1"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestInvalidNamespaceSelectorRejectedOnLoad(t *testing.T) {
+	_, err := NewPrunerConfigFromConfigMap(&corev1.ConfigMap{Data: map[string]string{PrunerGlobalConfigKey: "namespaceSelector: 'team in (a'"}})
+	configErr := &ConfigLoadError{}
+	if !errors.As(err, &configErr) {
+		t.Fatalf("expected a config load error, got: %v", err)
+	}
+}
+
+func TestNamespacePatternPrecedence(t *testing.T) {
+	// force include takes precedence over the exclude patterns, the exclude patterns over the include patterns
+	loadTestGlobalConfig(t, `
+includeNamespaces: ["team-*"]
+excludeNamespaces: ["team-*-tmp", "other-*"]
+forceIncludeNamespaces: ["team-a-tmp", "other-b", "outside"]
+`)
+	tests := []struct {
+		namespace        string
+		expectedExcluded bool
+	}{
+		{namespace: "team-a", expectedExcluded: false},
+		{namespace: "team-b-tmp", expectedExcluded: true},
+		{namespace: "team-a-tmp", expectedExcluded: false},
+		{namespace: "other-a", expectedExcluded: true},
+		{namespace: "other-b", expectedExcluded: false},
+		{namespace: "default", expectedExcluded: true},
+		{namespace: "outside", expectedExcluded: false},
+	}
+	for _, test := range tests {
+		t.Run(test.namespace, func(t *testing.T) {
+			if excluded := PrunerConfigStore.IsNamespaceExcluded(test.namespace); excluded != test.expectedExcluded {
+				t.Errorf("expected excluded %v, got %v", test.expectedExcluded, excluded)
+			}
+		})
+	}
+}
+
+func TestInvalidNamespacePatternRejectedOnLoad(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{name: "include", config: "includeNamespaces: ['team-[a']"},
+		{name: "exclude", config: "excludeNamespaces: ['team-[a']"},
+		{name: "force include", config: "forceIncludeNamespaces: ['team-*']"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewPrunerConfigFromConfigMap(&corev1.ConfigMap{Data: map[string]string{PrunerGlobalConfigKey: test.config}})
+			configErr := &ConfigLoadError{}
+			if !errors.As(err, &configErr) {
+				t.Fatalf("expected a config load error, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestNamespaceDisableAnnotation(t *testing.T) {
+	loadTestGlobalConfig(t, ``)
+	tests := []struct {
+		annotation       string
+		expectedDisabled map[PrunerPolicy]bool
+	}{
+		{annotation: "true", expectedDisabled: map[PrunerPolicy]bool{PrunerPolicyTTL: true, PrunerPolicyHistoryLimit: true}},
+		{annotation: "TRUE", expectedDisabled: map[PrunerPolicy]bool{PrunerPolicyTTL: true, PrunerPolicyHistoryLimit: true}},
+		{annotation: "ttl, history", expectedDisabled: map[PrunerPolicy]bool{PrunerPolicyTTL: true, PrunerPolicyHistoryLimit: true}},
+		{annotation: "ttl", expectedDisabled: map[PrunerPolicy]bool{PrunerPolicyTTL: true, PrunerPolicyHistoryLimit: false}},
+		{annotation: "history", expectedDisabled: map[PrunerPolicy]bool{PrunerPolicyTTL: false, PrunerPolicyHistoryLimit: true}},
+		{annotation: "false", expectedDisabled: map[PrunerPolicy]bool{PrunerPolicyTTL: false, PrunerPolicyHistoryLimit: false}},
+	}
+	for _, test := range tests {
+		t.Run(test.annotation, func(t *testing.T) {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:        "ns-1",
+				Annotations: map[string]string{AnnotationNamespaceDisable: test.annotation},
+			}}
+			namespaceLister := newTestNamespaceLister(t, ns)
+			for policy, expectedDisabled := range test.expectedDisabled {
+				if disabled := IsPolicyDisabledOnNamespace(context.Background(), namespaceLister, ns.Name, policy); disabled != expectedDisabled {
+					t.Errorf("expected the %s policy disabled %v, got %v", policy, expectedDisabled, disabled)
+				}
+				expectedReason := ""
+				if expectedDisabled {
+					expectedReason = NamespaceFilteredReasonAnnotation
+				}
+				if reason := getNamespaceFilteredReason(ns, policy); reason != expectedReason {
+					t.Errorf("expected the %s policy filtered reason %q, got %q", policy, expectedReason, reason)
+				}
+			}
+		})
+	}
+}
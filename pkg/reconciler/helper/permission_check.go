@@ -0,0 +1,58 @@
+package helper
+
+import (
+	"context"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
+	"go.uber.org/zap"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"knative.dev/pkg/logging"
+)
+
+// resources deleted by the pruner
+var prunedResources = []string{"pipelineruns", "taskruns", "customruns"}
+
+// CheckDeletePermissions reviews the delete permission of the pruner on the resources,
+// cluster wide and on the namespaces defined in the global config.
+// the result is logged and recorded as a metric, surfaces the RBAC gaps before the first deletion
+func CheckDeletePermissions(ctx context.Context, kubeClient kubernetes.Interface) {
+	logger := logging.FromContext(ctx)
+
+	// empty namespace reviews the permission on all the namespaces
+	namespaces := append([]string{""}, PrunerConfigStore.GetGlobalConfigNamespaces()...)
+	for _, namespace := range namespaces {
+		for _, resource := range prunedResources {
+			review := &authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationv1.ResourceAttributes{
+						Namespace: namespace,
+						Verb:      "delete",
+						Group:     "tekton.dev",
+						Resource:  resource,
+					},
+				},
+			}
+			result, err := kubeClient.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+			if err != nil {
+				logger.Errorw("error on reviewing the delete permission",
+					"namespace", namespace, "resource", resource,
+					zap.Error(err),
+				)
+				continue
+			}
+
+			metrics.RecordDeletePermission(ctx, namespace, resource, result.Status.Allowed)
+			if !result.Status.Allowed {
+				logger.Warnw("pruner has no permission to delete the resources",
+					"namespace", namespace, "resource", resource, "reason", result.Status.Reason,
+				)
+				continue
+			}
+			logger.Infow("pruner has permission to delete the resources",
+				"namespace", namespace, "resource", resource,
+			)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package helper
+
+import (
+	"sync"
+	"time"
+)
+
+// deletions of a namespace, since the last collection
+type namespaceDeletions struct {
+	lastDeletionTime time.Time
+	// resource type -> count
+	counts map[string]int64
+}
+
+// keeps the deletions per namespace, collected on the TektonPruner status refresh
+// the data is in-memory, the deletions before a restart are not reported
+type pruneTracker struct {
+	mutex sync.Mutex
+	// namespace -> deletions
+	deletions map[string]*namespaceDeletions
+}
+
+var (
+	// tracks the deleted resources
+	// singleton instance
+	PruneTracker = pruneTracker{mutex: sync.Mutex{}, deletions: map[string]*namespaceDeletions{}}
+)
+
+// Pruned records a deleted resource of the namespace
+func (pt *pruneTracker) Pruned(resourceType, namespace string) {
+	pt.mutex.Lock()
+	defer pt.mutex.Unlock()
+
+	deletions, found := pt.deletions[namespace]
+	if !found {
+		deletions = &namespaceDeletions{counts: map[string]int64{}}
+		pt.deletions[namespace] = deletions
+	}
+	deletions.lastDeletionTime = time.Now()
+	deletions.counts[resourceType]++
+}
+
+// Collect returns the deletions of a namespace since the previous collection, and resets them
+// returns false, if nothing is deleted in the namespace since the previous collection
+func (pt *pruneTracker) Collect(namespace string) (time.Time, map[string]int64, bool) {
+	pt.mutex.Lock()
+	defer pt.mutex.Unlock()
+
+	deletions, found := pt.deletions[namespace]
+	if !found {
+		return time.Time{}, nil, false
+	}
+	delete(pt.deletions, namespace)
+	return deletions.lastDeletionTime, deletions.counts, true
+}
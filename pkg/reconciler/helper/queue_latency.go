@@ -0,0 +1,84 @@
+package helper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clockUtil "k8s.io/utils/clock"
+)
+
+// tracks the time a resource is observed as completed, till the reconciler acts on it
+// the latency of a resource is recorded only once, on the first reconcile after the completion
+type queueLatencyTracker struct {
+	mutex sync.Mutex
+	// resource key -> time the completion observed, zero time once the latency is recorded
+	// keyed by the uid, a resource recreated with the same name gets its own latency
+	observed map[string]time.Time
+	// the detection latency is recorded only for the resources completed after the tracker started,
+	// the resources completed while the pruner was not running are first seen on the initial list
+	startedAt time.Time
+	clock     clockUtil.PassiveClock // the clock for tracking time
+}
+
+var (
+	// tracks the reconcile queue latency
+	// singleton instance
+	QueueLatencyTracker = queueLatencyTracker{mutex: sync.Mutex{}, observed: map[string]time.Time{}, startedAt: time.Now(), clock: clockUtil.RealClock{}}
+)
+
+func queueLatencyKey(resourceType string, resource metav1.Object) string {
+	return resourceType + "/" + string(resource.GetUID())
+}
+
+// MarkEligible records the time a resource is observed as completed, if not recorded already
+// on the first observation, the latency since the completion of the resource is recorded as the detection latency
+func (qt *queueLatencyTracker) MarkEligible(ctx context.Context, resourceType string, resource metav1.Object, getCompletionTime func(metav1.Object) (metav1.Time, error)) {
+	qt.mutex.Lock()
+	key := queueLatencyKey(resourceType, resource)
+	if _, found := qt.observed[key]; found {
+		qt.mutex.Unlock()
+		return
+	}
+	now := qt.clock.Now()
+	qt.observed[key] = now
+	qt.mutex.Unlock()
+
+	completionTime, err := getCompletionTime(resource)
+	// a completion time in the future is reported by the ttl handler
+	if err != nil || completionTime.Time.Before(qt.startedAt) || completionTime.Time.After(now) {
+		return
+	}
+	metrics.RecordDetectionLatency(ctx, resourceType, resource.GetNamespace(), now.Sub(completionTime.Time))
+}
+
+// Observe records the latency between the completion observed and the reconciler acting on it
+func (qt *queueLatencyTracker) Observe(ctx context.Context, resourceType string, resource metav1.Object) {
+	if latency, found := qt.takeLatency(resourceType, resource); found {
+		metrics.RecordReconcileQueueLatency(ctx, resourceType, resource.GetNamespace(), latency)
+	}
+}
+
+// returns the latency since the completion observed, only once per resource
+// returns false, if the completion is not observed or the latency is already taken
+func (qt *queueLatencyTracker) takeLatency(resourceType string, resource metav1.Object) (time.Duration, bool) {
+	qt.mutex.Lock()
+	defer qt.mutex.Unlock()
+
+	key := queueLatencyKey(resourceType, resource)
+	observedAt, found := qt.observed[key]
+	if !found || observedAt.IsZero() {
+		return 0, false
+	}
+	qt.observed[key] = time.Time{}
+	return qt.clock.Since(observedAt), true
+}
+
+// Forget removes a resource from the tracker, when it is deleted
+func (qt *queueLatencyTracker) Forget(resourceType string, resource metav1.Object) {
+	qt.mutex.Lock()
+	defer qt.mutex.Unlock()
+	delete(qt.observed, queueLatencyKey(resourceType, resource))
+}
@@ -0,0 +1,54 @@
+package helper
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func newTestQueueLatencyTracker(fakeClock *clocktesting.FakeClock) *queueLatencyTracker {
+	return &queueLatencyTracker{mutex: sync.Mutex{}, observed: map[string]time.Time{}, startedAt: fakeClock.Now(), clock: fakeClock}
+}
+
+func TestQueueLatencyTakenOnce(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	tracker := newTestQueueLatencyTracker(fakeClock)
+	resource := newFakeResources("ns-1", 1)[0]
+	completionTime := func(metav1.Object) (metav1.Time, error) { return metav1.NewTime(fakeClock.Now()), nil }
+
+	// the reconciler acts on a resource not observed as completed, nothing to record
+	if _, found := tracker.takeLatency(KindPipelineRun, resource); found {
+		t.Fatalf("expected no latency for the resource not observed as completed")
+	}
+
+	tracker.MarkEligible(context.Background(), KindPipelineRun, resource, completionTime)
+	fakeClock.Step(3 * time.Second)
+	// the repeated events of the completed resource do not reset the observed time
+	tracker.MarkEligible(context.Background(), KindPipelineRun, resource, completionTime)
+	fakeClock.Step(2 * time.Second)
+
+	latency, found := tracker.takeLatency(KindPipelineRun, resource)
+	if !found || latency != 5*time.Second {
+		t.Fatalf("expected a latency of 5s since the completion observed, got %v (found: %v)", latency, found)
+	}
+
+	// the requeues of the same resource are not recorded again
+	fakeClock.Step(time.Minute)
+	if latency, found := tracker.takeLatency(KindPipelineRun, resource); found {
+		t.Errorf("expected the latency to be recorded once, got again %v", latency)
+	}
+	tracker.MarkEligible(context.Background(), KindPipelineRun, resource, completionTime)
+	if latency, found := tracker.takeLatency(KindPipelineRun, resource); found {
+		t.Errorf("expected no latency after the completion observed again, got %v", latency)
+	}
+
+	// a deleted resource is dropped from the tracker
+	tracker.Forget(KindPipelineRun, resource)
+	if len(tracker.observed) != 0 {
+		t.Errorf("expected the forgotten resource to be dropped, got %v", tracker.observed)
+	}
+}
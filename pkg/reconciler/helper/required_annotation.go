@@ -0,0 +1,41 @@
+package helper
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/controller"
+)
+
+// returns true, if the resource waits for the annotation required before the pruning
+// the resource is prunable once it has the annotation, or the maximum wait after the completion is passed
+// returns the time left to wait, zero when there is no maximum wait
+func isAwaitingRequiredAnnotation(resource metav1.Object, completionTime metav1.Time, now time.Time) (bool, time.Duration) {
+	spec := PrunerConfigStore.GetRequireAnnotationBeforePrune()
+	if spec == nil {
+		return false, 0
+	}
+
+	value, found := resource.GetAnnotations()[spec.Key]
+	if found && (spec.Value == "" || spec.Value == value) {
+		return false, 0
+	}
+
+	if spec.MaxWaitSeconds == nil || *spec.MaxWaitSeconds < 0 {
+		return true, 0
+	}
+	waitLeft := completionTime.Add(time.Duration(*spec.MaxWaitSeconds) * time.Second).Sub(now)
+	if waitLeft <= 0 {
+		return false, 0
+	}
+	return true, waitLeft
+}
+
+// returns a requeue error, to evaluate a resource waiting for the required annotation again
+// the annotation can be added at any time, the resource is evaluated again at least after the default delay
+func awaitingRequiredAnnotationRequeue(waitLeft time.Duration) error {
+	if waitLeft > 0 && waitLeft < DefaultDeletionAbortedRequeueDelay {
+		return controller.NewRequeueAfter(waitLeft)
+	}
+	return controller.NewRequeueAfter(DefaultDeletionAbortedRequeueDelay)
+}
@@ -0,0 +1,97 @@
+package helper
+
+import (
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reasons a completed resource is retained by the pruner
+const (
+	RetentionReasonWithinTTL          = "withinTTL"
+	RetentionReasonWithinHistoryLimit = "withinHistoryLimit"
+	RetentionReasonLegalHold          = "legalHold"
+	RetentionReasonDeletionHook       = "deletionHook"
+	RetentionReasonAwaitingAnnotation = "awaitingAnnotation"
+	RetentionReasonSkipAnnotation     = "skipAnnotation"
+	RetentionReasonMissingCondition   = "missingCondition"
+	RetentionReasonResourceSelector   = "resourceSelector"
+)
+
+// reasons reported on the skipped resources metric
+const (
+	SkippedReasonAnnotation       = "skip_annotation"
+	SkippedReasonMissingCondition = "missing_condition"
+	SkippedReasonResourceSelector = "resource_selector"
+)
+
+// keeps the last known retention reason of the resources, per namespace
+// the data is in-memory, rebuilt as the resources are reconciled after a restart
+type retentionTracker struct {
+	mutex sync.RWMutex
+	// namespace -> resource key -> reason
+	// keyed by the uid, the delete event of a resource does not remove a recreated resource with the same name
+	retained map[string]map[string]string
+}
+
+var (
+	// tracks the retained resources
+	// singleton instance
+	RetentionTracker = retentionTracker{mutex: sync.RWMutex{}, retained: map[string]map[string]string{}}
+)
+
+func retentionKey(resourceType string, resource metav1.Object) string {
+	return resourceType + "/" + string(resource.GetUID())
+}
+
+// Retain records the reason a resource is retained, overrides the previous reason
+// the number of resources tracked in a namespace is bounded, new resources are ignored on the limit
+func (rt *retentionTracker) Retain(resourceType string, resource metav1.Object, reason string) {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	namespace := resource.GetNamespace()
+	key := retentionKey(resourceType, resource)
+	resources, found := rt.retained[namespace]
+	if !found {
+		resources = map[string]string{}
+		rt.retained[namespace] = resources
+	}
+	if _, exists := resources[key]; !exists && len(resources) >= DefaultRetentionTrackerMaxResourcesPerNamespace {
+		return
+	}
+	resources[key] = reason
+}
+
+// Forget removes a resource from the tracker, when it is deleted
+func (rt *retentionTracker) Forget(resourceType string, resource metav1.Object) {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	namespace := resource.GetNamespace()
+	resources, found := rt.retained[namespace]
+	if !found {
+		return
+	}
+	delete(resources, retentionKey(resourceType, resource))
+	if len(resources) == 0 {
+		delete(rt.retained, namespace)
+	}
+}
+
+// GetBreakdown returns the number of resources retained in a namespace, per reason
+// the size of the map is bounded by the number of known reasons
+func (rt *retentionTracker) GetBreakdown(namespace string) map[string]int64 {
+	rt.mutex.RLock()
+	defer rt.mutex.RUnlock()
+
+	resources := rt.retained[namespace]
+	if len(resources) == 0 {
+		return nil
+	}
+	breakdown := map[string]int64{}
+	for _, reason := range resources {
+		breakdown[reason]++
+	}
+	return breakdown
+}
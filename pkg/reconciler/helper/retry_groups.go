@@ -0,0 +1,68 @@
+package helper
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// returns the retry group of the resources, keyed by the uid
+// a resource with the retry annotation belongs to the group of the run it retries, followed up to the first run
+// a resource without the annotation is the first run of its own group,
+// the runs are never grouped only by sharing a pipeline or a task name
+func retryGroups(resources []metav1.Object) map[types.UID]string {
+	byName := map[string]metav1.Object{}
+	for _, res := range resources {
+		byName[res.GetName()] = res
+	}
+
+	groups := map[types.UID]string{}
+	for _, res := range resources {
+		group := res.GetName()
+		visited := map[string]bool{group: true}
+		current := res
+		for {
+			retryOf := current.GetAnnotations()[AnnotationRetryOf]
+			if retryOf == "" || visited[retryOf] {
+				break
+			}
+			group = retryOf
+			visited[retryOf] = true
+			// the retried run might be deleted already, the group is named after it anyway
+			next, found := byName[retryOf]
+			if !found {
+				break
+			}
+			current = next
+		}
+		groups[res.GetUID()] = group
+	}
+	return groups
+}
+
+// returns the number of the distinct retry groups of the resources
+func countRetryGroups(resources []metav1.Object, groups map[types.UID]string) int {
+	distinct := map[string]bool{}
+	for _, res := range resources {
+		distinct[groups[res.GetUID()]] = true
+	}
+	return len(distinct)
+}
+
+// splits the resources sorted from newer to older, retains all the runs of the newest groups up to the limit
+func splitByRetryGroups(resources []metav1.Object, groups map[types.UID]string, limit int) ([]metav1.Object, []metav1.Object) {
+	retainedGroups := map[string]bool{}
+	retained := []metav1.Object{}
+	selectionForDeletion := []metav1.Object{}
+	for _, res := range resources {
+		group := groups[res.GetUID()]
+		if !retainedGroups[group] && len(retainedGroups) < limit {
+			retainedGroups[group] = true
+		}
+		if retainedGroups[group] {
+			retained = append(retained, res)
+		} else {
+			selectionForDeletion = append(selectionForDeletion, res)
+		}
+	}
+	return retained, selectionForDeletion
+}
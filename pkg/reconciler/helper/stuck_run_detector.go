@@ -0,0 +1,210 @@
+package helper
+
+import (
+	"context"
+	"time"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"knative.dev/pkg/logging"
+)
+
+type StuckRunResourceFuncs interface {
+	Type() string
+	Get(ctx context.Context, namespace, name string) (metav1.Object, error)
+	// deletes the resource, only if the uid and the resource version are not changed since the resource is read
+	DeleteUnchanged(ctx context.Context, resource metav1.Object) error
+	IsCompleted(resource metav1.Object) bool
+}
+
+// StuckRunDetector reports the runs never reached the completion state, older than the configured maximum age
+// such runs are never pruned by the ttl handler and the history limiter, optionally force deleted
+// only the runs the replica is the leader for are detected, the other replicas detect the rest
+type StuckRunDetector struct {
+	resourceFn      StuckRunResourceFuncs
+	namespaceLister corelisters.NamespaceLister
+	// returns true, if the replica is the leader for the key
+	isLeaderFor func(key types.NamespacedName) bool
+	// lists the runs from the informer cache
+	listFn func() ([]metav1.Object, error)
+	// namespaces reported on the previous run, to reset the gauge
+	reportedNamespaces map[string]bool
+}
+
+func NewStuckRunDetector(resourceFn StuckRunResourceFuncs, namespaceLister corelisters.NamespaceLister,
+	isLeaderFor func(key types.NamespacedName) bool, listFn func() ([]metav1.Object, error)) *StuckRunDetector {
+	return &StuckRunDetector{
+		resourceFn:         resourceFn,
+		namespaceLister:    namespaceLister,
+		isLeaderFor:        isLeaderFor,
+		listFn:             listFn,
+		reportedNamespaces: map[string]bool{},
+	}
+}
+
+// Run detects the stuck runs on every interval, until the context is cancelled
+func (sd *StuckRunDetector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sd.detect(ctx)
+		}
+	}
+}
+
+func (sd *StuckRunDetector) detect(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+
+	maxAge := PrunerConfigStore.GetStuckRunMaxAge()
+	if maxAge == nil {
+		sd.report(ctx, map[string]int64{})
+		return
+	}
+
+	resources, err := sd.listFn()
+	if err != nil {
+		logger.Errorw("error on listing resources to detect the stuck runs",
+			"resource", sd.resourceFn.Type(), zap.Error(err),
+		)
+		return
+	}
+
+	// the stuck runs are still reported, when the pruning is paused
+	forceDelete := PrunerConfigStore.IsStuckRunForceDeleteEnabled() && !PrunerConfigStore.IsPaused()
+	stuckRuns := map[string]int64{}
+	for _, resource := range resources {
+		if !sd.isLeaderFor(types.NamespacedName{Namespace: resource.GetNamespace(), Name: resource.GetName()}) {
+			continue
+		}
+		if !sd.isStuck(resource, *maxAge) {
+			continue
+		}
+
+		logger.Warnw("found a run not completed after the maximum age",
+			"resource", sd.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
+			"creationTimestamp", resource.GetCreationTimestamp(), "maxAge", *maxAge,
+		)
+		if !forceDelete || !sd.forceDelete(ctx, resource, *maxAge) {
+			stuckRuns[resource.GetNamespace()]++
+		}
+	}
+	sd.report(ctx, stuckRuns)
+}
+
+// returns true, if the run is not completed after the maximum age
+func (sd *StuckRunDetector) isStuck(resource metav1.Object, maxAge time.Duration) bool {
+	if resource.GetDeletionTimestamp() != nil || sd.resourceFn.IsCompleted(resource) {
+		return false
+	}
+	return time.Since(resource.GetCreationTimestamp().Time) > maxAge
+}
+
+// returns true, if the stuck run can be force deleted
+// the same checks as the ttl handler, the run never completed, the required annotation wait starts on the creation
+func (sd *StuckRunDetector) isForceDeleteAllowed(ctx context.Context, resource metav1.Object) bool {
+	if isOnLegalHold(resource) {
+		RetentionTracker.Retain(sd.resourceFn.Type(), resource, RetentionReasonLegalHold)
+		return false
+	}
+	if isSkipped(resource) {
+		reportSkipped(ctx, sd.resourceFn.Type(), resource, SkippedReasonAnnotation)
+		return false
+	}
+	if !isSelected(resource) {
+		reportSkipped(ctx, sd.resourceFn.Type(), resource, SkippedReasonResourceSelector)
+		return false
+	}
+	if IsPolicyDisabledOnNamespace(ctx, sd.namespaceLister, resource.GetNamespace(), PrunerPolicyStuckRun) {
+		return false
+	}
+	if awaiting, _ := isAwaitingRequiredAnnotation(resource, resource.GetCreationTimestamp(), time.Now()); awaiting {
+		RetentionTracker.Retain(sd.resourceFn.Type(), resource, RetentionReasonAwaitingAnnotation)
+		return false
+	}
+	return true
+}
+
+// deletes a stuck run, returns true on a successful deletion
+// the run is read again before the deletion, the run listed from the cache can be stale
+func (sd *StuckRunDetector) forceDelete(ctx context.Context, resource metav1.Object, maxAge time.Duration) bool {
+	logger := logging.FromContext(ctx)
+
+	if !sd.isForceDeleteAllowed(ctx, resource) {
+		return false
+	}
+
+	freshResource, err := sd.resourceFn.Get(ctx, resource.GetNamespace(), resource.GetName())
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return true
+		}
+		logger.Errorw("error on getting a stuck run",
+			"resource", sd.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
+			zap.Error(err),
+		)
+		return false
+	}
+	if !sd.isStuck(freshResource, maxAge) || !sd.isForceDeleteAllowed(ctx, freshResource) {
+		return false
+	}
+	resource = freshResource
+
+	if isDryRun(ctx, sd.resourceFn.Type(), resource, PrunerPolicyStuckRun) {
+		return false
+	}
+
+	if err := runBeforeDeleteHooks(ctx, resource); err != nil {
+		logger.Infow("deletion aborted by a hook",
+			"resource", sd.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
+			zap.Error(err),
+		)
+		return false
+	}
+
+	perResourceLogger(ctx).Infow("force deleting a stuck run",
+		"resource", sd.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
+	)
+	err = sd.resourceFn.DeleteUnchanged(ctx, resource)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return true
+		}
+		// the run is changed since it is read, evaluated again on the next interval
+		if errors.IsConflict(err) {
+			return false
+		}
+		logger.Errorw("error on force deleting a stuck run",
+			"resource", sd.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
+			zap.Error(err),
+		)
+		return false
+	}
+	metrics.RecordResourceDeleted(ctx, sd.resourceFn.Type(), resource.GetNamespace(), DeletionReasonStuckRun)
+	PruneTracker.Pruned(sd.resourceFn.Type(), resource.GetNamespace())
+	auditDeletion(sd.resourceFn.Type(), resource, DeletionReasonStuckRun, nil)
+	runAfterDeleteHooks(ctx, resource)
+	return true
+}
+
+// records the stuck runs per namespace, resets the namespaces no longer have stuck runs
+func (sd *StuckRunDetector) report(ctx context.Context, stuckRuns map[string]int64) {
+	for namespace := range sd.reportedNamespaces {
+		if _, found := stuckRuns[namespace]; !found {
+			metrics.RecordStuckRuns(ctx, sd.resourceFn.Type(), namespace, 0)
+		}
+	}
+	sd.reportedNamespaces = map[string]bool{}
+	for namespace, count := range stuckRuns {
+		metrics.RecordStuckRuns(ctx, sd.resourceFn.Type(), namespace, count)
+		sd.reportedNamespaces[namespace] = true
+	}
+}
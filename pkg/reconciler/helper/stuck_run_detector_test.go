@@ -0,0 +1,178 @@
+package helper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// runs of a namespace, deleted in memory
+type fakeStuckRunResourceFuncs struct {
+	resources []metav1.Object
+	deleted   []string
+	// names of the completed runs
+	completed map[string]bool
+	// runs returned on the get, changed after the listing
+	fresh map[string]metav1.Object
+}
+
+func (f *fakeStuckRunResourceFuncs) Type() string { return KindPipelineRun }
+
+func (f *fakeStuckRunResourceFuncs) Get(ctx context.Context, namespace, name string) (metav1.Object, error) {
+	if res, found := f.fresh[name]; found {
+		return res, nil
+	}
+	for _, res := range f.resources {
+		if res.GetNamespace() == namespace && res.GetName() == name {
+			return res, nil
+		}
+	}
+	return nil, errors.NewNotFound(schema.GroupResource{Resource: "pipelineruns"}, name)
+}
+
+func (f *fakeStuckRunResourceFuncs) DeleteUnchanged(ctx context.Context, resource metav1.Object) error {
+	for index, res := range f.resources {
+		if res.GetNamespace() == resource.GetNamespace() && res.GetName() == resource.GetName() {
+			f.resources = append(f.resources[:index], f.resources[index+1:]...)
+			f.deleted = append(f.deleted, resource.GetName())
+			return nil
+		}
+	}
+	return errors.NewNotFound(schema.GroupResource{Resource: "pipelineruns"}, resource.GetName())
+}
+
+func (f *fakeStuckRunResourceFuncs) IsCompleted(resource metav1.Object) bool {
+	return f.completed[resource.GetName()]
+}
+
+// returns a run created before the given duration
+func newStuckRun(name string, createdAgo time.Duration, labels, annotations map[string]string) metav1.Object {
+	return &metav1.ObjectMeta{
+		Namespace:         "ns-1",
+		Name:              name,
+		UID:               types.UID("uid-" + name),
+		Labels:            labels,
+		Annotations:       annotations,
+		CreationTimestamp: metav1.NewTime(time.Now().Add(-createdAgo)),
+	}
+}
+
+func TestStuckRunForceDelete(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		namespace *corev1.Namespace
+		resource  metav1.Object
+		// the run read again before the deletion
+		freshResource metav1.Object
+		notLeader     bool
+		expectDeleted bool
+	}{
+		{
+			name:          "stuck run deleted",
+			resource:      newStuckRun("run-0", 2*time.Hour, nil, nil),
+			expectDeleted: true,
+		},
+		{
+			name:     "run within the maximum age",
+			resource: newStuckRun("run-0", 30*time.Minute, nil, nil),
+		},
+		{
+			name:     "legal hold",
+			resource: newStuckRun("run-0", 2*time.Hour, nil, map[string]string{AnnotationLegalHold: "true"}),
+		},
+		{
+			name:     "skip annotation",
+			resource: newStuckRun("run-0", 2*time.Hour, nil, map[string]string{AnnotationSkip: "true"}),
+		},
+		{
+			name: "not selected by the resource selector",
+			config: `
+namespaces:
+  ns-1:
+    resourceSelector: team=a
+`,
+			resource: newStuckRun("run-0", 2*time.Hour, map[string]string{"team": "b"}, nil),
+		},
+		{
+			name: "namespace disable annotation",
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:        "ns-1",
+				Annotations: map[string]string{AnnotationNamespaceDisable: "stuckRun"},
+			}},
+			resource: newStuckRun("run-0", 2*time.Hour, nil, nil),
+		},
+		{
+			name:     "namespace excluded",
+			config:   `excludeNamespaces: ["ns-*"]`,
+			resource: newStuckRun("run-0", 2*time.Hour, nil, nil),
+		},
+		{
+			name:     "namespace not matching the selector",
+			config:   `namespaceSelector: team=a`,
+			resource: newStuckRun("run-0", 2*time.Hour, nil, nil),
+		},
+		{
+			name: "awaiting the required annotation",
+			config: `
+requireAnnotationBeforePrune:
+  key: archive.example.com/done
+`,
+			resource: newStuckRun("run-0", 2*time.Hour, nil, nil),
+		},
+		{
+			name: "required annotation present",
+			config: `
+requireAnnotationBeforePrune:
+  key: archive.example.com/done
+`,
+			resource:      newStuckRun("run-0", 2*time.Hour, nil, map[string]string{"archive.example.com/done": "true"}),
+			expectDeleted: true,
+		},
+		{
+			name:          "legal hold after the listing",
+			resource:      newStuckRun("run-0", 2*time.Hour, nil, nil),
+			freshResource: newStuckRun("run-0", 2*time.Hour, nil, map[string]string{AnnotationLegalHold: "true"}),
+		},
+		{
+			name:          "skip annotation after the listing",
+			resource:      newStuckRun("run-0", 2*time.Hour, nil, nil),
+			freshResource: newStuckRun("run-0", 2*time.Hour, nil, map[string]string{AnnotationSkip: "true"}),
+		},
+		{
+			name:      "not the leader",
+			resource:  newStuckRun("run-0", 2*time.Hour, nil, nil),
+			notLeader: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loadTestGlobalConfig(t, "stuckRunMaxAgeSeconds: 3600\nstuckRunForceDelete: true\n"+test.config)
+			namespace := test.namespace
+			if namespace == nil {
+				namespace = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns-1"}}
+			}
+			resourceFn := &fakeStuckRunResourceFuncs{resources: []metav1.Object{test.resource}, completed: map[string]bool{}, fresh: map[string]metav1.Object{}}
+			if test.freshResource != nil {
+				resourceFn.fresh[test.freshResource.GetName()] = test.freshResource
+			}
+			listFn := func() ([]metav1.Object, error) {
+				return append([]metav1.Object{}, resourceFn.resources...), nil
+			}
+			isLeaderFor := func(key types.NamespacedName) bool { return !test.notLeader }
+			detector := NewStuckRunDetector(resourceFn, newTestNamespaceLister(t, namespace), isLeaderFor, listFn)
+
+			detector.detect(context.Background())
+			if deleted := len(resourceFn.deleted) == 1; deleted != test.expectDeleted {
+				t.Fatalf("expected deleted %v, got the deleted runs %v", test.expectDeleted, resourceFn.deleted)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	tektonprunerv1alpha1 "github.com/openshift-pipelines/tektoncd-pruner/pkg/apis/tektonpruner/v1alpha1"
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
 	"go.uber.org/zap"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -21,9 +22,15 @@ type TTLResourceFuncs interface {
 	Delete(ctx context.Context, namespace, name string) error
 	Update(ctx context.Context, resource metav1.Object) error
 	IsCompleted(resource metav1.Object) bool
+	IsCancelled(resource metav1.Object) bool
 	GetCompletionTime(resource metav1.Object) (metav1.Time, error)
+	GetStartTime(resource metav1.Object) (metav1.Time, error)
+	// returns true, if the Pipeline or Task referenced by the resource is deleted
+	IsDefinitionDeleted(resource metav1.Object) bool
 	Ignore(resource metav1.Object) bool
 	GetTTLSecondsAfterFinished(namespace, name string) *int32
+	GetCancelledTTLSecondsAfterFinished(namespace, name string) *int32
+	GetTTLFrom(namespace, name string) tektonprunerv1alpha1.TTLFrom
 	GetDefaultLabelKey() string
 	GetEnforcedConfigLevel(namespace, name string) tektonprunerv1alpha1.EnforcedConfigLevel
 }
@@ -62,15 +69,44 @@ func (th *TTLHandler) ProcessEvent(ctx context.Context, resource metav1.Object)
 		return nil
 	}
 
+	// the skip annotation takes precedence, even the labels and the annotations are not fully populated
+	if isSkipped(resource) {
+		reportSkipped(ctx, th.resourceFn.Type(), resource, SkippedReasonAnnotation)
+		return nil
+	}
+
+	// the resource not matching the resource selector of the namespace is not pruned
+	if !isSelected(resource) {
+		reportSkipped(ctx, th.resourceFn.Type(), resource, SkippedReasonResourceSelector)
+		return nil
+	}
+
+	// a completed resource without the Succeeded condition is not pruned, on the skip policy
+	if getMissingConditionPolicy(resource, th.resourceFn.IsCompleted) == MissingConditionPolicySkip {
+		reportSkipped(ctx, th.resourceFn.Type(), resource, SkippedReasonMissingCondition)
+		return nil
+	}
+
 	// if a resource is not completed state, no further action needed
 	if th.resourceFn.Ignore(resource) {
 		return nil
 	}
 
+	// if a resource is on legal hold, it should not be deleted
+	if isOnLegalHold(resource) {
+		logger.Debugw("resource is on legal hold, no action needed",
+			"resource", th.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
+		RetentionTracker.Retain(th.resourceFn.Type(), resource, RetentionReasonLegalHold)
+		return nil
+	}
+
 	// update ttl annotation, if not present
-	err := th.updateAnnotationTTLSeconds(ctx, resource)
-	if err != nil {
-		return err
+	// the ttl does not apply to a resource never completed, only the max keep duration
+	if th.resourceFn.IsCompleted(resource) {
+		err := th.updateAnnotationTTLSeconds(ctx, resource)
+		if err != nil {
+			return err
+		}
 	}
 
 	// if the resource is not available for cleanup, no further action needed
@@ -101,12 +137,20 @@ func (th *TTLHandler) updateAnnotationTTLSeconds(ctx context.Context, resource m
 
 	// if the "enforceConfigLevel" is not resource level, do not consider ttl from the resource annotation
 	// take it from namespace config or global config
-	if th.resourceFn.GetEnforcedConfigLevel(resource.GetNamespace(), resourceName) != tektonprunerv1alpha1.EnforcedConfigLevelResource {
+	enforcedConfigLevel := th.resourceFn.GetEnforcedConfigLevel(resource.GetNamespace(), resourceName)
+	metrics.ObserveEnforcedConfigLevel(th.resourceFn.Type(), string(resource.GetUID()), string(enforcedConfigLevel))
+	if enforcedConfigLevel != tektonprunerv1alpha1.EnforcedConfigLevelResource {
 		needsUpdate = true
 	}
 
 	if needsUpdate {
 		ttl := th.resourceFn.GetTTLSecondsAfterFinished(resource.GetNamespace(), resourceName)
+		// the cancelled resources take the ttl of the cancelled resources, if defined
+		if th.resourceFn.IsCancelled(resource) {
+			if cancelledTTL := th.resourceFn.GetCancelledTTLSecondsAfterFinished(resource.GetNamespace(), resourceName); cancelledTTL != nil {
+				ttl = cancelledTTL
+			}
+		}
 		if ttl == nil {
 			logger.Debugw("tll is not defined for this resource, no further action needed",
 				"resource", th.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
@@ -120,18 +164,30 @@ func (th *TTLHandler) updateAnnotationTTLSeconds(ctx context.Context, resource m
 			// there is no change on the TTL, update action not needed
 			return nil
 		}
-		annotations[AnnotationTTLSecondsAfterFinished] = newTTL
-		resource.SetAnnotations(annotations)
 		logger.Debugw("updating ttl of a resource",
 			"resource", th.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(), "ttl", ttl,
 		)
-		return th.resourceFn.Update(ctx, resource)
+		return updateAnnotation(ctx, th.resourceFn.Type(), resource, AnnotationTTLSecondsAfterFinished, newTTL,
+			th.resourceFn.Get, th.resourceFn.Update)
 	}
 	return nil
 }
 
 // needsCleanup checks whether a Resource has finished and has a TTL set.
 func (th *TTLHandler) needsCleanup(resource metav1.Object) bool {
+	// if the resource is not in completed state, cleanup not needed,
+	// unless it is kept longer than the max keep duration since the creation
+	if !th.resourceFn.IsCompleted(resource) && !exceedsMaxKeepDuration(resource, th.clock.Now()) {
+		return false
+	}
+
+	// the max keep duration, the ttl of the deleted definition and the maximum age of a resource without the Succeeded condition
+	// apply, even there is no ttl on the resource
+	if th.getMaxKeepDuration(resource) != nil || th.getDeletedDefinitionTTL(resource) != nil ||
+		getMissingConditionMaxAge(resource, th.resourceFn.IsCompleted) != nil {
+		return true
+	}
+
 	// get the annotations
 	annotations := resource.GetAnnotations()
 	// if there is no annotations present, the resource is not available for cleanup
@@ -140,12 +196,8 @@ func (th *TTLHandler) needsCleanup(resource metav1.Object) bool {
 	}
 	// if there is no ttl present, the resource is not available for cleanup [or]
 	// if the ttl is "-1", no further action needed on this Resource
-	if annotations[AnnotationTTLSecondsAfterFinished] == "" || annotations[AnnotationTTLSecondsAfterFinished] == "-1" {
-		return false
-	}
-
-	// if the resource is not in completed state, cleanup not needed
-	if !th.resourceFn.IsCompleted(resource) {
+	// the ttl in business days takes precedence, if present
+	if !th.hasTTLBusinessDays(resource) && (annotations[AnnotationTTLSecondsAfterFinished] == "" || annotations[AnnotationTTLSecondsAfterFinished] == "-1") {
 		return false
 	}
 
@@ -160,7 +212,7 @@ func (th *TTLHandler) removeResource(ctx context.Context, resource metav1.Object
 	)
 
 	// check the resource ttl status
-	expiredAt, err := th.processTTL(logger, resource)
+	expiredAt, err := th.processTTL(ctx, logger, resource)
 	if err != nil {
 		return err
 	} else if expiredAt == nil {
@@ -179,21 +231,68 @@ func (th *TTLHandler) removeResource(ctx context.Context, resource metav1.Object
 		return err
 	}
 	// use the latest Resource TTL to see if the TTL truly expires.
-	expiredAt, err = th.processTTL(logger, freshResource)
+	expiredAt, err = th.processTTL(ctx, logger, freshResource)
 	if err != nil {
 		return err
 	} else if expiredAt == nil {
 		return nil
 	}
 
+	// the legal hold might be added after the resource received
+	if isOnLegalHold(freshResource) {
+		RetentionTracker.Retain(th.resourceFn.Type(), freshResource, RetentionReasonLegalHold)
+		return nil
+	}
+
+	// the skip annotation might be added after the resource received
+	if isSkipped(freshResource) {
+		reportSkipped(ctx, th.resourceFn.Type(), freshResource, SkippedReasonAnnotation)
+		return nil
+	}
+
+	// the labels might be changed after the resource received, no longer matching the resource selector
+	if !isSelected(freshResource) {
+		reportSkipped(ctx, th.resourceFn.Type(), freshResource, SkippedReasonResourceSelector)
+		return nil
+	}
+
+	// the required annotation might not be added yet by the external system
+	if completionTime, err := th.resourceFn.GetCompletionTime(freshResource); err == nil {
+		if awaiting, waitLeft := isAwaitingRequiredAnnotation(freshResource, completionTime, th.clock.Now()); awaiting {
+			logger.Debugw("resource is waiting for the required annotation, skipping the deletion",
+				"resource", th.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
+			)
+			RetentionTracker.Retain(th.resourceFn.Type(), freshResource, RetentionReasonAwaitingAnnotation)
+			return awaitingRequiredAnnotationRequeue(waitLeft)
+		}
+	}
+
+	// the resource is only reported on the dry run
+	if isDryRun(ctx, th.resourceFn.Type(), freshResource, PrunerPolicyTTL) {
+		return nil
+	}
+
 	// TODO: Cascade deletes the Resources if TTL truly expires.
 	// policy := metav1.DeletePropagationForeground
 	// options := &client.DeleteOptions{
 	// 	PropagationPolicy: &policy,
 	// 	Preconditions:     &metav1.Preconditions{UID: &fresh.UID},
 	// }
-	logger.Debugw("cleaning up a resource",
+	// a hook can abort the deletion
+	err = runBeforeDeleteHooks(ctx, freshResource)
+	if err != nil {
+		logger.Infow("deletion aborted by a hook",
+			"resource", th.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
+			zap.Error(err),
+		)
+		RetentionTracker.Retain(th.resourceFn.Type(), freshResource, RetentionReasonDeletionHook)
+		return deletionAbortedRequeue(freshResource)
+	}
+
+	reason := th.getDeletionReason(freshResource)
+	perResourceLogger(ctx).Debugw("cleaning up a resource",
 		"resource", th.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
+		"reason", reason,
 	)
 	err = th.resourceFn.Delete(ctx, resource.GetNamespace(), resource.GetName())
 	if err != nil {
@@ -207,19 +306,25 @@ func (th *TTLHandler) removeResource(ctx context.Context, resource metav1.Object
 		)
 		return err
 	}
+	metrics.RecordResourceDeleted(ctx, th.resourceFn.Type(), resource.GetNamespace(), reason)
+	PruneTracker.Pruned(th.resourceFn.Type(), resource.GetNamespace())
+	resolvedTTL, _ := th.getTTLSeconds(freshResource)
+	auditDeletion(th.resourceFn.Type(), freshResource, reason, resolvedTTL)
+	RetentionTracker.Forget(th.resourceFn.Type(), resource)
+	runAfterDeleteHooks(ctx, freshResource)
 	return nil
 }
 
 // processTTL checks whether a given Resource's TTL has expired, and add it to the queue after the TTL is expected to expire
 // if the TTL will expire later.
-func (th *TTLHandler) processTTL(logger *zap.SugaredLogger, resource metav1.Object) (expiredAt *time.Time, err error) {
+func (th *TTLHandler) processTTL(ctx context.Context, logger *zap.SugaredLogger, resource metav1.Object) (expiredAt *time.Time, err error) {
 	// We don't care about the Resources that are going to be deleted, or the ones that don't need clean up.
 	if resource.GetDeletionTimestamp() != nil || !th.needsCleanup(resource) {
 		return nil, nil
 	}
 
 	now := th.clock.Now()
-	t, e, err := th.timeLeft(logger, resource, &now)
+	t, e, err := th.timeLeft(ctx, logger, resource, &now)
 	if err != nil {
 		return nil, err
 	}
@@ -229,18 +334,28 @@ func (th *TTLHandler) processTTL(logger *zap.SugaredLogger, resource metav1.Obje
 		return e, nil
 	}
 
+	RetentionTracker.Retain(th.resourceFn.Type(), resource, RetentionReasonWithinTTL)
 	return nil, th.enqueueAfter(logger, resource, *t)
 }
 
 // calculates the remaining time to hold this resource
-func (th *TTLHandler) timeLeft(logger *zap.SugaredLogger, resource metav1.Object, since *time.Time) (*time.Duration, *time.Time, error) {
+func (th *TTLHandler) timeLeft(ctx context.Context, logger *zap.SugaredLogger, resource metav1.Object, since *time.Time) (*time.Duration, *time.Time, error) {
 	finishAt, expireAt, err := th.getFinishAndExpireTime(resource)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// the completion time can be slightly in the future, due to the time skew between the nodes
+	// treat the resource as just completed now, the ttl starts from now
 	if finishAt.After(*since) {
-		logger.Warn("found resource finished in the future. This is likely due to time skew in the cluster. Resource cleanup will be deferred.")
+		logger.Warnw("found resource finished in the future. This is likely due to time skew in the cluster. Resource cleanup will be deferred.",
+			"resource", th.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
+			"finishTime", finishAt.UTC(), "now", since.UTC(),
+		)
+		metrics.RecordFutureCompletionTime(ctx, th.resourceFn.Type(), resource.GetNamespace())
+		_expireAt := since.Add(expireAt.Sub(*finishAt))
+		finishAt = since
+		expireAt = &_expireAt
 	}
 	remaining := expireAt.Sub(*since)
 	logger.Debugw("resource is in finished state",
@@ -254,18 +369,150 @@ func (th *TTLHandler) getFinishAndExpireTime(resource metav1.Object) (*time.Time
 	if !th.needsCleanup(resource) {
 		return nil, nil, fmt.Errorf("resource '%s/%s' should not be cleaned up", resource.GetNamespace(), resource.GetName())
 	}
+	maxKeepDuration := th.getMaxKeepDuration(resource)
 	t, err := th.resourceFn.GetCompletionTime(resource)
 	if err != nil {
-		return nil, nil, err
+		if maxKeepDuration == nil {
+			return nil, nil, err
+		}
+		// without the completion time, the max keep duration applies from the creation time
+		createdAt := resource.GetCreationTimestamp().Time
+		expireAt := createdAt.Add(*maxKeepDuration)
+		return &createdAt, &expireAt, nil
 	}
 	finishAt := t.Time
-	// get ttl duration
-	ttlDuration, err := th.getTTLSeconds(resource)
+
+	// the ttl does not apply to a resource without the Succeeded condition, on the maxAge policy
+	if maxAge := getMissingConditionMaxAge(resource, th.resourceFn.IsCompleted); maxAge != nil {
+		expireAt := finishAt.Add(*maxAge)
+		return &finishAt, &expireAt, nil
+	}
+
+	// the ttl is computed from the start time, if configured
+	ttlFrom := th.getTTLReferenceTime(resource, finishAt)
+
+	var expireAt *time.Time
+	if th.hasTTLBusinessDays(resource) {
+		// the non-business days are skipped, if the ttl is in business days
+		expireAt, err = th.getBusinessDaysExpireTime(resource, ttlFrom)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		// get ttl duration, "-1" never expires
+		ttlDuration, err := th.getTTLSeconds(resource)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ttlDuration != nil && *ttlDuration >= 0 {
+			_expireAt := ttlFrom.Add(*ttlDuration)
+			expireAt = &_expireAt
+		}
+	}
+
+	// the ttl of the deleted definition applies, when it expires earlier
+	if deletedDefinitionTTL := th.getDeletedDefinitionTTL(resource); deletedDefinitionTTL != nil {
+		_expireAt := finishAt.Add(*deletedDefinitionTTL)
+		if expireAt == nil || _expireAt.Before(*expireAt) {
+			expireAt = &_expireAt
+		}
+	}
+
+	// the max keep duration is the ceiling of the ttl
+	if maxKeepDuration != nil {
+		_expireAt := finishAt.Add(*maxKeepDuration)
+		if expireAt == nil || _expireAt.Before(*expireAt) {
+			expireAt = &_expireAt
+		}
+	}
+
+	if expireAt == nil {
+		return nil, nil, fmt.Errorf("resource '%s/%s' has no ttl", resource.GetNamespace(), resource.GetName())
+	}
+	return &finishAt, expireAt, nil
+}
+
+// returns the reference time of the ttl, the start time is used only when it is configured
+// a resource without the start time, falls back to the completion time
+func (th *TTLHandler) getTTLReferenceTime(resource metav1.Object, finishAt time.Time) time.Time {
+	labelKey := getResourceNameLabelKey(resource, th.resourceFn.GetDefaultLabelKey())
+	resourceName := getResourceName(resource, labelKey)
+	if th.resourceFn.GetTTLFrom(resource.GetNamespace(), resourceName) != tektonprunerv1alpha1.TTLFromStart {
+		return finishAt
+	}
+	startTime, err := th.resourceFn.GetStartTime(resource)
+	if err != nil || startTime.IsZero() {
+		return finishAt
+	}
+	return startTime.Time
+}
+
+// returns the maximum duration to keep the resource after the completion, regardless of the ttl
+func (th *TTLHandler) getMaxKeepDuration(resource metav1.Object) *time.Duration {
+	return PrunerConfigStore.GetMaxKeepDuration(resource.GetNamespace())
+}
+
+// ExceedsMaxKeepDuration returns true, when the resource is created before the max keep duration of its namespace
+// a resource never completed has no completion time, the max keep duration applies from the creation time
+func ExceedsMaxKeepDuration(resource metav1.Object) bool {
+	return exceedsMaxKeepDuration(resource, time.Now())
+}
+
+// MaxKeepDurationLeft returns the duration left till the resource exceeds the max keep duration of its namespace,
+// returns false, when no max keep duration is configured
+func MaxKeepDurationLeft(resource metav1.Object) (time.Duration, bool) {
+	maxKeepDuration := PrunerConfigStore.GetMaxKeepDuration(resource.GetNamespace())
+	if maxKeepDuration == nil {
+		return 0, false
+	}
+	return time.Until(resource.GetCreationTimestamp().Add(*maxKeepDuration)), true
+}
+
+func exceedsMaxKeepDuration(resource metav1.Object, now time.Time) bool {
+	maxKeepDuration := PrunerConfigStore.GetMaxKeepDuration(resource.GetNamespace())
+	if maxKeepDuration == nil {
+		return false
+	}
+	return !resource.GetCreationTimestamp().Add(*maxKeepDuration).After(now)
+}
+
+// returns the ttl of the deleted definition, if the definition referenced by the resource is deleted
+func (th *TTLHandler) getDeletedDefinitionTTL(resource metav1.Object) *time.Duration {
+	ttl := PrunerConfigStore.GetDeletedDefinitionTTL()
+	if ttl == nil || !th.resourceFn.IsDefinitionDeleted(resource) {
+		return nil
+	}
+	return ttl
+}
+
+// the ttl in business days is taken only from the resource annotation,
+// hence honored, only when the "enforceConfigLevel" is resource level
+func (th *TTLHandler) hasTTLBusinessDays(resource metav1.Object) bool {
+	annotations := resource.GetAnnotations()
+	if len(annotations) == 0 || annotations[AnnotationTTLBusinessDays] == "" {
+		return false
+	}
+	labelKey := getResourceNameLabelKey(resource, th.resourceFn.GetDefaultLabelKey())
+	resourceName := getResourceName(resource, labelKey)
+	return th.resourceFn.GetEnforcedConfigLevel(resource.GetNamespace(), resourceName) == tektonprunerv1alpha1.EnforcedConfigLevelResource
+}
+
+// returns the expire time of the resource, after the given business days from the finish time
+func (th *TTLHandler) getBusinessDaysExpireTime(resource metav1.Object, finishAt time.Time) (*time.Time, error) {
+	daysString := resource.GetAnnotations()[AnnotationTTLBusinessDays]
+	days, err := strconv.Atoi(daysString)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	if days < 0 {
+		return nil, fmt.Errorf("invalid ttl business days:%d on resource '%s/%s'", days, resource.GetNamespace(), resource.GetName())
+	}
+	calendar, err := PrunerConfigStore.GetBusinessCalendar()
+	if err != nil {
+		return nil, err
 	}
-	expireAt := finishAt.Add(*ttlDuration)
-	return &finishAt, &expireAt, nil
+	expireAt := calendar.addBusinessDays(finishAt, days)
+	return &expireAt, nil
 }
 
 // returns ttl of the resource
@@ -292,7 +539,12 @@ func (th *TTLHandler) getTTLSeconds(resource metav1.Object) (*time.Duration, err
 
 // enqueue the Resource for later reconcile
 // the resource expire duration is in the future
+// the duration is rounded up to the configured precision, avoids the repeated requeue for tiny durations near the expiry
 func (th *TTLHandler) enqueueAfter(logger *zap.SugaredLogger, resource metav1.Object, after time.Duration) error {
+	precision := PrunerConfigStore.GetTTLRequeuePrecision()
+	if remainder := after % precision; remainder != 0 {
+		after += precision - remainder
+	}
 	logger.Debugw("the resource to be reconciled later, it has expire in the future",
 		"resource", th.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(), "waitDuration", after,
 	)
@@ -0,0 +1,145 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	tektonprunerv1alpha1 "github.com/openshift-pipelines/tektoncd-pruner/pkg/apis/tektonpruner/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/ptr"
+)
+
+// resources of a namespace, deleted in memory
+// the completion time of a completed resource is the creation time
+type fakeTTLResourceFuncs struct {
+	resources []metav1.Object
+	deleted   []string
+	// ttl of the resources, nil if not defined
+	ttl *int32
+	// the resources are not completed, when true
+	running bool
+}
+
+func (f *fakeTTLResourceFuncs) Type() string { return KindPipelineRun }
+
+func (f *fakeTTLResourceFuncs) Get(ctx context.Context, namespace, name string) (metav1.Object, error) {
+	for _, res := range f.resources {
+		if res.GetNamespace() == namespace && res.GetName() == name {
+			return res, nil
+		}
+	}
+	return nil, fmt.Errorf("resource '%s/%s' not found", namespace, name)
+}
+
+func (f *fakeTTLResourceFuncs) Delete(ctx context.Context, namespace, name string) error {
+	for index, res := range f.resources {
+		if res.GetNamespace() == namespace && res.GetName() == name {
+			f.resources = append(f.resources[:index], f.resources[index+1:]...)
+			f.deleted = append(f.deleted, name)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (f *fakeTTLResourceFuncs) Update(ctx context.Context, resource metav1.Object) error {
+	return nil
+}
+
+func (f *fakeTTLResourceFuncs) IsCompleted(resource metav1.Object) bool { return !f.running }
+func (f *fakeTTLResourceFuncs) IsCancelled(resource metav1.Object) bool { return false }
+
+func (f *fakeTTLResourceFuncs) GetCompletionTime(resource metav1.Object) (metav1.Time, error) {
+	if f.running {
+		return metav1.Time{}, fmt.Errorf("resource '%s/%s' is not completed", resource.GetNamespace(), resource.GetName())
+	}
+	return resource.GetCreationTimestamp(), nil
+}
+
+func (f *fakeTTLResourceFuncs) GetStartTime(resource metav1.Object) (metav1.Time, error) {
+	return resource.GetCreationTimestamp(), nil
+}
+
+func (f *fakeTTLResourceFuncs) IsDefinitionDeleted(resource metav1.Object) bool { return false }
+func (f *fakeTTLResourceFuncs) Ignore(resource metav1.Object) bool              { return false }
+
+func (f *fakeTTLResourceFuncs) GetTTLSecondsAfterFinished(namespace, name string) *int32 {
+	return f.ttl
+}
+
+func (f *fakeTTLResourceFuncs) GetCancelledTTLSecondsAfterFinished(namespace, name string) *int32 {
+	return nil
+}
+
+func (f *fakeTTLResourceFuncs) GetTTLFrom(namespace, name string) tektonprunerv1alpha1.TTLFrom {
+	return tektonprunerv1alpha1.TTLFromCompletion
+}
+
+func (f *fakeTTLResourceFuncs) GetDefaultLabelKey() string { return LabelPipelineName }
+
+func (f *fakeTTLResourceFuncs) GetEnforcedConfigLevel(namespace, name string) tektonprunerv1alpha1.EnforcedConfigLevel {
+	return tektonprunerv1alpha1.EnforcedConfigLevelResource
+}
+
+func TestTTLBoundary(t *testing.T) {
+	completedAt := time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		sinceCompleted time.Duration
+		requeueAfter   time.Duration
+	}{
+		{
+			name:           "tiny duration before the expiry is rounded up",
+			sinceCompleted: time.Minute - 500*time.Microsecond,
+			requeueAfter:   time.Second,
+		},
+		{
+			name:           "duration before the expiry is rounded up to the precision",
+			sinceCompleted: 30*time.Second + 200*time.Millisecond,
+			requeueAfter:   30 * time.Second,
+		},
+		{
+			name:           "exactly at the expiry deletes",
+			sinceCompleted: time.Minute,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loadTestGlobalConfig(t, "")
+			resource := &metav1.ObjectMeta{
+				Namespace:         "ns-1",
+				Name:              "run-0",
+				Labels:            map[string]string{LabelPipelineName: "foo"},
+				CreationTimestamp: metav1.NewTime(completedAt),
+			}
+			resourceFn := &fakeTTLResourceFuncs{resources: []metav1.Object{resource}, ttl: ptr.Int32(60)}
+			th, err := NewTTLHandler(clocktesting.NewFakeClock(completedAt.Add(test.sinceCompleted)), resourceFn)
+			if err != nil {
+				t.Fatalf("error on getting ttl handler: %v", err)
+			}
+
+			err = th.ProcessEvent(context.Background(), resource)
+			if test.requeueAfter == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if len(resourceFn.deleted) != 1 {
+					t.Fatalf("expected the resource to be deleted at the expiry")
+				}
+				return
+			}
+			isRequeueKey, requeueAfter := controller.IsRequeueKey(err)
+			if !isRequeueKey || requeueAfter != test.requeueAfter {
+				t.Fatalf("expected a requeue after %s, got: %v", test.requeueAfter, err)
+			}
+			if len(resourceFn.deleted) != 0 {
+				t.Fatalf("expected no deletion before the expiry")
+			}
+		})
+	}
+}
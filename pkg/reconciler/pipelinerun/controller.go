@@ -3,14 +3,23 @@ package pipelinerun
 import (
 	"context"
 	"os"
+	"time"
 
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/helper"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
 	pipelineclient "github.com/tektoncd/pipeline/pkg/client/injection/client"
+	pipelineinformer "github.com/tektoncd/pipeline/pkg/client/injection/informers/pipeline/v1/pipeline"
 	pipelineruninformer "github.com/tektoncd/pipeline/pkg/client/injection/informers/pipeline/v1/pipelinerun"
 	pipelinerunreconciler "github.com/tektoncd/pipeline/pkg/client/injection/reconciler/pipeline/v1/pipelinerun"
+	pipelinelisters "github.com/tektoncd/pipeline/pkg/client/listers/pipeline/v1"
 	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/utils/clock"
 	kubeclient "knative.dev/pkg/client/injection/kube/client"
+	namespaceinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/namespace"
 	"knative.dev/pkg/configmap"
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
@@ -22,27 +31,43 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 	// the injection framework automatically. They'll keep a cached representation of the
 	// cluster's state of the respective resource at all times.
 	pipelineRunInformer := pipelineruninformer.Get(ctx)
+	pipelineInformer := pipelineinformer.Get(ctx)
 
 	logger := logging.FromContext(ctx)
 
+	// the history limiter can list the resources from the api server cache
+	listResourceVersion, err := helper.GetHistoryLimitListResourceVersion()
+	if err != nil {
+		logger.Fatalw("error on getting history limit list resource version",
+			"environmentKey", helper.EnvHistoryLimitListFromCache, "environmentValue", os.Getenv(helper.EnvHistoryLimitListFromCache),
+			zap.Error(err),
+		)
+	}
+
 	pipelineRunFuncs := &PipelineRunFuncs{
-		client: pipelineclient.Get(ctx),
+		client:              pipelineclient.Get(ctx),
+		listResourceVersion: listResourceVersion,
+		pipelineLister:      pipelineInformer.Lister(),
+		pipelineRunLister:   pipelineRunInformer.Lister(),
 	}
 	ttlHandler, err := helper.NewTTLHandler(clock.RealClock{}, pipelineRunFuncs)
 	if err != nil {
 		logger.Fatal("error on getting ttl handler", zap.Error(err))
 	}
 
-	historyLimiter, err := helper.NewHistoryLimiter(pipelineRunFuncs)
+	historyLimiter, err := helper.NewHistoryLimiter(clock.RealClock{}, pipelineRunFuncs)
 	if err != nil {
 		logger.Fatal("error on getting history limiter", zap.Error(err))
 	}
 
 	r := &Reconciler{
 		// The client will be needed to create/delete Pods via the API.
-		kubeclient:     kubeclient.Get(ctx),
-		ttlHandler:     ttlHandler,
-		historyLimiter: historyLimiter,
+		kubeclient:        kubeclient.Get(ctx),
+		ttlHandler:        ttlHandler,
+		historyLimiter:    historyLimiter,
+		namespaceLister:   namespaceinformer.Get(ctx).Lister(),
+		pipelineRunFuncs:  pipelineRunFuncs,
+		pipelineRunLister: pipelineRunInformer.Lister(),
 	}
 
 	// number of works to process the events
@@ -61,6 +86,105 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 	impl := pipelinerunreconciler.NewImpl(ctx, r, func(impl *controller.Impl) controller.Options { return ctrlOptions })
 
 	// listen for events on the main resource and enqueue themselves.
-	pipelineRunInformer.Informer().AddEventHandler(controller.HandleAll(impl.Enqueue))
+	// events of the PipelineRuns which are not yet completed are dropped here,
+	// there is nothing to prune until a PipelineRun reaches the completion state
+	pipelineRunInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: filterCompletedPipelineRun(ctx, pipelineRunFuncs, impl.EnqueueAfter),
+		Handler:    controller.HandleAll(impl.Enqueue),
+	})
+
+	// the PipelineRuns of a deleted Pipeline are evaluated again, can be pruned earlier
+	pipelineInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: enqueuePipelineRunsOfDeletedPipeline(pipelineRunInformer.Lister(), impl),
+	})
+
+	// reports the PipelineRuns never reached the completion state
+	// a pending PipelineRun is not started intentionally, not considered as stuck
+	// a nested PipelineRun is reported with its parent, when the nested PipelineRuns are handled by the parent
+	stuckRunDetector := helper.NewStuckRunDetector(pipelineRunFuncs, r.namespaceLister, helper.IsLeaderForFunc(impl), func() ([]metav1.Object, error) {
+		prs, err := pipelineRunInformer.Lister().List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		resources := []metav1.Object{}
+		for _, pr := range prs {
+			if !pr.IsPending() && !isNestedPipelineRun(pr, r.pipelineRunLister) {
+				resources = append(resources, pr)
+			}
+		}
+		return resources, nil
+	})
+	go stuckRunDetector.Run(ctx, helper.DefaultStuckRunDetectionInterval)
+
+	// the deleted PipelineRuns are not tracked anymore
+	pipelineRunInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: helper.ForgetOnDelete(helper.KindPipelineRun),
+	})
 	return impl
 }
+
+// filters the pipelinerun which is in completed state
+// a PipelineRun never completed gets no events once idle, enqueued at the time it exceeds the max keep duration
+func filterCompletedPipelineRun(ctx context.Context, pipelineRunFuncs *PipelineRunFuncs, enqueueAfter func(obj interface{}, after time.Duration)) func(obj interface{}) bool {
+	return func(obj interface{}) bool {
+		pr, ok := obj.(*pipelinev1.PipelineRun)
+		if !ok {
+			return false
+		}
+		// a PipelineRun never completed is enqueued, once it exceeds the max keep duration
+		if !pipelineRunFuncs.IsCompleted(pr) && !helper.ExceedsMaxKeepDuration(pr) {
+			if left, found := helper.MaxKeepDurationLeft(pr); found {
+				enqueueAfter(pr, left)
+			}
+			return false
+		}
+		// used to measure the time since the completion and the time till the reconciler acts on it
+		helper.QueueLatencyTracker.MarkEligible(ctx, helper.KindPipelineRun, pr, pipelineRunFuncs.GetCompletionTime)
+		return true
+	}
+}
+
+// enqueues the completed PipelineRuns referencing a deleted Pipeline
+func enqueuePipelineRunsOfDeletedPipeline(lister pipelinelisters.PipelineRunLister, impl *controller.Impl) func(obj interface{}) {
+	return func(obj interface{}) {
+		if helper.PrunerConfigStore.GetDeletedDefinitionTTL() == nil {
+			return
+		}
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		pipeline, ok := obj.(*pipelinev1.Pipeline)
+		if !ok {
+			return
+		}
+		selector := labels.SelectorFromSet(labels.Set{helper.LabelPipelineName: pipeline.Name})
+		prs, err := lister.PipelineRuns(pipeline.Namespace).List(selector)
+		if err != nil {
+			return
+		}
+		for _, pr := range prs {
+			if pr.Spec.PipelineRef != nil && pr.Spec.PipelineRef.Name == pipeline.Name {
+				impl.Enqueue(pr)
+			}
+		}
+	}
+}
+
+// returns true if the PipelineRun is created by another PipelineRun which still exists,
+// and the nested PipelineRuns are handled by the parent
+// owner references are dropped on orphan deletion of the parent, such a PipelineRun is pruned on its own
+func isNestedPipelineRun(pipelineRun metav1.Object, pipelineRunLister pipelinelisters.PipelineRunLister) bool {
+	if helper.PrunerConfigStore.GetNestedPipelineRunHandling() != helper.NestedPipelineRunHandlingParent {
+		return false
+	}
+	for _, ownerReference := range pipelineRun.GetOwnerReferences() {
+		if ownerReference.Kind != helper.KindPipelineRun {
+			continue
+		}
+		// the parent is waiting for the garbage collection, the PipelineRun is orphaned
+		if _, err := pipelineRunLister.PipelineRuns(pipelineRun.GetNamespace()).Get(ownerReference.Name); !errors.IsNotFound(err) {
+			return true
+		}
+	}
+	return false
+}
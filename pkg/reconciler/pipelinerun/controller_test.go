@@ -0,0 +1,84 @@
+package pipelinerun
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/helper"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func loadTestGlobalConfig(t *testing.T, config string) {
+	t.Helper()
+	err := helper.PrunerConfigStore.LoadGlobalConfig(&corev1.ConfigMap{Data: map[string]string{helper.PrunerGlobalConfigKey: config}})
+	if err != nil {
+		t.Fatalf("error on loading the global config: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = helper.PrunerConfigStore.LoadGlobalConfig(&corev1.ConfigMap{})
+	})
+}
+
+// returns a started PipelineRun, which has no completion time
+func newRunningPipelineRun(name string, createdAt time.Time) *pipelinev1.PipelineRun {
+	pr := &pipelinev1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "ns-1",
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(createdAt),
+		},
+	}
+	pr.Status.StartTime = &metav1.Time{Time: createdAt}
+	return pr
+}
+
+func TestFilterPipelineRunNeverCompleted(t *testing.T) {
+	loadTestGlobalConfig(t, `
+maxKeepDuration: 1h
+`)
+	tests := []struct {
+		name            string
+		createdAgo      time.Duration
+		expectedPassed  bool
+		expectedEnqueue bool
+	}{
+		{name: "within the max keep duration", createdAgo: 10 * time.Minute, expectedPassed: false, expectedEnqueue: true},
+		{name: "exceeds the max keep duration", createdAgo: 2 * time.Hour, expectedPassed: true, expectedEnqueue: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pr := newRunningPipelineRun("pr-1", time.Now().Add(-test.createdAgo))
+			enqueued := false
+			var enqueuedAfter time.Duration
+			filter := filterCompletedPipelineRun(context.Background(), &PipelineRunFuncs{}, func(obj interface{}, after time.Duration) {
+				enqueued = true
+				enqueuedAfter = after
+			})
+
+			if passed := filter(pr); passed != test.expectedPassed {
+				t.Fatalf("expected the filter to return %v, got %v", test.expectedPassed, passed)
+			}
+			if enqueued != test.expectedEnqueue {
+				t.Fatalf("expected enqueued %v, got %v", test.expectedEnqueue, enqueued)
+			}
+			// enqueued at the time it exceeds the max keep duration
+			if enqueued && (enqueuedAfter > 50*time.Minute || enqueuedAfter < 49*time.Minute) {
+				t.Errorf("expected to be enqueued after about 50 minutes, got %v", enqueuedAfter)
+			}
+		})
+	}
+}
+
+func TestFilterPipelineRunNeverCompletedWithoutMaxKeepDuration(t *testing.T) {
+	loadTestGlobalConfig(t, ``)
+	pr := newRunningPipelineRun("pr-1", time.Now().Add(-24*time.Hour))
+	filter := filterCompletedPipelineRun(context.Background(), &PipelineRunFuncs{}, func(obj interface{}, after time.Duration) {
+		t.Fatalf("unexpected enqueue after %v", after)
+	})
+	if filter(pr) {
+		t.Fatal("expected the filter to drop the PipelineRun never completed")
+	}
+}
@@ -4,16 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	tektonprunerv1alpha1 "github.com/openshift-pipelines/tektoncd-pruner/pkg/apis/tektonpruner/v1alpha1"
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/helper"
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
 	pipelineversioned "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
 	pipelinerunreconciler "github.com/tektoncd/pipeline/pkg/client/injection/reconciler/pipeline/v1/pipelinerun"
+	pipelinelisters "github.com/tektoncd/pipeline/pkg/client/listers/pipeline/v1"
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"knative.dev/pkg/apis"
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
@@ -22,9 +28,14 @@ import (
 
 // Reconciler
 type Reconciler struct {
-	kubeclient     kubernetes.Interface
-	ttlHandler     *helper.TTLHandler
-	historyLimiter *helper.HistoryLimiter
+	kubeclient       kubernetes.Interface
+	ttlHandler       *helper.TTLHandler
+	historyLimiter   *helper.HistoryLimiter
+	pipelineRunFuncs *PipelineRunFuncs
+	// used to check the namespace annotations
+	namespaceLister corelisters.NamespaceLister
+	// used to check the parent of the nested PipelineRuns
+	pipelineRunLister pipelinelisters.PipelineRunLister
 }
 
 // Check that our Reconciler implements Interface
@@ -37,20 +48,75 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, pr *pipelinev1.PipelineR
 		"namespace", pr.Namespace, "name", pr.Name,
 	)
 
+	// time taken to act on a PipelineRun, since its completion observed
+	helper.QueueLatencyTracker.Observe(ctx, helper.KindPipelineRun, pr)
+
+	// a PipelineRun which is not completed can not be pruned, unless it exceeds the max keep duration,
+	// no need to go through the ttl handler and the history limiter
+	if !r.pipelineRunFuncs.IsCompleted(pr) && !helper.ExceedsMaxKeepDuration(pr) {
+		// evaluated again, once it exceeds the max keep duration
+		if left, found := helper.MaxKeepDurationLeft(pr); found {
+			return controller.NewRequeueAfter(left)
+		}
+		return nil
+	}
+
+	// a nested PipelineRun is pruned along with its parent, if configured
+	if isNestedPipelineRun(pr, r.pipelineRunLister) {
+		logger.Debugw("PipelineRun is created by another PipelineRun, pruned along with the parent",
+			"namespace", pr.Namespace, "name", pr.Name,
+		)
+		return nil
+	}
+
+	// the pruning is paused, the completed PipelineRun is evaluated again after the interval, resumed once unpaused
+	if helper.PrunerConfigStore.IsPaused() {
+		logger.Debugw("pruning is paused, skipping the PipelineRun",
+			"namespace", pr.Namespace, "name", pr.Name,
+		)
+		return controller.NewRequeueAfter(helper.DefaultPausedRequeueInterval)
+	}
+
+	var err error
+	// the failed reconciles are used to compute the error ratio
+	defer func() {
+		isRequeueKey, _ := controller.IsRequeueKey(err)
+		metrics.RecordReconcileResult(ctx, helper.KindPipelineRun, err != nil && !isRequeueKey)
+		if err != nil && !isRequeueKey {
+			metrics.RecordReconcileError(ctx, helper.KindPipelineRun, err)
+		} else {
+			metrics.RecordLastReconcile(ctx, pr.Namespace, time.Now())
+		}
+	}()
+
+	// the namespace selector is evaluated on the cached namespace, evaluated again once the namespace is in the cache
+	if err = helper.NamespaceNotCachedRequeue(r.namespaceLister, pr.Namespace); err != nil {
+		return err
+	}
+
 	// execute the history limiter earlier than the ttl handler
 
 	// execute history limit action
-	err := r.historyLimiter.ProcessEvent(ctx, pr)
+	// the namespace owner can disable the policies with the namespace annotation
+	if !helper.IsPolicyDisabledOnNamespace(ctx, r.namespaceLister, pr.Namespace, helper.PrunerPolicyHistoryLimit) {
+		err = r.historyLimiter.ProcessEvent(ctx, pr)
+	}
 	if err != nil {
-		logger.Errorw("error on processing history limiting for a PipelineRun",
-			"namespace", pr.Namespace, "name", pr.Name,
-			zap.Error(err),
-		)
+		isRequeueKey, _ := controller.IsRequeueKey(err)
+		// the error is not a requeue error, print the error
+		if !isRequeueKey {
+			logger.Errorw("error on processing history limiting for a PipelineRun",
+				"namespace", pr.Namespace, "name", pr.Name,
+				zap.Error(err),
+			)
+		}
 		return err
 	}
 
 	// execute ttl handler
-	err = r.ttlHandler.ProcessEvent(ctx, pr)
+	if !helper.IsPolicyDisabledOnNamespace(ctx, r.namespaceLister, pr.Namespace, helper.PrunerPolicyTTL) {
+		err = r.ttlHandler.ProcessEvent(ctx, pr)
+	}
 	if err != nil {
 		isRequeueKey, _ := controller.IsRequeueKey(err)
 		// the error is not a requeue error, print the error
@@ -70,24 +136,47 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, pr *pipelinev1.PipelineR
 
 type PipelineRunFuncs struct {
 	client pipelineversioned.Interface
+	// resource version of the list calls, "0" allows the api server cached reads
+	listResourceVersion string
+	// used to check the existence of the referenced Pipelines
+	pipelineLister pipelinelisters.PipelineLister
+	// used to count the PipelineRuns of a namespace, without an api call
+	pipelineRunLister pipelinelisters.PipelineRunLister
 }
 
 func (prf *PipelineRunFuncs) Type() string {
 	return helper.KindPipelineRun
 }
 
-func (prf *PipelineRunFuncs) List(ctx context.Context, namespace, label string) ([]metav1.Object, error) {
-	// TODO: should we have to implement pagination support?
-	prsList, err := prf.client.TektonV1().PipelineRuns(namespace).List(ctx, metav1.ListOptions{LabelSelector: label})
+func (prf *PipelineRunFuncs) List(ctx context.Context, namespace, label string) ([]metav1.Object, string, error) {
+	options := metav1.ListOptions{LabelSelector: label, ResourceVersion: prf.listResourceVersion}
+	return helper.ListAll(ctx, options, func(ctx context.Context, options metav1.ListOptions) ([]metav1.Object, metav1.ListMeta, error) {
+		prsList, err := prf.client.TektonV1().PipelineRuns(namespace).List(ctx, options)
+		if err != nil {
+			return nil, metav1.ListMeta{}, err
+		}
+		prs := make([]metav1.Object, 0, len(prsList.Items))
+		for index := range prsList.Items {
+			prs = append(prs, &prsList.Items[index])
+		}
+		return prs, prsList.ListMeta, nil
+	})
+}
+
+func (prf *PipelineRunFuncs) ListFromCache(namespace, label string) ([]metav1.Object, error) {
+	selector, err := labels.Parse(label)
 	if err != nil {
 		return nil, err
 	}
-
-	prs := []metav1.Object{}
-	for _, pr := range prsList.Items {
-		prs = append(prs, pr.DeepCopy())
+	prs, err := prf.pipelineRunLister.PipelineRuns(namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]metav1.Object, 0, len(prs))
+	for _, pr := range prs {
+		resources = append(resources, pr)
 	}
-	return prs, nil
+	return resources, nil
 }
 
 func (prf *PipelineRunFuncs) Get(ctx context.Context, namespace, name string) (metav1.Object, error) {
@@ -95,7 +184,142 @@ func (prf *PipelineRunFuncs) Get(ctx context.Context, namespace, name string) (m
 }
 
 func (prf *PipelineRunFuncs) Delete(ctx context.Context, namespace, name string) error {
-	return prf.client.TektonV1().PipelineRuns(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	return prf.deletePipelineRun(ctx, namespace, name, nil)
+}
+
+func (prf *PipelineRunFuncs) DeleteUnchanged(ctx context.Context, resource metav1.Object) error {
+	return prf.deletePipelineRun(ctx, resource.GetNamespace(), resource.GetName(), helper.UnchangedPreconditions(resource))
+}
+
+// deletes the PipelineRun with the preconditions, the children are deleted along with it on the cascade
+func (prf *PipelineRunFuncs) deletePipelineRun(ctx context.Context, namespace, name string, preconditions *metav1.Preconditions) error {
+	if helper.PrunerConfigStore.GetPipelineRunChildHandling() != helper.PipelineRunChildHandlingCascade {
+		return prf.client.TektonV1().PipelineRuns(namespace).Delete(ctx, name, metav1.DeleteOptions{Preconditions: preconditions})
+	}
+
+	pr, err := prf.client.TektonV1().PipelineRuns(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	// the children of a changed PipelineRun are not touched
+	if preconditions != nil && (pr.UID != *preconditions.UID || pr.ResourceVersion != *preconditions.ResourceVersion) {
+		return errors.NewConflict(pipelinev1.Resource("pipelineruns"), name, fmt.Errorf("the PipelineRun is changed since it is read"))
+	}
+	children, childRetained, err := prf.selectChildTaskRuns(ctx, pr)
+	if err != nil {
+		return err
+	}
+	// the children are deleted before the PipelineRun, a failed child deletion keeps the PipelineRun to be retried,
+	// the children are not orphaned by the PipelineRun deleted earlier
+	if err := prf.deleteTaskRuns(ctx, namespace, children); err != nil {
+		return err
+	}
+	deleteOptions := parentDeleteOptions(childRetained)
+	deleteOptions.Preconditions = preconditions
+	return prf.client.TektonV1().PipelineRuns(namespace).Delete(ctx, name, deleteOptions)
+}
+
+func (prf *PipelineRunFuncs) DeleteCollection(ctx context.Context, namespace, label, resourceVersion string) error {
+	listOptions := metav1.ListOptions{
+		LabelSelector:        label,
+		ResourceVersion:      resourceVersion,
+		ResourceVersionMatch: metav1.ResourceVersionMatchExact,
+	}
+	if helper.PrunerConfigStore.GetPipelineRunChildHandling() != helper.PipelineRunChildHandlingCascade {
+		return prf.client.TektonV1().PipelineRuns(namespace).DeleteCollection(ctx, metav1.DeleteOptions{}, listOptions)
+	}
+
+	// list the PipelineRuns going to be deleted, the children are deleted before the collection
+	// the collection deletion fails on a compacted resource version, the PipelineRuns are deleted one by one then
+	prsList, err := prf.client.TektonV1().PipelineRuns(namespace).List(ctx, listOptions)
+	if err != nil {
+		return err
+	}
+	children := []*pipelinev1.TaskRun{}
+	anyChildRetained := false
+	for index := range prsList.Items {
+		prChildren, childRetained, err := prf.selectChildTaskRuns(ctx, &prsList.Items[index])
+		if err != nil {
+			return err
+		}
+		children = append(children, prChildren...)
+		anyChildRetained = anyChildRetained || childRetained
+	}
+	if err := prf.deleteTaskRuns(ctx, namespace, children); err != nil {
+		return err
+	}
+	return prf.client.TektonV1().PipelineRuns(namespace).DeleteCollection(ctx, parentDeleteOptions(anyChildRetained), listOptions)
+}
+
+// returns the TaskRuns listed in the childReferences of a PipelineRun to be deleted along with it,
+// and true, if any of the children is retained
+// only the TaskRuns owned by the PipelineRun are deleted, the TaskRuns already deleted are ignored
+// a TaskRun on legal hold, with the skip annotation or on the dry run is retained
+func (prf *PipelineRunFuncs) selectChildTaskRuns(ctx context.Context, pr *pipelinev1.PipelineRun) ([]*pipelinev1.TaskRun, bool, error) {
+	logger := logging.FromContext(ctx)
+	children := []*pipelinev1.TaskRun{}
+	childRetained := false
+	for _, childReference := range pr.Status.ChildReferences {
+		if childReference.Kind != helper.KindTaskRun || childReference.Name == "" {
+			continue
+		}
+		tr, err := prf.client.TektonV1().TaskRuns(pr.Namespace).Get(ctx, childReference.Name, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, false, err
+		}
+		// a TaskRun recreated with the same name is not a child of this PipelineRun
+		if !isOwnedBy(tr, pr) {
+			logger.Debugw("TaskRun listed on the childReferences is not owned by the PipelineRun, skipping the deletion",
+				"namespace", pr.Namespace, "pipelineRun", pr.Name, "name", tr.Name,
+			)
+			continue
+		}
+		if !helper.IsChildDeletable(ctx, helper.KindTaskRun, tr) {
+			childRetained = true
+			continue
+		}
+		children = append(children, tr)
+	}
+	return children, childRetained, nil
+}
+
+// deletes the child TaskRuns, the uid precondition protects a TaskRun recreated with the same name
+func (prf *PipelineRunFuncs) deleteTaskRuns(ctx context.Context, namespace string, trs []*pipelinev1.TaskRun) error {
+	logger := logging.FromContext(ctx)
+	for _, tr := range trs {
+		logger.Debugw("deleting a child TaskRun",
+			"namespace", namespace, "name", tr.Name,
+		)
+		deleteOptions := metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &tr.UID}}
+		err := prf.client.TektonV1().TaskRuns(namespace).Delete(ctx, tr.Name, deleteOptions)
+		if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// the owned TaskRuns are removed by the kubernetes garbage collector along with the PipelineRun,
+// when a child is retained, the children are orphaned, the selected children are deleted by the pruner
+func parentDeleteOptions(childRetained bool) metav1.DeleteOptions {
+	if !childRetained {
+		return metav1.DeleteOptions{}
+	}
+	propagationPolicy := metav1.DeletePropagationOrphan
+	return metav1.DeleteOptions{PropagationPolicy: &propagationPolicy}
+}
+
+// returns true, if the TaskRun has an owner reference to the PipelineRun
+func isOwnedBy(tr *pipelinev1.TaskRun, pr *pipelinev1.PipelineRun) bool {
+	for _, ownerReference := range tr.GetOwnerReferences() {
+		if ownerReference.Kind == helper.KindPipelineRun && ownerReference.UID == pr.UID {
+			return true
+		}
+	}
+	return false
 }
 
 func (prf *PipelineRunFuncs) Update(ctx context.Context, resource metav1.Object) error {
@@ -113,21 +337,33 @@ func (prf *PipelineRunFuncs) GetCompletionTime(resource metav1.Object) (metav1.T
 		return metav1.Time{}, fmt.Errorf("resource type error, this is not a PipelineRun resource. namespace:%s, name:%s, type:%T",
 			resource.GetNamespace(), resource.GetName(), resource)
 	}
-	if pr.Status.CompletionTime != nil {
-		return *pr.Status.CompletionTime, nil
+	return helper.GetCompletionTime(prf.Type(), pr, pr.Status.CompletionTime, pr.Status.GetCondition(apis.ConditionSucceeded))
+}
+
+func (prf *PipelineRunFuncs) GetStartTime(resource metav1.Object) (metav1.Time, error) {
+	pr, ok := resource.(*pipelinev1.PipelineRun)
+	if !ok {
+		return metav1.Time{}, fmt.Errorf("resource type error, this is not a PipelineRun resource. namespace:%s, name:%s, type:%T",
+			resource.GetNamespace(), resource.GetName(), resource)
 	}
-	for _, c := range pr.Status.Conditions {
-		if c.Type == apis.ConditionSucceeded && c.Status != corev1.ConditionUnknown {
-			finishAt := c.LastTransitionTime
-			if finishAt.Inner.IsZero() {
-				return metav1.Time{}, fmt.Errorf("unable to find the time when the resource '%s/%s' finished", pr.Namespace, pr.Name)
-			}
-			return c.LastTransitionTime.Inner, nil
-		}
+	if pr.Status.StartTime == nil {
+		return metav1.Time{}, fmt.Errorf("unable to find the start time of the resource: %s/%s", resource.GetNamespace(), resource.GetName())
 	}
+	return *pr.Status.StartTime, nil
+}
 
-	// This should never happen if the Resource has finished
-	return metav1.Time{}, fmt.Errorf("unable to find the status of the finished resource: %s/%s", pr.Namespace, pr.Name)
+// IsDefinitionDeleted returns true, if the Pipeline referenced by name is not found in the namespace
+// the embedded and the remote (resolver) Pipelines are never reported as deleted
+func (prf *PipelineRunFuncs) IsDefinitionDeleted(resource metav1.Object) bool {
+	pr, ok := resource.(*pipelinev1.PipelineRun)
+	if !ok || prf.pipelineLister == nil {
+		return false
+	}
+	if pr.Spec.PipelineRef == nil || pr.Spec.PipelineRef.Name == "" || pr.Spec.PipelineRef.Resolver != "" {
+		return false
+	}
+	_, err := prf.pipelineLister.Pipelines(pr.Namespace).Get(pr.Spec.PipelineRef.Name)
+	return errors.IsNotFound(err)
 }
 
 func (prf *PipelineRunFuncs) Ignore(resource metav1.Object) bool {
@@ -178,30 +414,88 @@ func (prf *PipelineRunFuncs) IsSuccessful(resource metav1.Object) bool {
 	}
 
 	condition := pr.Status.GetCondition(apis.ConditionSucceeded)
-	if condition == nil {
+	if condition == nil || condition.Status != corev1.ConditionTrue {
 		return false
 	}
 
+	// "Completed" is reported, when some of the tasks are skipped
 	runReason := pipelinev1.PipelineRunReason(condition.Reason)
+	return runReason == pipelinev1.PipelineRunReasonSuccessful || runReason == pipelinev1.PipelineRunReasonCompleted
+}
 
-	if runReason == pipelinev1.PipelineRunReasonSuccessful || runReason == pipelinev1.PipelineRunReasonCompleted {
-		return true
+// IsFailed returns true for all the finished PipelineRuns not succeeded,
+// includes the failed, timed out and cancelled PipelineRuns
+func (prf *PipelineRunFuncs) IsFailed(resource metav1.Object) bool {
+	pr, ok := resource.(*pipelinev1.PipelineRun)
+	if !ok {
+		return false
+	}
+
+	if pr.IsPending() {
+		return false
 	}
 
+	condition := pr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil {
+		// no condition on a completed PipelineRun, treated as failed
+		return pr.Status.CompletionTime != nil
+	}
+	if condition.Status == corev1.ConditionUnknown {
+		return false
+	}
+
+	return !prf.IsSuccessful(resource)
+}
+
+// IsCancelled returns true, when the PipelineRun is finished by a cancellation,
+// with or without running the finally tasks
+func (prf *PipelineRunFuncs) IsCancelled(resource metav1.Object) bool {
+	pr, ok := resource.(*pipelinev1.PipelineRun)
+	if !ok {
+		return false
+	}
+
+	condition := pr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil || condition.Status != corev1.ConditionFalse {
+		return false
+	}
+
+	switch pipelinev1.PipelineRunReason(condition.Reason) {
+	case pipelinev1.PipelineRunReasonCancelled,
+		pipelinev1.PipelineRunReasonCancelledRunningFinally,
+		pipelinev1.PipelineRunReasonStoppedRunningFinally:
+		return true
+	}
 	return false
 }
 
-func (prf *PipelineRunFuncs) IsFailed(resource metav1.Object) bool {
+// IsTimedOut returns true, when the PipelineRun is finished by a timeout
+func (prf *PipelineRunFuncs) IsTimedOut(resource metav1.Object) bool {
 	pr, ok := resource.(*pipelinev1.PipelineRun)
 	if !ok {
 		return false
 	}
 
-	if pr.IsPending() {
+	condition := pr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil || condition.Status != corev1.ConditionFalse {
 		return false
 	}
 
-	return !prf.IsSuccessful(resource)
+	return pipelinev1.PipelineRunReason(condition.Reason) == pipelinev1.PipelineRunReasonTimedOut
+}
+
+// GetReason returns the reason of the Succeeded condition, empty if not available
+func (prf *PipelineRunFuncs) GetReason(resource metav1.Object) string {
+	pr, ok := resource.(*pipelinev1.PipelineRun)
+	if !ok {
+		return ""
+	}
+
+	condition := pr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil {
+		return ""
+	}
+	return condition.Reason
 }
 
 func (prf *PipelineRunFuncs) GetDefaultLabelKey() string {
@@ -212,6 +506,14 @@ func (prf *PipelineRunFuncs) GetTTLSecondsAfterFinished(namespace, pipelineName
 	return helper.PrunerConfigStore.GetPipelineTTLSecondsAfterFinished(namespace, pipelineName)
 }
 
+func (prf *PipelineRunFuncs) GetCancelledTTLSecondsAfterFinished(namespace, name string) *int32 {
+	return helper.PrunerConfigStore.GetPipelineCancelledTTLSecondsAfterFinished(namespace, name)
+}
+
+func (prf *PipelineRunFuncs) GetTTLFrom(namespace, name string) tektonprunerv1alpha1.TTLFrom {
+	return helper.PrunerConfigStore.GetPipelineTTLFrom(namespace, name)
+}
+
 func (prf *PipelineRunFuncs) GetSuccessHistoryLimitCount(namespace, name string) *int32 {
 	return helper.PrunerConfigStore.GetPipelineSuccessHistoryLimitCount(namespace, name)
 }
@@ -220,6 +522,14 @@ func (prf *PipelineRunFuncs) GetFailedHistoryLimitCount(namespace, name string)
 	return helper.PrunerConfigStore.GetPipelineFailedHistoryLimitCount(namespace, name)
 }
 
+func (prf *PipelineRunFuncs) GetCancelledHistoryLimitCount(namespace, name string) *int32 {
+	return helper.PrunerConfigStore.GetPipelineCancelledHistoryLimitCount(namespace, name)
+}
+
+func (prf *PipelineRunFuncs) GetGroupByLabelKeys(namespace, name string) []string {
+	return helper.PrunerConfigStore.GetPipelineGroupBy(namespace, name)
+}
+
 func (prf *PipelineRunFuncs) GetEnforcedConfigLevel(namespace, name string) tektonprunerv1alpha1.EnforcedConfigLevel {
 	return helper.PrunerConfigStore.GetPipelineEnforcedConfigLevel(namespace, name)
 }
@@ -0,0 +1,245 @@
+package pipelinerun
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/helper"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	tektonv1 "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/typed/pipeline/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// records the list options of the PipelineRuns, the fake clientset does not keep the resource version of the list
+type listRecordingClientset struct {
+	*fake.Clientset
+	listOptions []metav1.ListOptions
+}
+
+func (c *listRecordingClientset) TektonV1() tektonv1.TektonV1Interface {
+	return &listRecordingTektonV1{TektonV1Interface: c.Clientset.TektonV1(), clientset: c}
+}
+
+type listRecordingTektonV1 struct {
+	tektonv1.TektonV1Interface
+	clientset *listRecordingClientset
+}
+
+func (c *listRecordingTektonV1) PipelineRuns(namespace string) tektonv1.PipelineRunInterface {
+	return &listRecordingPipelineRuns{PipelineRunInterface: c.TektonV1Interface.PipelineRuns(namespace), clientset: c.clientset}
+}
+
+type listRecordingPipelineRuns struct {
+	tektonv1.PipelineRunInterface
+	clientset *listRecordingClientset
+}
+
+func (c *listRecordingPipelineRuns) List(ctx context.Context, options metav1.ListOptions) (*pipelinev1.PipelineRunList, error) {
+	c.clientset.listOptions = append(c.clientset.listOptions, options)
+	return c.PipelineRunInterface.List(ctx, options)
+}
+
+func newPipelineRun(name, uid, resourceVersion string) *pipelinev1.PipelineRun {
+	return &pipelinev1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "ns-1",
+			Name:            name,
+			UID:             types.UID(uid),
+			ResourceVersion: resourceVersion,
+			Labels:          map[string]string{helper.LabelPipelineName: "foo"},
+		},
+	}
+}
+
+func TestHistoryLimitListOptions(t *testing.T) {
+	tests := []struct {
+		name                    string
+		listFromCache           string
+		expectedResourceVersion string
+	}{
+		{name: "quorum read by default", expectedResourceVersion: ""},
+		{name: "api server cache", listFromCache: "true", expectedResourceVersion: "0"},
+		{name: "quorum read", listFromCache: "false", expectedResourceVersion: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.listFromCache != "" {
+				t.Setenv(helper.EnvHistoryLimitListFromCache, test.listFromCache)
+			}
+			listResourceVersion, err := helper.GetHistoryLimitListResourceVersion()
+			if err != nil {
+				t.Fatalf("error on getting the list resource version: %v", err)
+			}
+			client := &listRecordingClientset{Clientset: fake.NewSimpleClientset(newPipelineRun("pr-1", "uid-1", "1"))}
+			prf := &PipelineRunFuncs{client: client, listResourceVersion: listResourceVersion}
+
+			resources, _, err := prf.List(context.Background(), "ns-1", helper.LabelPipelineName+"=foo")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(resources) != 1 {
+				t.Fatalf("expected 1 listed PipelineRun, got %d", len(resources))
+			}
+			if len(client.listOptions) != 1 {
+				t.Fatalf("expected 1 list call, got %d", len(client.listOptions))
+			}
+			options := client.listOptions[0]
+			if options.ResourceVersion != test.expectedResourceVersion {
+				t.Errorf("expected the list resource version %q, got %q", test.expectedResourceVersion, options.ResourceVersion)
+			}
+			if options.LabelSelector != helper.LabelPipelineName+"=foo" {
+				t.Errorf("expected the label selector of the history, got %q", options.LabelSelector)
+			}
+		})
+	}
+}
+
+func TestDeleteUnchangedPreconditions(t *testing.T) {
+	loadTestGlobalConfig(t, ``)
+	pr := newPipelineRun("pr-1", "uid-1", "7")
+	client := fake.NewSimpleClientset(pr)
+	var deleteOptions []metav1.DeleteOptions
+	client.PrependReactor("delete", "pipelineruns", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		deleteOptions = append(deleteOptions, action.(k8stesting.DeleteActionImpl).DeleteOptions)
+		return false, nil, nil
+	})
+	prf := &PipelineRunFuncs{client: client}
+
+	if err := prf.DeleteUnchanged(context.Background(), pr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(deleteOptions) != 1 {
+		t.Fatalf("expected 1 delete call, got %d", len(deleteOptions))
+	}
+	preconditions := deleteOptions[0].Preconditions
+	if preconditions == nil || preconditions.UID == nil || *preconditions.UID != "uid-1" ||
+		preconditions.ResourceVersion == nil || *preconditions.ResourceVersion != "7" {
+		t.Fatalf("expected the uid and the resource version preconditions, got %+v", preconditions)
+	}
+}
+
+// returns a TaskRun owned by the PipelineRun
+func newChildTaskRun(pr *pipelinev1.PipelineRun, name string, annotations map[string]string) *pipelinev1.TaskRun {
+	return &pipelinev1.TaskRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       pr.Namespace,
+			Name:            name,
+			UID:             types.UID("uid-" + name),
+			Labels:          map[string]string{helper.LabelPipelineRunName: pr.Name},
+			Annotations:     annotations,
+			OwnerReferences: []metav1.OwnerReference{{Kind: helper.KindPipelineRun, Name: pr.Name, UID: pr.UID}},
+		},
+	}
+}
+
+func TestCascadeDelete(t *testing.T) {
+	tests := []struct {
+		name string
+		// children listed on the childReferences of the PipelineRun
+		childNames []string
+		// children available on the cluster
+		children           func(pr *pipelinev1.PipelineRun) []*pipelinev1.TaskRun
+		childDeleteFails   bool
+		expectedError      bool
+		expectedDeletes    []string
+		expectedPropagated bool
+	}{
+		{
+			name:       "children deleted before the PipelineRun",
+			childNames: []string{"tr-1", "tr-2"},
+			children: func(pr *pipelinev1.PipelineRun) []*pipelinev1.TaskRun {
+				return []*pipelinev1.TaskRun{newChildTaskRun(pr, "tr-1", nil), newChildTaskRun(pr, "tr-2", nil)}
+			},
+			expectedDeletes:    []string{"taskruns/tr-1", "taskruns/tr-2", "pipelineruns/pr-1"},
+			expectedPropagated: true,
+		},
+		{
+			name:               "children already deleted",
+			childNames:         []string{"tr-1", "tr-2"},
+			expectedDeletes:    []string{"pipelineruns/pr-1"},
+			expectedPropagated: true,
+		},
+		{
+			name:               "no children",
+			expectedDeletes:    []string{"pipelineruns/pr-1"},
+			expectedPropagated: true,
+		},
+		{
+			name:       "child on legal hold orphaned",
+			childNames: []string{"tr-1", "tr-2"},
+			children: func(pr *pipelinev1.PipelineRun) []*pipelinev1.TaskRun {
+				return []*pipelinev1.TaskRun{
+					newChildTaskRun(pr, "tr-1", map[string]string{helper.AnnotationLegalHold: "true"}),
+					newChildTaskRun(pr, "tr-2", nil),
+				}
+			},
+			expectedDeletes: []string{"taskruns/tr-2", "pipelineruns/pr-1"},
+		},
+		{
+			name:       "failed child deletion keeps the PipelineRun",
+			childNames: []string{"tr-1"},
+			children: func(pr *pipelinev1.PipelineRun) []*pipelinev1.TaskRun {
+				return []*pipelinev1.TaskRun{newChildTaskRun(pr, "tr-1", nil)}
+			},
+			childDeleteFails: true,
+			expectedError:    true,
+			expectedDeletes:  []string{"taskruns/tr-1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loadTestGlobalConfig(t, "pipelineRunChildHandling: cascade")
+			pr := newPipelineRun("pr-1", "uid-1", "1")
+			for _, childName := range test.childNames {
+				pr.Status.ChildReferences = append(pr.Status.ChildReferences, pipelinev1.ChildStatusReference{
+					TypeMeta: runtime.TypeMeta{Kind: helper.KindTaskRun},
+					Name:     childName,
+				})
+			}
+			objects := []runtime.Object{pr}
+			if test.children != nil {
+				for _, tr := range test.children(pr) {
+					objects = append(objects, tr)
+				}
+			}
+			client := fake.NewSimpleClientset(objects...)
+			deletes := []string{}
+			var parentDeleteOptions metav1.DeleteOptions
+			client.PrependReactor("delete", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				deleteAction := action.(k8stesting.DeleteActionImpl)
+				deletes = append(deletes, deleteAction.GetResource().Resource+"/"+deleteAction.GetName())
+				if deleteAction.GetResource().Resource == "pipelineruns" {
+					parentDeleteOptions = deleteAction.DeleteOptions
+				}
+				if test.childDeleteFails && deleteAction.GetResource().Resource == "taskruns" {
+					return true, nil, fmt.Errorf("child deletion failed")
+				}
+				return false, nil, nil
+			})
+			prf := &PipelineRunFuncs{client: client}
+
+			err := prf.Delete(context.Background(), pr.Namespace, pr.Name)
+			if (err != nil) != test.expectedError {
+				t.Fatalf("expected error %v, got: %v", test.expectedError, err)
+			}
+			if !slices.Equal(deletes, test.expectedDeletes) {
+				t.Fatalf("expected the deletes %v, got %v", test.expectedDeletes, deletes)
+			}
+			if test.expectedError {
+				return
+			}
+			// the children are orphaned, only when a child is retained
+			orphaned := parentDeleteOptions.PropagationPolicy != nil && *parentDeleteOptions.PropagationPolicy == metav1.DeletePropagationOrphan
+			if orphaned == test.expectedPropagated {
+				t.Errorf("expected the children propagated %v, got the delete options %+v", test.expectedPropagated, parentDeleteOptions)
+			}
+		})
+	}
+}
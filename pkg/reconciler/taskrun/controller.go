@@ -3,16 +3,25 @@ package taskrun
 import (
 	"context"
 	"os"
+	"time"
 
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/helper"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
 	pipelineclient "github.com/tektoncd/pipeline/pkg/client/injection/client"
+	pipelineruninformer "github.com/tektoncd/pipeline/pkg/client/injection/informers/pipeline/v1/pipelinerun"
+	taskinformer "github.com/tektoncd/pipeline/pkg/client/injection/informers/pipeline/v1/task"
 	taskruninformer "github.com/tektoncd/pipeline/pkg/client/injection/informers/pipeline/v1/taskrun"
 	taskrunreconciler "github.com/tektoncd/pipeline/pkg/client/injection/reconciler/pipeline/v1/taskrun"
+	pipelinelisters "github.com/tektoncd/pipeline/pkg/client/listers/pipeline/v1"
 	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/utils/clock"
 	kubeclient "knative.dev/pkg/client/injection/kube/client"
+	namespaceinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/namespace"
 	"knative.dev/pkg/configmap"
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/kmeta"
@@ -25,27 +34,44 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 	// the injection framework automatically. They'll keep a cached representation of the
 	// cluster's state of the respective resource at all times.
 	taskRunInformer := taskruninformer.Get(ctx)
+	pipelineRunInformer := pipelineruninformer.Get(ctx)
+	taskInformer := taskinformer.Get(ctx)
 
 	logger := logging.FromContext(ctx)
 
+	// the history limiter can list the resources from the api server cache
+	listResourceVersion, err := helper.GetHistoryLimitListResourceVersion()
+	if err != nil {
+		logger.Fatalw("error on getting history limit list resource version",
+			"environmentKey", helper.EnvHistoryLimitListFromCache, "environmentValue", os.Getenv(helper.EnvHistoryLimitListFromCache),
+			zap.Error(err),
+		)
+	}
+
 	taskRunFuncs := &TaskRunFuncs{
-		client: pipelineclient.Get(ctx),
+		client:              pipelineclient.Get(ctx),
+		listResourceVersion: listResourceVersion,
+		taskLister:          taskInformer.Lister(),
+		taskRunLister:       taskRunInformer.Lister(),
 	}
 	ttlHandler, err := helper.NewTTLHandler(clock.RealClock{}, taskRunFuncs)
 	if err != nil {
 		logger.Fatal("error on getting ttl handler", zap.Error(err))
 	}
 
-	historyLimiter, err := helper.NewHistoryLimiter(taskRunFuncs)
+	historyLimiter, err := helper.NewHistoryLimiter(clock.RealClock{}, taskRunFuncs)
 	if err != nil {
 		logger.Fatal("error on getting history limiter", zap.Error(err))
 	}
 
 	r := &Reconciler{
 		// The client will be needed to create/delete Pods via the API.
-		kubeclient:     kubeclient.Get(ctx),
-		ttlHandler:     ttlHandler,
-		historyLimiter: historyLimiter,
+		kubeclient:        kubeclient.Get(ctx),
+		ttlHandler:        ttlHandler,
+		historyLimiter:    historyLimiter,
+		namespaceLister:   namespaceinformer.Get(ctx).Lister(),
+		taskRunFuncs:      taskRunFuncs,
+		pipelineRunLister: pipelineRunInformer.Lister(),
 	}
 
 	// number of works to process the events
@@ -64,13 +90,69 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 	impl := taskrunreconciler.NewImpl(ctx, r, func(impl *controller.Impl) controller.Options { return ctrlOptions })
 
 	// Listen for events on the main resource and enqueue themselves.
-	taskRunInformer.Informer().AddEventHandler(controller.HandleAll(filterTaskRun(logger, impl)))
+	// events of the TaskRuns which are not yet completed are dropped here,
+	// there is nothing to prune until a TaskRun reaches the completion state
+	taskRunInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: filterCompletedTaskRun(ctx, taskRunFuncs, func(obj interface{}, after time.Duration) {
+			if tr, ok := obj.(metav1.Object); ok && (isStandaloneTaskRun(tr) || isOrphanedTaskRun(tr, r.pipelineRunLister)) {
+				impl.EnqueueAfter(obj, after)
+			}
+		}),
+		Handler: controller.HandleAll(filterTaskRun(logger, impl, r.pipelineRunLister)),
+	})
+
+	// the TaskRuns of a deleted Task are evaluated again, can be pruned earlier
+	taskInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: enqueueTaskRunsOfDeletedTask(taskRunInformer.Lister(), filterTaskRun(logger, impl, r.pipelineRunLister)),
+	})
 
+	// reports the standalone TaskRuns never reached the completion state
+	// a TaskRun of a PipelineRun is reported with its PipelineRun
+	stuckRunDetector := helper.NewStuckRunDetector(taskRunFuncs, r.namespaceLister, helper.IsLeaderForFunc(impl), func() ([]metav1.Object, error) {
+		trs, err := taskRunInformer.Lister().List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		resources := []metav1.Object{}
+		for _, tr := range trs {
+			if isStandaloneTaskRun(tr) || isOrphanedTaskRun(tr, r.pipelineRunLister) {
+				resources = append(resources, tr)
+			}
+		}
+		return resources, nil
+	})
+	go stuckRunDetector.Run(ctx, helper.DefaultStuckRunDetectionInterval)
+
+	// the deleted TaskRuns are not tracked anymore
+	taskRunInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: helper.ForgetOnDelete(helper.KindTaskRun),
+	})
 	return impl
 }
 
+// filters the taskrun which is in completed state
+// a TaskRun never completed gets no events once idle, enqueued at the time it exceeds the max keep duration
+func filterCompletedTaskRun(ctx context.Context, taskRunFuncs *TaskRunFuncs, enqueueAfter func(obj interface{}, after time.Duration)) func(obj interface{}) bool {
+	return func(obj interface{}) bool {
+		tr, ok := obj.(*pipelinev1.TaskRun)
+		if !ok {
+			return false
+		}
+		// a TaskRun never completed is enqueued, once it exceeds the max keep duration
+		if !taskRunFuncs.IsCompleted(tr) && !helper.ExceedsMaxKeepDuration(tr) {
+			if left, found := helper.MaxKeepDurationLeft(tr); found {
+				enqueueAfter(tr, left)
+			}
+			return false
+		}
+		// used to measure the time since the completion and the time till the reconciler acts on it
+		helper.QueueLatencyTracker.MarkEligible(ctx, helper.KindTaskRun, tr, taskRunFuncs.GetCompletionTime)
+		return true
+	}
+}
+
 // filters the taskrun which has a parent
-func filterTaskRun(logger *zap.SugaredLogger, impl *controller.Impl) func(obj interface{}) {
+func filterTaskRun(logger *zap.SugaredLogger, impl *controller.Impl, pipelineRunLister pipelinelisters.PipelineRunLister) func(obj interface{}) {
 	return func(obj interface{}) {
 		taskRun, err := kmeta.DeletionHandlingAccessor(obj)
 		if err != nil {
@@ -78,7 +160,7 @@ func filterTaskRun(logger *zap.SugaredLogger, impl *controller.Impl) func(obj in
 			return
 		}
 
-		if !isStandaloneTaskRun(taskRun) {
+		if !isStandaloneTaskRun(taskRun) && !isOrphanedTaskRun(taskRun, pipelineRunLister) {
 			return
 		}
 
@@ -95,13 +177,84 @@ func isStandaloneTaskRun(taskRun metav1.Object) bool {
 
 	// if the resource has owner reference as PipelineRun, it is not a standalone TaskRun
 	// if so, ignore this taskRun
-	if len(taskRun.GetOwnerReferences()) > 0 {
-		for _, ownerReference := range taskRun.GetOwnerReferences() {
-			if ownerReference.Kind == helper.KindPipelineRun {
-				return false
+	return !hasPipelineRunOwnerReference(taskRun)
+}
+
+// returns true if the TaskRun was part of a PipelineRun and the PipelineRun no longer exists
+// owner references are dropped on orphan deletion of the PipelineRun, the label stays on the TaskRun
+// to reduce the false positives, both the signals are considered,
+// the owner reference should be absent and the PipelineRun referred on the label should not be available
+// a TaskRun still having the owner reference is orphaned only when enabled, as the owner may be waiting for the garbage collection
+func isOrphanedTaskRun(taskRun metav1.Object, pipelineRunLister pipelinelisters.PipelineRunLister) bool {
+	if hasPipelineRunOwnerReference(taskRun) {
+		return helper.PrunerConfigStore.IsPruneOrphanedTaskRunsEnabled() && isPipelineRunOwnerGone(taskRun, pipelineRunLister)
+	}
+
+	pipelineRunName := ""
+	if taskRun.GetLabels() != nil {
+		pipelineRunName = taskRun.GetLabels()[helper.LabelPipelineRunName]
+	}
+	if pipelineRunName == "" {
+		return false
+	}
+
+	_, err := pipelineRunLister.PipelineRuns(taskRun.GetNamespace()).Get(pipelineRunName)
+	return errors.IsNotFound(err)
+}
+
+// returns true if none of the PipelineRun owners of the TaskRun exist
+// the owners are looked up on the informer cache, a PipelineRun recreated with the same name is not the owner
+func isPipelineRunOwnerGone(taskRun metav1.Object, pipelineRunLister pipelinelisters.PipelineRunLister) bool {
+	for _, ownerReference := range taskRun.GetOwnerReferences() {
+		if ownerReference.Kind != helper.KindPipelineRun {
+			continue
+		}
+		pipelineRun, err := pipelineRunLister.PipelineRuns(taskRun.GetNamespace()).Get(ownerReference.Name)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
 			}
+			return false
+		}
+		if pipelineRun.UID == ownerReference.UID {
+			return false
 		}
 	}
-
 	return true
 }
+
+// returns true if the TaskRun has a PipelineRun on the owner references
+func hasPipelineRunOwnerReference(taskRun metav1.Object) bool {
+	for _, ownerReference := range taskRun.GetOwnerReferences() {
+		if ownerReference.Kind == helper.KindPipelineRun {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueues the completed TaskRuns referencing a deleted Task
+func enqueueTaskRunsOfDeletedTask(lister pipelinelisters.TaskRunLister, enqueue func(obj interface{})) func(obj interface{}) {
+	return func(obj interface{}) {
+		if helper.PrunerConfigStore.GetDeletedDefinitionTTL() == nil {
+			return
+		}
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		task, ok := obj.(*pipelinev1.Task)
+		if !ok {
+			return
+		}
+		selector := labels.SelectorFromSet(labels.Set{helper.LabelTaskName: task.Name})
+		trs, err := lister.TaskRuns(task.Namespace).List(selector)
+		if err != nil {
+			return
+		}
+		for _, tr := range trs {
+			if tr.Spec.TaskRef != nil && tr.Spec.TaskRef.Name == task.Name {
+				enqueue(tr)
+			}
+		}
+	}
+}
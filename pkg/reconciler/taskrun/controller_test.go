@@ -0,0 +1,161 @@
+package taskrun
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/helper"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	pipelinelisters "github.com/tektoncd/pipeline/pkg/client/listers/pipeline/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/apis"
+)
+
+func loadTestGlobalConfig(t *testing.T, config string) {
+	t.Helper()
+	err := helper.PrunerConfigStore.LoadGlobalConfig(&corev1.ConfigMap{Data: map[string]string{helper.PrunerGlobalConfigKey: config}})
+	if err != nil {
+		t.Fatalf("error on loading the global config: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = helper.PrunerConfigStore.LoadGlobalConfig(&corev1.ConfigMap{})
+	})
+}
+
+// returns a PipelineRun lister backed by an indexer holding the PipelineRuns
+func newTestPipelineRunLister(t *testing.T, prs ...*pipelinev1.PipelineRun) pipelinelisters.PipelineRunLister {
+	t.Helper()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, pr := range prs {
+		if err := indexer.Add(pr); err != nil {
+			t.Fatalf("error on adding the PipelineRun: %v", err)
+		}
+	}
+	return pipelinelisters.NewPipelineRunLister(indexer)
+}
+
+func newTaskRun(pipelineRunLabel string, owner *metav1.OwnerReference) *pipelinev1.TaskRun {
+	tr := &pipelinev1.TaskRun{ObjectMeta: metav1.ObjectMeta{Namespace: "ns-1", Name: "tr-1"}}
+	if pipelineRunLabel != "" {
+		tr.Labels = map[string]string{helper.LabelPipelineRunName: pipelineRunLabel}
+	}
+	if owner != nil {
+		tr.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+	return tr
+}
+
+func TestStandaloneAndOrphanedTaskRun(t *testing.T) {
+	existing := &pipelinev1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Namespace: "ns-1", Name: "pr-1", UID: types.UID("uid-1")}}
+	ownerOf := func(name string, uid types.UID) *metav1.OwnerReference {
+		return &metav1.OwnerReference{Kind: helper.KindPipelineRun, Name: name, UID: uid}
+	}
+
+	tests := []struct {
+		name           string
+		config         string
+		taskRun        *pipelinev1.TaskRun
+		wantStandalone bool
+		wantOrphaned   bool
+	}{
+		{
+			name:           "no label and no owner reference",
+			taskRun:        newTaskRun("", nil),
+			wantStandalone: true,
+		},
+		{
+			name:    "label without owner reference, PipelineRun exists",
+			taskRun: newTaskRun("pr-1", nil),
+		},
+		{
+			name:         "label without owner reference, PipelineRun gone",
+			taskRun:      newTaskRun("pr-gone", nil),
+			wantOrphaned: true,
+		},
+		{
+			name:    "owner reference without label, owner exists",
+			taskRun: newTaskRun("", ownerOf("pr-1", "uid-1")),
+		},
+		{
+			name:    "owner PipelineRun gone, orphan pruning disabled",
+			taskRun: newTaskRun("pr-gone", ownerOf("pr-gone", "uid-gone")),
+		},
+		{
+			name:         "owner PipelineRun gone, orphan pruning enabled",
+			config:       "pruneOrphanedTaskRuns: true",
+			taskRun:      newTaskRun("pr-gone", ownerOf("pr-gone", "uid-gone")),
+			wantOrphaned: true,
+		},
+		{
+			name:         "owner PipelineRun recreated with the same name, orphan pruning enabled",
+			config:       "pruneOrphanedTaskRuns: true",
+			taskRun:      newTaskRun("pr-1", ownerOf("pr-1", "uid-old")),
+			wantOrphaned: true,
+		},
+		{
+			name:    "owner PipelineRun exists, orphan pruning enabled",
+			config:  "pruneOrphanedTaskRuns: true",
+			taskRun: newTaskRun("pr-1", ownerOf("pr-1", "uid-1")),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loadTestGlobalConfig(t, test.config)
+			lister := newTestPipelineRunLister(t, existing)
+
+			if got := isStandaloneTaskRun(test.taskRun); got != test.wantStandalone {
+				t.Errorf("expected standalone %v, got %v", test.wantStandalone, got)
+			}
+			if got := isOrphanedTaskRun(test.taskRun, lister); got != test.wantOrphaned {
+				t.Errorf("expected orphaned %v, got %v", test.wantOrphaned, got)
+			}
+		})
+	}
+}
+
+// returns a started TaskRun, the succeeded condition is unknown while it is running
+func newRunningTaskRun(name string) *pipelinev1.TaskRun {
+	tr := &pipelinev1.TaskRun{ObjectMeta: metav1.ObjectMeta{Namespace: "ns-1", Name: name}}
+	tr.Status.StartTime = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+	tr.Status.SetCondition(&apis.Condition{Type: apis.ConditionSucceeded, Status: corev1.ConditionUnknown})
+	return tr
+}
+
+func TestFilterTaskRunNotCompletedFastPath(t *testing.T) {
+	loadTestGlobalConfig(t, ``)
+
+	running := newRunningTaskRun("tr-running")
+	completed := newRunningTaskRun("tr-completed")
+	completed.Status.SetCondition(&apis.Condition{Type: apis.ConditionSucceeded, Status: corev1.ConditionTrue})
+	completed.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+
+	filter := filterCompletedTaskRun(context.Background(), &TaskRunFuncs{}, func(obj interface{}, after time.Duration) {
+		t.Fatalf("unexpected enqueue after %v", after)
+	})
+
+	// the status updates of a running TaskRun never reach the reconciler
+	for i := 0; i < 10; i++ {
+		if filter(running) {
+			t.Fatalf("expected the running TaskRun to be dropped by the filter")
+		}
+	}
+	if !filter(completed) {
+		t.Errorf("expected the completed TaskRun to pass the filter")
+	}
+	helper.QueueLatencyTracker.Forget(helper.KindTaskRun, completed)
+}
+
+func TestReconcileTaskRunNotCompletedFastPath(t *testing.T) {
+	loadTestGlobalConfig(t, ``)
+
+	// the ttl handler, the history limiter and the clients are not set, the fast path must not reach them
+	r := &Reconciler{taskRunFuncs: &TaskRunFuncs{}, pipelineRunLister: newTestPipelineRunLister(t)}
+	if err := r.ReconcileKind(context.Background(), newRunningTaskRun("tr-running")); err != nil {
+		t.Errorf("expected no error on the running TaskRun, got %v", err)
+	}
+}
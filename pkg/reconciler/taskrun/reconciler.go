@@ -4,17 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"go.uber.org/zap"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
 
 	tektonprunerv1alpha1 "github.com/openshift-pipelines/tektoncd-pruner/pkg/apis/tektonpruner/v1alpha1"
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/helper"
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
 	pipelineversioned "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
 	taskrunreconciler "github.com/tektoncd/pipeline/pkg/client/injection/reconciler/pipeline/v1/taskrun"
+	pipelinelisters "github.com/tektoncd/pipeline/pkg/client/listers/pipeline/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"knative.dev/pkg/apis"
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
@@ -27,6 +33,11 @@ type Reconciler struct {
 	kubeclient     kubernetes.Interface
 	ttlHandler     *helper.TTLHandler
 	historyLimiter *helper.HistoryLimiter
+	taskRunFuncs   *TaskRunFuncs
+	// used to find the orphaned TaskRuns
+	pipelineRunLister pipelinelisters.PipelineRunLister
+	// used to check the namespace annotations
+	namespaceLister corelisters.NamespaceLister
 }
 
 // Check that our Reconciler implements Interface
@@ -39,26 +50,74 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, tr *pipelinev1.TaskRun)
 		"namespace", tr.Namespace, "name", tr.Name,
 	)
 
+	// time taken to act on a TaskRun, since its completion observed
+	helper.QueueLatencyTracker.Observe(ctx, helper.KindTaskRun, tr)
+
 	// if the TaskRun is not a standalone, no action needed
 	// if so, will be handled by it is parent resource(PipelineRun)
-	if !isStandaloneTaskRun(tr) {
+	// an orphaned TaskRun has no parent to be handled with, treat it as a standalone TaskRun
+	if !isStandaloneTaskRun(tr) && !isOrphanedTaskRun(tr, r.pipelineRunLister) {
 		return nil
 	}
 
+	// a TaskRun which is not completed can not be pruned, unless it exceeds the max keep duration,
+	// no need to go through the ttl handler and the history limiter
+	if !r.taskRunFuncs.IsCompleted(tr) && !helper.ExceedsMaxKeepDuration(tr) {
+		// evaluated again, once it exceeds the max keep duration
+		if left, found := helper.MaxKeepDurationLeft(tr); found {
+			return controller.NewRequeueAfter(left)
+		}
+		return nil
+	}
+
+	// the pruning is paused, the completed TaskRun is evaluated again after the interval, resumed once unpaused
+	if helper.PrunerConfigStore.IsPaused() {
+		logger.Debugw("pruning is paused, skipping the TaskRun",
+			"namespace", tr.Namespace, "name", tr.Name,
+		)
+		return controller.NewRequeueAfter(helper.DefaultPausedRequeueInterval)
+	}
+
+	var err error
+	// the failed reconciles are used to compute the error ratio
+	defer func() {
+		isRequeueKey, _ := controller.IsRequeueKey(err)
+		metrics.RecordReconcileResult(ctx, helper.KindTaskRun, err != nil && !isRequeueKey)
+		if err != nil && !isRequeueKey {
+			metrics.RecordReconcileError(ctx, helper.KindTaskRun, err)
+		} else {
+			metrics.RecordLastReconcile(ctx, tr.Namespace, time.Now())
+		}
+	}()
+
+	// the namespace selector is evaluated on the cached namespace, evaluated again once the namespace is in the cache
+	if err = helper.NamespaceNotCachedRequeue(r.namespaceLister, tr.Namespace); err != nil {
+		return err
+	}
+
 	// execute the history limiter earlier than the ttl handler
 
 	// execute history limit action
-	err := r.historyLimiter.ProcessEvent(ctx, tr)
+	// the namespace owner can disable the policies with the namespace annotation
+	if !helper.IsPolicyDisabledOnNamespace(ctx, r.namespaceLister, tr.Namespace, helper.PrunerPolicyHistoryLimit) {
+		err = r.historyLimiter.ProcessEvent(ctx, tr)
+	}
 	if err != nil {
-		logger.Errorw("error on processing history limiting for a TaskRun",
-			"namespace", tr.Namespace, "name", tr.Name,
-			zap.Error(err),
-		)
+		isRequeueKey, _ := controller.IsRequeueKey(err)
+		// the error is not a requeue error, print the error
+		if !isRequeueKey {
+			logger.Errorw("error on processing history limiting for a TaskRun",
+				"namespace", tr.Namespace, "name", tr.Name,
+				zap.Error(err),
+			)
+		}
 		return err
 	}
 
 	// execute ttl handler
-	err = r.ttlHandler.ProcessEvent(ctx, tr)
+	if !helper.IsPolicyDisabledOnNamespace(ctx, r.namespaceLister, tr.Namespace, helper.PrunerPolicyTTL) {
+		err = r.ttlHandler.ProcessEvent(ctx, tr)
+	}
 	if err != nil {
 		isRequeueKey, _ := controller.IsRequeueKey(err)
 		// the error is not a requeue error, print the error
@@ -78,28 +137,51 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, tr *pipelinev1.TaskRun)
 
 type TaskRunFuncs struct {
 	client pipelineversioned.Interface
+	// resource version of the list calls, "0" allows the api server cached reads
+	listResourceVersion string
+	// used to check the existence of the referenced Tasks
+	taskLister pipelinelisters.TaskLister
+	// used to count the TaskRuns of a namespace, without an api call
+	taskRunLister pipelinelisters.TaskRunLister
 }
 
 func (trf *TaskRunFuncs) Type() string {
 	return helper.KindTaskRun
 }
 
-func (trf *TaskRunFuncs) List(ctx context.Context, namespace, labelSelector string) ([]metav1.Object, error) {
-	// TODO: should we have to implement pagination support?
-	prsList, err := trf.client.TektonV1().TaskRuns(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+func (trf *TaskRunFuncs) List(ctx context.Context, namespace, labelSelector string) ([]metav1.Object, string, error) {
+	options := metav1.ListOptions{LabelSelector: labelSelector, ResourceVersion: trf.listResourceVersion}
+	return helper.ListAll(ctx, options, func(ctx context.Context, options metav1.ListOptions) ([]metav1.Object, metav1.ListMeta, error) {
+		trsList, err := trf.client.TektonV1().TaskRuns(namespace).List(ctx, options)
+		if err != nil {
+			return nil, metav1.ListMeta{}, err
+		}
+		trs := make([]metav1.Object, 0, len(trsList.Items))
+		for index := range trsList.Items {
+			trs = append(trs, &trsList.Items[index])
+		}
+		return trs, trsList.ListMeta, nil
+	})
+}
+
+// resource k8s operations
+
+func (trf *TaskRunFuncs) ListFromCache(namespace, label string) ([]metav1.Object, error) {
+	selector, err := labels.Parse(label)
 	if err != nil {
 		return nil, err
 	}
-
-	trs := []metav1.Object{}
-	for _, tr := range prsList.Items {
-		trs = append(trs, tr.DeepCopy())
+	trs, err := trf.taskRunLister.TaskRuns(namespace).List(selector)
+	if err != nil {
+		return nil, err
 	}
-	return trs, nil
+	resources := make([]metav1.Object, 0, len(trs))
+	for _, tr := range trs {
+		resources = append(resources, tr)
+	}
+	return resources, nil
 }
 
-// resource k8s operations
-
 func (trf *TaskRunFuncs) Get(ctx context.Context, namespace, name string) (metav1.Object, error) {
 	return trf.client.TektonV1().TaskRuns(namespace).Get(ctx, name, metav1.GetOptions{})
 }
@@ -108,6 +190,20 @@ func (trf *TaskRunFuncs) Delete(ctx context.Context, namespace, name string) err
 	return trf.client.TektonV1().TaskRuns(namespace).Delete(ctx, name, metav1.DeleteOptions{})
 }
 
+func (trf *TaskRunFuncs) DeleteUnchanged(ctx context.Context, resource metav1.Object) error {
+	deleteOptions := metav1.DeleteOptions{Preconditions: helper.UnchangedPreconditions(resource)}
+	return trf.client.TektonV1().TaskRuns(resource.GetNamespace()).Delete(ctx, resource.GetName(), deleteOptions)
+}
+
+func (trf *TaskRunFuncs) DeleteCollection(ctx context.Context, namespace, labelSelector, resourceVersion string) error {
+	listOptions := metav1.ListOptions{
+		LabelSelector:        labelSelector,
+		ResourceVersion:      resourceVersion,
+		ResourceVersionMatch: metav1.ResourceVersionMatchExact,
+	}
+	return trf.client.TektonV1().TaskRuns(namespace).DeleteCollection(ctx, metav1.DeleteOptions{}, listOptions)
+}
+
 func (trf *TaskRunFuncs) Update(ctx context.Context, resource metav1.Object) error {
 	tr, ok := resource.(*pipelinev1.TaskRun)
 	if !ok {
@@ -123,22 +219,36 @@ func (trf *TaskRunFuncs) GetCompletionTime(resource metav1.Object) (metav1.Time,
 		return metav1.Time{}, fmt.Errorf("resource type error, this is not a TaskRun resource. namespace:%s, name:%s, type:%T",
 			resource.GetNamespace(), resource.GetName(), resource)
 	}
-	if tr.Status.CompletionTime != nil {
-		return *tr.Status.CompletionTime, nil
-	}
+	return helper.GetCompletionTime(trf.Type(), tr, tr.Status.CompletionTime, tr.Status.GetCondition(apis.ConditionSucceeded))
+}
 
-	// check the status from conditions
-	condition := tr.Status.GetCondition(apis.ConditionSucceeded)
-	if condition != nil && condition.Status != corev1.ConditionUnknown {
-		finishAt := condition.LastTransitionTime
-		if finishAt.Inner.IsZero() {
-			return metav1.Time{}, fmt.Errorf("unable to find the time when the resource '%s/%s' finished", tr.Namespace, tr.Name)
-		}
-		return condition.LastTransitionTime.Inner, nil
+func (trf *TaskRunFuncs) GetStartTime(resource metav1.Object) (metav1.Time, error) {
+	tr, ok := resource.(*pipelinev1.TaskRun)
+	if !ok {
+		return metav1.Time{}, fmt.Errorf("resource type error, this is not a TaskRun resource. namespace:%s, name:%s, type:%T",
+			resource.GetNamespace(), resource.GetName(), resource)
+	}
+	if tr.Status.StartTime == nil {
+		return metav1.Time{}, fmt.Errorf("unable to find the start time of the resource: %s/%s", resource.GetNamespace(), resource.GetName())
 	}
+	return *tr.Status.StartTime, nil
+}
 
-	// This should never happen if the Resource has finished
-	return metav1.Time{}, fmt.Errorf("unable to find the status of the finished resource: %s/%s", tr.Namespace, tr.Name)
+// IsDefinitionDeleted returns true, if the Task referenced by name is not found in the namespace
+// the embedded, the remote (resolver) and the cluster scoped Tasks are never reported as deleted
+func (trf *TaskRunFuncs) IsDefinitionDeleted(resource metav1.Object) bool {
+	tr, ok := resource.(*pipelinev1.TaskRun)
+	if !ok || trf.taskLister == nil {
+		return false
+	}
+	if tr.Spec.TaskRef == nil || tr.Spec.TaskRef.Name == "" || tr.Spec.TaskRef.Resolver != "" {
+		return false
+	}
+	if tr.Spec.TaskRef.Kind != "" && tr.Spec.TaskRef.Kind != pipelinev1.NamespacedTaskKind {
+		return false
+	}
+	_, err := trf.taskLister.Tasks(tr.Namespace).Get(tr.Spec.TaskRef.Name)
+	return errors.IsNotFound(err)
 }
 
 func (trf *TaskRunFuncs) Ignore(resource metav1.Object) bool {
@@ -181,7 +291,7 @@ func (trf *TaskRunFuncs) IsSuccessful(resource metav1.Object) bool {
 	}
 
 	condition := tr.Status.GetCondition(apis.ConditionSucceeded)
-	if condition == nil {
+	if condition == nil || condition.Status != corev1.ConditionTrue {
 		return false
 	}
 
@@ -189,15 +299,70 @@ func (trf *TaskRunFuncs) IsSuccessful(resource metav1.Object) bool {
 	return runReason == pipelinev1.TaskRunReasonSuccessful
 }
 
+// IsFailed returns true for all the finished TaskRuns not succeeded,
+// includes the failed, timed out and cancelled TaskRuns
 func (trf *TaskRunFuncs) IsFailed(resource metav1.Object) bool {
-	_, ok := resource.(*pipelinev1.TaskRun)
+	tr, ok := resource.(*pipelinev1.TaskRun)
 	if !ok {
 		return false
 	}
 
+	condition := tr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil {
+		// no condition on a completed TaskRun, treated as failed
+		return tr.Status.CompletionTime != nil
+	}
+	if condition.Status == corev1.ConditionUnknown {
+		return false
+	}
+
 	return !trf.IsSuccessful(resource)
 }
 
+// IsCancelled returns true, when the TaskRun is finished by a cancellation
+func (trf *TaskRunFuncs) IsCancelled(resource metav1.Object) bool {
+	tr, ok := resource.(*pipelinev1.TaskRun)
+	if !ok {
+		return false
+	}
+
+	condition := tr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil || condition.Status != corev1.ConditionFalse {
+		return false
+	}
+
+	return pipelinev1.TaskRunReason(condition.Reason) == pipelinev1.TaskRunReasonCancelled
+}
+
+// IsTimedOut returns true, when the TaskRun is finished by a timeout
+func (trf *TaskRunFuncs) IsTimedOut(resource metav1.Object) bool {
+	tr, ok := resource.(*pipelinev1.TaskRun)
+	if !ok {
+		return false
+	}
+
+	condition := tr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil || condition.Status != corev1.ConditionFalse {
+		return false
+	}
+
+	return pipelinev1.TaskRunReason(condition.Reason) == pipelinev1.TaskRunReasonTimedOut
+}
+
+// GetReason returns the reason of the Succeeded condition, empty if not available
+func (trf *TaskRunFuncs) GetReason(resource metav1.Object) string {
+	tr, ok := resource.(*pipelinev1.TaskRun)
+	if !ok {
+		return ""
+	}
+
+	condition := tr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil {
+		return ""
+	}
+	return condition.Reason
+}
+
 func (trf *TaskRunFuncs) GetDefaultLabelKey() string {
 	return helper.LabelTaskName
 }
@@ -206,6 +371,14 @@ func (trf *TaskRunFuncs) GetTTLSecondsAfterFinished(namespace, taskName string)
 	return helper.PrunerConfigStore.GetTaskTTLSecondsAfterFinished(namespace, taskName)
 }
 
+func (trf *TaskRunFuncs) GetCancelledTTLSecondsAfterFinished(namespace, name string) *int32 {
+	return helper.PrunerConfigStore.GetTaskCancelledTTLSecondsAfterFinished(namespace, name)
+}
+
+func (trf *TaskRunFuncs) GetTTLFrom(namespace, name string) tektonprunerv1alpha1.TTLFrom {
+	return helper.PrunerConfigStore.GetTaskTTLFrom(namespace, name)
+}
+
 func (trf *TaskRunFuncs) GetSuccessHistoryLimitCount(namespace, name string) *int32 {
 	return helper.PrunerConfigStore.GetTaskSuccessHistoryLimitCount(namespace, name)
 }
@@ -214,6 +387,14 @@ func (trf *TaskRunFuncs) GetFailedHistoryLimitCount(namespace, name string) *int
 	return helper.PrunerConfigStore.GetTaskFailedHistoryLimitCount(namespace, name)
 }
 
+func (trf *TaskRunFuncs) GetCancelledHistoryLimitCount(namespace, name string) *int32 {
+	return helper.PrunerConfigStore.GetTaskCancelledHistoryLimitCount(namespace, name)
+}
+
+func (trf *TaskRunFuncs) GetGroupByLabelKeys(namespace, name string) []string {
+	return helper.PrunerConfigStore.GetTaskGroupBy(namespace, name)
+}
+
 func (trf *TaskRunFuncs) GetEnforcedConfigLevel(namespace, name string) tektonprunerv1alpha1.EnforcedConfigLevel {
 	return helper.PrunerConfigStore.GetTaskEnforcedConfigLevel(namespace, name)
 }
@@ -2,6 +2,11 @@ package tektonpruner
 
 import (
 	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 	"knative.dev/pkg/configmap"
@@ -10,10 +15,12 @@ import (
 
 	tektonprunerinformer "github.com/openshift-pipelines/tektoncd-pruner/pkg/client/injection/informers/tektonpruner/v1alpha1/tektonpruner"
 	tektonprunerreconciler "github.com/openshift-pipelines/tektoncd-pruner/pkg/client/injection/reconciler/tektonpruner/v1alpha1/tektonpruner"
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/helper"
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/version"
 	corev1 "k8s.io/api/core/v1"
 	kubeclient "knative.dev/pkg/client/injection/kube/client"
+	namespaceinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/namespace"
 )
 
 // NewController creates a Reconciler and returns the result of NewImpl.
@@ -30,6 +37,7 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 		"version", ver.Version, "arch", ver.Arch, "platform", ver.Platform,
 		"goVersion", ver.GoLang, "buildDate", ver.BuildDate, "gitCommit", ver.GitCommit,
 	)
+	metrics.RecordBuildInfo(ctx, ver.Version, ver.GitCommit)
 
 	r := &Reconciler{
 		// The client will be needed to create/delete Pods via the API.
@@ -41,8 +49,53 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 	// Listen for events on the main resource and enqueue themselves.
 	tektonPrunerInformer.Informer().AddEventHandler(controller.HandleAll(impl.Enqueue))
 
+	// reviews the delete permissions once, after the global config is loaded
+	startupPermissionCheck, err := helper.GetEnvValueAsBool(helper.EnvStartupPermissionCheck, false)
+	if err != nil {
+		logger.Fatalw("error on getting startup permission check",
+			"environmentKey", helper.EnvStartupPermissionCheck, "environmentValue", os.Getenv(helper.EnvStartupPermissionCheck),
+			zap.Error(err),
+		)
+	}
+	configObservers := []configmap.Observer{onConfigChange(ctx)}
+	if startupPermissionCheck {
+		permissionCheckOnce := &sync.Once{}
+		configObservers = append(configObservers, func(*corev1.ConfigMap) {
+			permissionCheckOnce.Do(func() { go helper.CheckDeletePermissions(ctx, r.kubeclient) })
+		})
+	}
+
 	// call
-	cmw.Watch(helper.PrunerConfigMapName, onConfigChange(ctx))
+	cmw.Watch(helper.PrunerConfigMapName, configObservers...)
+
+	// computes the convenience metrics derived from the counters
+	go metrics.RunDerivedMetrics(ctx)
+
+	// reports the pruner is alive, even there is nothing to prune
+	go metrics.RunHeartbeat(ctx)
+
+	// serves the loaded config for debugging, disabled by default
+	if debugServerAddress := os.Getenv(helper.EnvDebugServerAddress); debugServerAddress != "" {
+		go helper.RunDebugServer(ctx, debugServerAddress, namespaceinformer.Get(ctx).Lister())
+	}
+
+	// writes the metrics into a textfile, to be collected by the node_exporter
+	// disabled by default, enabled when the textfile path is supplied
+	textfilePath := os.Getenv(helper.EnvMetricsTextfilePath)
+	if textfilePath != "" {
+		interval, err := helper.GetEnvValueAsInt(helper.EnvMetricsTextfileIntervalSeconds, helper.DefaultMetricsTextfileIntervalSeconds)
+		if err != nil {
+			logger.Fatalw("error on getting metrics textfile interval",
+				"environmentKey", helper.EnvMetricsTextfileIntervalSeconds, "environmentValue", os.Getenv(helper.EnvMetricsTextfileIntervalSeconds),
+				zap.Error(err),
+			)
+		}
+		textfileWriter, err := metrics.NewTextfileWriter(textfilePath, time.Duration(interval)*time.Second, os.Getenv(helper.EnvMetricsTextfilePrefix))
+		if err != nil {
+			logger.Fatal("error on getting metrics textfile writer", zap.Error(err))
+		}
+		go textfileWriter.Run(ctx, logger)
+	}
 
 	return impl
 }
@@ -55,7 +108,70 @@ func onConfigChange(ctx context.Context) configmap.Observer {
 		)
 		err := helper.PrunerConfigStore.LoadGlobalConfig(configMap)
 		if err != nil {
-			logger.Error("error on getting pruner global config", zap.Error(err))
+			// print the offending lines of the config, if known
+			var configErr *helper.ConfigLoadError
+			if errors.As(err, &configErr) && configErr.Snippet != "" {
+				logger.Errorw("error on getting pruner global config",
+					"configMap", configMap.Name, "configKey", configErr.Key, "line", configErr.Line,
+					zap.Error(err),
+				)
+				logger.Errorf("offending lines of the config key '%s':\n%s", configErr.Key, configErr.Snippet)
+			} else {
+				logger.Error("error on getting pruner global config", zap.Error(err))
+			}
 		}
+		reportUnknownFields(ctx, configMap)
+		reportEffectivePolicy(ctx)
+		reportPaused(ctx)
+	}
+}
+
+// last reported state of the kill switch, to log only on a change
+var pruningPaused atomic.Bool
+
+// logs the pause and the resume of the pruning
+func reportPaused(ctx context.Context) {
+	isPaused := helper.PrunerConfigStore.IsPaused()
+	metrics.RecordPaused(ctx, isPaused)
+	if wasPaused := pruningPaused.Swap(isPaused); isPaused == wasPaused {
+		return
+	}
+	logger := logging.FromContext(ctx)
+	if isPaused {
+		logger.Warnw("pruning is paused with the global config, no resource will be pruned till it is resumed",
+			"configMap", helper.PrunerConfigMapName, "configKey", helper.PrunerGlobalConfigKey,
+		)
+	} else {
+		logger.Infow("pruning is resumed",
+			"configMap", helper.PrunerConfigMapName, "configKey", helper.PrunerGlobalConfigKey,
+		)
+	}
+}
+
+// warns on the fields of the global config ignored by the pruner, helps to catch the typos
+func reportUnknownFields(ctx context.Context, configMap *corev1.ConfigMap) {
+	logger := logging.FromContext(ctx)
+	for _, field := range helper.PrunerConfigStore.GetUnknownFields() {
+		logger.Warnw("unknown field on pruner global config, ignored",
+			"configMap", configMap.Name, "configKey", helper.PrunerGlobalConfigKey, "field", field,
+		)
+		metrics.RecordConfigUnknownField(ctx)
+	}
+}
+
+// last reported state of the effective policy, to warn only on a change
+var effectivePolicyMissing atomic.Bool
+
+// warns, if the config has no ttl or history limit at any level
+// a common mistake, the pruner is installed but nothing is pruned
+func reportEffectivePolicy(ctx context.Context) {
+	present := helper.PrunerConfigStore.HasEffectivePolicy()
+	metrics.RecordEffectivePolicyPresent(ctx, present)
+	if wasMissing := effectivePolicyMissing.Swap(!present); !present && !wasMissing {
+		logger := logging.FromContext(ctx)
+		logger.Warnw("pruner config has no ttl or history limit at any level, nothing will be pruned,"+
+			" unless the limits are set with the resource annotations",
+			"configMap", helper.PrunerConfigMapName, "configKey", helper.PrunerGlobalConfigKey,
+		)
 	}
 }
@@ -6,7 +6,11 @@ import (
 	tektonprunerv1alpha1 "github.com/openshift-pipelines/tektoncd-pruner/pkg/apis/tektonpruner/v1alpha1"
 	tektonprunerreconciler "github.com/openshift-pipelines/tektoncd-pruner/pkg/client/injection/reconciler/tektonpruner/v1alpha1/tektonpruner"
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/helper"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/reconciler"
 )
@@ -20,15 +24,21 @@ type Reconciler struct {
 // Check that our Reconciler implements Interface
 var _ tektonprunerreconciler.Interface = (*Reconciler)(nil)
 
-func (r *Reconciler) FinalizeKindOld(ctx context.Context, tknPr *tektonprunerv1alpha1.TektonPruner) reconciler.Event {
+// Check that our Reconciler observes the deletion of the resources
+var _ reconciler.OnDeletionInterface = (*Reconciler)(nil)
+
+// ObserveDeletion implements OnDeletionInterface.ObserveDeletion.
+// called once the resource is removed from the informer cache, no finalizer is needed
+func (r *Reconciler) ObserveDeletion(ctx context.Context, key types.NamespacedName) error {
 	// This logger has all the context necessary to identify which resource is being reconciled.
 	logger := logging.FromContext(ctx)
 	logger.Infow("received a delete event",
-		"namespace", tknPr.Namespace, "name", tknPr.Name, "deletionTimestamp", tknPr.GetDeletionTimestamp(),
+		"namespace", key.Namespace, "name", key.Name,
 	)
 
 	// update spec on the common store
-	helper.PrunerConfigStore.DeleteNamespacedSpec(tknPr.Namespace)
+	helper.PrunerConfigStore.DeleteNamespacedSpec(key.Namespace)
+	reportEffectivePolicy(ctx)
 	return nil
 }
 
@@ -40,11 +50,44 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, tknPr *tektonprunerv1alp
 		"namespace", tknPr.Namespace, "name", tknPr.Name,
 	)
 
+	// the webhook validates the spec, but the resources created before the webhook or with the webhook disabled are not
+	// an invalid spec never overrides the global config, the previously accepted spec of the namespace is dropped
+	if err := tknPr.Validate(ctx); err != nil {
+		logger.Errorw("invalid TektonPruner spec, ignored",
+			"namespace", tknPr.Namespace, "name", tknPr.Name, zap.Error(err),
+		)
+		helper.PrunerConfigStore.DeleteNamespacedSpec(tknPr.Namespace)
+		reportEffectivePolicy(ctx)
+		tknPr.Status.MarkInvalid(tektonprunerv1alpha1.TektonPrunerReasonInvalidSpec, "%s", err.Error())
+		return nil
+	}
+
 	// update spec on the common store
 	helper.PrunerConfigStore.UpdateNamespacedSpec(tknPr)
+	reportEffectivePolicy(ctx)
 
 	// mark reconciliation completed and this config is ready to use
 	tknPr.Status.MarkReady()
 
+	// report the reasons the resources are retained in this namespace
+	tknPr.Status.RetentionBreakdown = helper.RetentionTracker.GetBreakdown(tknPr.Namespace)
+
+	// report the deletions in this namespace since the previous refresh, the previous report is kept, if nothing is deleted
+	lastPrunedTime, prunedCounts, pruned := helper.PruneTracker.Collect(tknPr.Namespace)
+	if pruned {
+		var prunedCount int64
+		for _, count := range prunedCounts {
+			prunedCount += count
+		}
+		tknPr.Status.LastPrunedCount = prunedCount
+		tknPr.Status.LastPrunedTime = &metav1.Time{Time: lastPrunedTime}
+		tknPr.Status.LastPrunedCountByType = prunedCounts
+	}
+
+	// the breakdown and the deletions change as the resources are processed, refresh them periodically
+	// nothing is tracked in an idle namespace, the status is refreshed on the next event of the TektonPruner
+	if len(tknPr.Status.RetentionBreakdown) > 0 || pruned {
+		return controller.NewRequeueAfter(helper.DefaultRetentionBreakdownRefreshInterval)
+	}
 	return nil
 }
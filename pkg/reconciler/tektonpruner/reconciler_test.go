@@ -0,0 +1,173 @@
+package tektonpruner
+
+import (
+	"context"
+	"testing"
+
+	tektonprunerv1alpha1 "github.com/openshift-pipelines/tektoncd-pruner/pkg/apis/tektonpruner/v1alpha1"
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/helper"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/ptr"
+)
+
+// loads an empty global config, the namespaced specs of the namespaces are dropped on the cleanup
+func loadTestGlobalConfig(t *testing.T, namespaces ...string) {
+	t.Helper()
+	if err := helper.PrunerConfigStore.LoadGlobalConfig(&corev1.ConfigMap{}); err != nil {
+		t.Fatalf("error on loading the global config: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, namespace := range namespaces {
+			helper.PrunerConfigStore.DeleteNamespacedSpec(namespace)
+		}
+	})
+}
+
+func newTektonPruner(namespace string, ttl int32) *tektonprunerv1alpha1.TektonPruner {
+	return &tektonprunerv1alpha1.TektonPruner{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "pruner"},
+		Spec:       tektonprunerv1alpha1.TektonPrunerSpec{TTLSecondsAfterFinished: ptr.Int32(ttl)},
+	}
+}
+
+func TestReconcileKind(t *testing.T) {
+	loadTestGlobalConfig(t, "ns-idle", "ns-retained", "ns-invalid")
+
+	tests := []struct {
+		name         string
+		namespace    string
+		ttl          int32
+		retained     bool
+		wantReady    corev1.ConditionStatus
+		wantTTL      *int32
+		wantRequeue  bool
+		wantRetained int64
+	}{
+		{
+			name:      "valid spec of an idle namespace is not requeued",
+			namespace: "ns-idle",
+			ttl:       60,
+			wantReady: corev1.ConditionTrue,
+			wantTTL:   ptr.Int32(60),
+		},
+		{
+			name:         "valid spec with retained resources is requeued to refresh the breakdown",
+			namespace:    "ns-retained",
+			ttl:          60,
+			retained:     true,
+			wantReady:    corev1.ConditionTrue,
+			wantTTL:      ptr.Int32(60),
+			wantRequeue:  true,
+			wantRetained: 1,
+		},
+		{
+			name:      "invalid spec is dropped and not requeued",
+			namespace: "ns-invalid",
+			ttl:       -2,
+			wantReady: corev1.ConditionFalse,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.retained {
+				run := &metav1.ObjectMeta{Namespace: test.namespace, Name: "run-1", UID: types.UID("uid-1")}
+				helper.RetentionTracker.Retain(helper.KindPipelineRun, run, helper.RetentionReasonWithinTTL)
+				t.Cleanup(func() { helper.RetentionTracker.Forget(helper.KindPipelineRun, run) })
+			}
+
+			r := &Reconciler{}
+			tknPr := newTektonPruner(test.namespace, test.ttl)
+			err := r.ReconcileKind(context.Background(), tknPr)
+
+			requeue, delay := controller.IsRequeueKey(err)
+			if requeue != test.wantRequeue {
+				t.Errorf("expected requeue %v, got error %v", test.wantRequeue, err)
+			}
+			if !requeue && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if requeue && delay != helper.DefaultRetentionBreakdownRefreshInterval {
+				t.Errorf("expected requeue after %v, got %v", helper.DefaultRetentionBreakdownRefreshInterval, delay)
+			}
+
+			condition := tknPr.Status.GetCondition(tektonprunerv1alpha1.TektonPrunerConditionReady)
+			if condition == nil || condition.Status != test.wantReady {
+				t.Errorf("expected ready condition %v, got %+v", test.wantReady, condition)
+			}
+			if got := tknPr.Status.RetentionBreakdown[helper.RetentionReasonWithinTTL]; got != test.wantRetained {
+				t.Errorf("expected %d retained within ttl, got %d", test.wantRetained, got)
+			}
+
+			ttl := helper.PrunerConfigStore.GetPipelineTTLSecondsAfterFinished(test.namespace, "pipeline-1")
+			if (ttl == nil) != (test.wantTTL == nil) || (ttl != nil && *ttl != *test.wantTTL) {
+				t.Errorf("expected namespace ttl %v, got %v", test.wantTTL, ttl)
+			}
+		})
+	}
+}
+
+func TestReconcileKindInvalidSpecDropsAcceptedSpec(t *testing.T) {
+	loadTestGlobalConfig(t, "ns-invalid-update")
+
+	r := &Reconciler{}
+	if err := r.ReconcileKind(context.Background(), newTektonPruner("ns-invalid-update", 60)); err != nil {
+		t.Fatalf("unexpected error on the valid spec: %v", err)
+	}
+	if err := r.ReconcileKind(context.Background(), newTektonPruner("ns-invalid-update", -2)); err != nil {
+		t.Fatalf("unexpected error on the invalid spec: %v", err)
+	}
+	if ttl := helper.PrunerConfigStore.GetPipelineTTLSecondsAfterFinished("ns-invalid-update", "pipeline-1"); ttl != nil {
+		t.Errorf("expected the accepted spec to be dropped on an invalid update, got ttl %d", *ttl)
+	}
+}
+
+func TestReconcileKindPrunedRequeue(t *testing.T) {
+	loadTestGlobalConfig(t, "ns-pruned")
+
+	helper.PruneTracker.Pruned(helper.KindPipelineRun, "ns-pruned")
+	helper.PruneTracker.Pruned(helper.KindTaskRun, "ns-pruned")
+
+	r := &Reconciler{}
+	tknPr := newTektonPruner("ns-pruned", 60)
+	err := r.ReconcileKind(context.Background(), tknPr)
+	if requeue, _ := controller.IsRequeueKey(err); !requeue {
+		t.Errorf("expected a requeue after the deletions, got %v", err)
+	}
+	if tknPr.Status.LastPrunedCount != 2 || tknPr.Status.LastPrunedTime == nil {
+		t.Errorf("expected 2 deletions with a time, got %d at %v", tknPr.Status.LastPrunedCount, tknPr.Status.LastPrunedTime)
+	}
+
+	// the deletions are collected, the next refresh has nothing to report
+	previous := tknPr.Status.LastPrunedTime
+	if err := r.ReconcileKind(context.Background(), tknPr); err != nil {
+		t.Errorf("expected no requeue once the deletions are collected, got %v", err)
+	}
+	if tknPr.Status.LastPrunedTime != previous {
+		t.Errorf("expected the previous deletion report to be kept")
+	}
+}
+
+func TestObserveDeletion(t *testing.T) {
+	loadTestGlobalConfig(t, "ns-deleted")
+
+	r := &Reconciler{}
+	tknPr := newTektonPruner("ns-deleted", 60)
+	if err := r.ReconcileKind(context.Background(), tknPr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ttl := helper.PrunerConfigStore.GetPipelineTTLSecondsAfterFinished("ns-deleted", "pipeline-1"); ttl == nil {
+		t.Fatalf("expected the namespace spec to be accepted")
+	}
+
+	key := types.NamespacedName{Namespace: tknPr.Namespace, Name: tknPr.Name}
+	if err := r.ObserveDeletion(context.Background(), key); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ttl := helper.PrunerConfigStore.GetPipelineTTLSecondsAfterFinished("ns-deleted", "pipeline-1"); ttl != nil {
+		t.Errorf("expected the namespace spec to be dropped on the deletion, got ttl %d", *ttl)
+	}
+}